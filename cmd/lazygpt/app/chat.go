@@ -11,26 +11,45 @@ import (
 
 	"github.com/c-bata/go-prompt"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 
+	"github.com/lazygpt/lazygpt/pkg/chunk"
+	aicontext "github.com/lazygpt/lazygpt/pkg/context"
+	"github.com/lazygpt/lazygpt/pkg/models"
 	"github.com/lazygpt/lazygpt/pkg/plugin"
+	"github.com/lazygpt/lazygpt/pkg/summary"
 	"github.com/lazygpt/lazygpt/pkg/tokens"
 	"github.com/lazygpt/lazygpt/plugin/api"
 	"github.com/lazygpt/lazygpt/plugin/log"
 )
 
 const (
-	MaxMemory   = 10
-	MemoryCount = 10
-
-	MaxTokens      = 4096
-	ResponseTokens = 1024
-	SendTokens     = MaxTokens - ResponseTokens
-
-	// NOTE(jkoelker) Allow 80% of the tokens to be used for the memory.
-	//                Perform this calculation in integer space to avoid
-	//                floating point errors.
-	MemoryTokens  = SendTokens * 80 / 100
-	HistoryTokens = SendTokens - MemoryTokens
+	MaxMemory     = 10
+	MemoryCount   = 10
+	RecallWorkers = 4
+	MemorySource  = "chat"
+
+	// MemoryNeighbors is the number of chunks of the same document recalled
+	// around each recalled chunk.
+	MemoryNeighbors = 1
+
+	DefaultModel = "gpt-3.5-turbo"
+
+	// NOTE(jkoelker) Shares of the tokens sent to the model the sections of
+	//                the context may use. History is guaranteed a share so
+	//                the latest turns always fit, memories use what history
+	//                and the summary leave.
+	MemoryMaxShare  = 0.7
+	SummaryMaxShare = 0.1
+	HistoryMinShare = 0.2
+	HistoryMaxShare = 0.6
+
+	// NOTE(jkoelker) Sections with a higher priority get their share of the
+	//                context first.
+	TimePriority    = 100
+	HistoryPriority = 90
+	SummaryPriority = 50
+	MemoryPriority  = 10
 )
 
 func InitChatCmd(app *LazyGPTApp) {
@@ -43,6 +62,11 @@ func InitChatCmd(app *LazyGPTApp) {
 
 			ctx := cmd.Context()
 
+			model, err := models.Lookup(viper.GetString("model"))
+			if err != nil {
+				return fmt.Errorf("failed to get model: %w", err)
+			}
+
 			completion, closeCompletion, err := Completion(ctx, manager, "openai")
 			if err != nil {
 				return fmt.Errorf("failed to get completion: %w", err)
@@ -53,7 +77,18 @@ func InitChatCmd(app *LazyGPTApp) {
 				}
 			}()
 
-			memory, closeMemory, err := Memory(ctx, manager, "local")
+			tokenizer, err := Tokenizer(ctx, manager, "openai")
+			if err != nil {
+				return fmt.Errorf("failed to get tokenizer: %w", err)
+			}
+
+			// NOTE(jkoelker) The history is counted again every turn, keep
+			//                the counts rather than asking the plugin.
+			if tokenizer != nil {
+				tokenizer = tokens.NewCachedTokenizer(tokenizer)
+			}
+
+			memory, closeMemory, err := Memory(ctx, manager, viper.GetString("memory-plugin"))
 			if err != nil {
 				return fmt.Errorf("failed to get memory: %w", err)
 			}
@@ -63,7 +98,8 @@ func InitChatCmd(app *LazyGPTApp) {
 				}
 			}()
 
-			execute := Executor(ctx, completion, memory)
+			namespace := api.Namespace(viper.GetString("memory-namespace"))
+			execute := Executor(ctx, completion, tokenizer, memory, namespace, model)
 
 			if err := execute(Prompt(), "system"); err != nil {
 				return fmt.Errorf("failed to set initial prompt: %w", err)
@@ -95,15 +131,40 @@ func InitChatCmd(app *LazyGPTApp) {
 		},
 	}
 
+	chatCmd.Flags().String("model", DefaultModel, "language model to chat with")
+
+	if err := viper.BindPFlag("model", chatCmd.Flags().Lookup("model")); err != nil {
+		panic(err)
+	}
+
 	app.RootCmd.AddCommand(chatCmd)
 }
 
 func Executor(
 	ctx context.Context,
 	completion api.Completion,
+	tokenizer api.Tokenizer,
 	memory api.Memory,
+	namespace string,
+	model models.Model,
 ) func(string, string) error {
-	var history []api.Message
+	var (
+		chunker *chunk.Chunker
+		history []api.Message
+	)
+
+	// NOTE(jkoelker) `summarized` is the number of history messages already
+	//                folded into the summary.
+	summarized := 0
+	summaryTokens := int(SummaryMaxShare * float64(model.SendTokens()))
+	summarizer := summary.NewSummarizer(completion, model, summaryTokens, tokenizer)
+
+	// NOTE(jkoelker) Memories are recalled from every namespace with
+	//                `api.AllNamespaces`, but are memorized into one.
+	memorizeNamespace := namespace
+	if namespace == api.AllNamespaces {
+		memorizeNamespace = api.DefaultNamespace
+	}
 
 	return func(input string, role string) error {
 		memories := make([]string, 0, MaxMemory)
@@ -112,7 +173,7 @@ func Executor(
 			memories = append(memories, Memorize(&history[i], "", ""))
 		}
 
-		recollection, err := Recollection(ctx, memory, memories)
+		recollection, err := Recollection(ctx, memory, namespace, memories)
 		if err != nil {
 			return fmt.Errorf("failed to recollect: %w", err)
 		}
@@ -122,21 +183,60 @@ func Executor(
 			Content: input,
 		})
 
-		context, tokens, err := AIContext(
+		// NOTE(jkoelker) The messages folded into the summary are left out
+		//                of the history so they are not sent twice, the
+		//                dropped indexes are relative to the rest.
+		context, report, err := AIContext(
 			ctx,
 			recollection,
-			history,
-			"gpt-3.5-turbo",
-			MemoryTokens,
-			HistoryTokens,
+			summarizer.Message(),
+			history[summarized:],
+			model,
+			tokenizer,
 		)
 		if err != nil {
 			return fmt.Errorf("failed to create context: %w", err)
 		}
 
-		log.Info(ctx, "Thinking...", "context", context, "tokens", tokens)
+		first := summarized
+		if dropped := report.Section(aicontext.SectionHistory).Dropped; len(dropped) > 0 {
+			first = summarized + dropped[len(dropped)-1] + 1
+		}
 
-		response, reason, err := completion.Complete(ctx, context)
+		// NOTE(jkoelker) Fold the messages that just fell out of the window
+		//                into the summary and rebuild the context with it.
+		//                Summarizing only saves what would be lost, if it
+		//                fails the turn goes on without it and it is tried
+		//                again next turn.
+		if first > summarized {
+			if err := summarizer.Summarize(ctx, history[summarized:first]); err != nil {
+				log.Error(ctx, "failed to summarize", err, "messages", first-summarized)
+			} else {
+				summarized = first
+
+				context, report, err = AIContext(
+					ctx,
+					recollection,
+					summarizer.Message(),
+					history[summarized:],
+					model,
+					tokenizer,
+				)
+				if err != nil {
+					return fmt.Errorf("failed to create context: %w", err)
+				}
+			}
+		}
+
+		log.Info(
+			ctx, "Thinking...",
+			"context", context,
+			"tokens", report.Tokens,
+			"sections", report.Sections,
+			"max_cost", model.Cost(report.Tokens, model.MaxOutput),
+		)
+
+		response, reason, err := completion.Complete(ctx, model.Name, context)
 		if err != nil || response == nil {
 			log.Error(
 				ctx, "failed to complete", err,
@@ -154,10 +254,25 @@ func Executor(
 			Content: response.Content,
 		})
 
-		if err := memory.Memorize(
-			ctx,
-			[]string{Memorize(response, "", input)},
-		); err != nil {
+		if chunker == nil {
+			tok, err := tokens.NewTokenizer(model, tokenizer)
+			if err != nil {
+				return fmt.Errorf("failed to create tokenizer: %w", err)
+			}
+
+			chunker = chunk.NewChunker(tok, chunk.DefaultMaxTokens, chunk.DefaultOverlap)
+		}
+
+		records, err := MemoryRecords(ctx, chunker, api.Record{
+			Data:      Memorize(response, "", input),
+			Metadata:  map[string]string{api.MetadataSource: MemorySource},
+			Namespace: memorizeNamespace,
+		})
+		if err != nil {
+			return err
+		}
+
+		if _, err := memory.Memorize(ctx, records); err != nil {
 			return fmt.Errorf("failed to memorize: %w", err)
 		}
 
@@ -194,21 +309,6 @@ the least number of steps.
 	)
 }
 
-func Recollection(ctx context.Context, memory api.Memory, memories []string) ([]string, error) {
-	var recollection []string
-
-	for idx := range memories {
-		recall, err := memory.Recall(ctx, memories[idx], MemoryCount)
-		if err != nil {
-			return nil, fmt.Errorf("failed to recall: %w", err)
-		}
-
-		recollection = append(recollection, recall...)
-	}
-
-	return recollection, nil
-}
-
 func Memorize(msg *api.Message, result string, feedback string) string {
 	return fmt.Sprintf(
 		"Assistant Reply: %s\nResult: %s\nHuman Feedback: %s",
@@ -218,71 +318,77 @@ func Memorize(msg *api.Message, result string, feedback string) string {
 	)
 }
 
+// AIContext packs the time, recalled memories, conversation summary and
+// history into the tokens the model can be sent. The history must leave out
+// the messages already in the summary. It returns the messages and the report
+// of the tokens used by each section.
 func AIContext(
-	_ context.Context,
-	memories []string,
+	ctx context.Context,
+	memories []api.Record,
+	conversation *api.Message,
 	history []api.Message,
-	model string,
-	memoriesTokens int,
-	historyTokens int,
-) ([]api.Message, int, error) {
-	counter, err := tokens.NewCounter(model)
-	if err != nil {
-		return nil, 0, fmt.Errorf("failed to create counter: %w", err)
-	}
+	model models.Model,
+	tokenizer api.Tokenizer,
+) ([]api.Message, *aicontext.Report, error) {
+	budgeter := aicontext.NewBudgeter(model, model.SendTokens(), tokenizer)
 
 	now := time.Now()
-	messages := []api.Message{
-		{
-			Role:    "system",
-			Content: fmt.Sprintf("The current time and date is %s", now.Format(time.RFC3339)),
+	budgeter.Add(aicontext.Section{
+		Name:     aicontext.SectionTime,
+		Priority: TimePriority,
+		Strategy: aicontext.TruncateText,
+		Messages: []api.Message{
+			{
+				Role:    "system",
+				Content: fmt.Sprintf("The current time and date is %s", now.Format(time.RFC3339)),
+			},
 		},
+	})
+
+	reminders := aicontext.Section{
+		Name:     aicontext.SectionMemories,
+		Priority: MemoryPriority,
+		MaxShare: MemoryMaxShare,
+		Strategy: aicontext.DropLowestScore,
+		Messages: make([]api.Message, len(memories)),
+		Scores:   make([]float64, len(memories)),
 	}
 
-	if err := counter.Add(messages...); err != nil {
-		return nil, 0, fmt.Errorf("failed to add message to counter: %w", err)
-	}
-
-	for _, memory := range memories {
-		message := api.Message{
+	for idx, memory := range memories {
+		reminders.Messages[idx] = api.Message{
 			Role:    "system",
-			Content: fmt.Sprintf("This reminds you of this event from your past: %s", memory),
-		}
-
-		if err := counter.Add(message); err != nil {
-			return nil, 0, fmt.Errorf("failed to add message to counter: %w", err)
-		}
-
-		if counter.Tokens >= memoriesTokens {
-			break
+			Content: Reminder(&memory),
 		}
-
-		messages = append(messages, message)
+		reminders.Scores[idx] = float64(memory.Score)
 	}
 
-	maxHistoryIdx := len(history) - 1
-
-	// NOTE(jkoelker) Walk history backwards adding messages until we reach the
-	//                max number of history tokens.
-	for idx := len(history) - 1; idx >= 0; idx-- {
-		if err := counter.Add(history[idx]); err != nil {
-			return nil, 0, fmt.Errorf("failed to add message to counter: %w", err)
-		}
+	budgeter.Add(reminders)
 
-		if counter.Tokens >= historyTokens {
-			maxHistoryIdx = idx - 1
-
-			break
-		}
+	if conversation != nil {
+		budgeter.Add(aicontext.Section{
+			Name:     aicontext.SectionSummary,
+			Priority: SummaryPriority,
+			MaxShare: SummaryMaxShare,
+			Strategy: aicontext.TruncateText,
+			Messages: []api.Message{*conversation},
+		})
 	}
 
-	// NOTE(jkoelker) Add history messages in reverse order so they are in the
-	//                correct order.
-	for idx := len(history) - 1; idx >= maxHistoryIdx; idx-- {
-		messages = append(messages, history[idx])
+	budgeter.Add(aicontext.Section{
+		Name:     aicontext.SectionHistory,
+		Priority: HistoryPriority,
+		MinShare: HistoryMinShare,
+		MaxShare: HistoryMaxShare,
+		Strategy: aicontext.DropOldest,
+		Messages: history,
+	})
+
+	messages, report, err := budgeter.Pack(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to pack context: %w", err)
 	}
 
-	return messages, counter.Tokens, nil
+	return messages, report, nil
 }
 
 func Completion( //nolint:ireturn
@@ -340,3 +446,55 @@ func Memory( //nolint:ireturn
 
 	return memory, protocol.Close, nil
 }
+
+// Tokenizer returns the tokenizer of the plugin if it implements one. If it
+// does not, the returned tokenizer is `nil` and token counting falls back to
+// the tiktoken encoding of the model. The tokenizer shares the plugin
+// protocol with the other interfaces of the plugin, it is closed with them.
+func Tokenizer( //nolint:ireturn
+	ctx context.Context,
+	manager *plugin.Manager,
+	name string,
+) (api.Tokenizer, error) {
+	interfaces, err := manager.Interfaces(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get interfaces: %w", err)
+	}
+
+	if !Implements(interfaces, "tokenizer") {
+		return nil, nil //nolint:nilnil // the tokenizer is optional
+	}
+
+	client, err := manager.Client(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client: %w", err)
+	}
+
+	protocol, err := client.Client()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get protocol: %w", err)
+	}
+
+	raw, err := protocol.Dispense("tokenizer")
+	if err != nil {
+		return nil, fmt.Errorf("failed to dispense: %w", err)
+	}
+
+	tokenizer, ok := raw.(api.Tokenizer)
+	if !ok {
+		return nil, fmt.Errorf("failed to cast tokenizer: %w", plugin.ErrUnexpectedInterface)
+	}
+
+	return tokenizer, nil
+}
+
+// Implements returns true if the interface is in the list of interfaces.
+func Implements(interfaces []string, iface string) bool {
+	for _, name := range interfaces {
+		if name == iface {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,89 @@
+//
+
+package app
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/lazygpt/lazygpt/pkg/chunk"
+	"github.com/lazygpt/lazygpt/pkg/ingest"
+	"github.com/lazygpt/lazygpt/pkg/models"
+	"github.com/lazygpt/lazygpt/pkg/tokens"
+	"github.com/lazygpt/lazygpt/plugin/api"
+)
+
+// IngestEncoding is the encoding ingested files are chunked by, that of the
+// embedding models rather than the chat model.
+const IngestEncoding = models.EncodingCl100kBase
+
+func InitIngestCmd(app *LazyGPTApp) {
+	ingestCmd := &cobra.Command{
+		Use:   "ingest <path>...",
+		Short: "Memorize files and directories so they can be recalled",
+		Long: `Memorize the Markdown, plain text, HTML and source code files under each
+path, chunked and tagged with the file and lines each chunk comes from. Files
+already ingested are only memorized again when they changed, memories of files
+that are gone or no longer included are forgotten.
+
+Patterns without a slash match file and directory names at any depth, others
+match the path relative to the ingested directory, "**" matching any number of
+directories.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: MemoryCommand(func(cmd *cobra.Command, args []string, memory api.Memory) error {
+			include, _ := cmd.Flags().GetStringSlice("include")
+			exclude, _ := cmd.Flags().GetStringSlice("exclude")
+			maxTokens, _ := cmd.Flags().GetInt("max-tokens")
+			overlap, _ := cmd.Flags().GetInt("overlap")
+			maxFileSize, _ := cmd.Flags().GetInt64("max-file-size")
+
+			tokenizer, err := tokens.NewTiktoken(IngestEncoding)
+			if err != nil {
+				return fmt.Errorf("failed to create tokenizer: %w", err)
+			}
+
+			ingester := ingest.NewIngester(memory, tokenizer, MemoryNamespace(cmd))
+			ingester.Include = include
+			ingester.Exclude = append(ingester.Exclude, exclude...)
+			ingester.MaxTokens = maxTokens
+			ingester.Overlap = overlap
+			ingester.MaxFileSize = maxFileSize
+
+			var report ingest.Report
+
+			for _, path := range args {
+				ingested, err := ingester.Ingest(cmd.Context(), path)
+				report.Add(ingested)
+
+				if err != nil {
+					return err //nolint:wrapcheck // already wrapped
+				}
+			}
+
+			fmt.Fprintf(
+				cmd.OutOrStdout(),
+				"ingested %d files in %d chunks, %d unchanged, %d skipped, %d removed\n",
+				report.Ingested,
+				report.Chunks,
+				report.Unchanged,
+				report.Skipped,
+				report.Removed,
+			)
+
+			return nil
+		}),
+	}
+
+	ingestCmd.Flags().StringSlice("include", nil, "patterns of the files to ingest (default every known kind of file)")
+	ingestCmd.Flags().StringSlice(
+		"exclude",
+		nil,
+		fmt.Sprintf("patterns of the files and directories not to ingest, in addition to %q", ingest.DefaultExclude()),
+	)
+	ingestCmd.Flags().Int("max-tokens", chunk.DefaultMaxTokens, "maximum number of tokens of a chunk")
+	ingestCmd.Flags().Int("overlap", chunk.DefaultOverlap, "number of tokens a chunk repeats from the previous one")
+	ingestCmd.Flags().Int64("max-file-size", ingest.DefaultMaxFileSize, "size in bytes of the largest file ingested")
+
+	app.RootCmd.AddCommand(ingestCmd)
+}
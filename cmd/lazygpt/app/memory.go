@@ -0,0 +1,678 @@
+//
+
+package app
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/lazygpt/lazygpt/pkg/archive"
+	"github.com/lazygpt/lazygpt/pkg/plugin"
+	"github.com/lazygpt/lazygpt/plugin/api"
+	"github.com/lazygpt/lazygpt/plugin/log"
+)
+
+const (
+	DefaultMemoryPlugin = "local"
+
+	// NOTE(jkoelker) Memories are listed with their data on a single line,
+	//                cut to fit a terminal.
+	MemoryPreviewLength = 60
+)
+
+// ErrRestoreStdin is returned when restoring from standard input without
+// `--force`, the answer to the confirmation would be read from the backup.
+var ErrRestoreStdin = errors.New("restoring from standard input requires --force")
+
+// MemoryNamespace returns the configured memory namespace, or
+// `api.AllNamespaces` if the command has an `--all-namespaces` flag that is
+// set.
+func MemoryNamespace(cmd *cobra.Command) string {
+	if all, err := cmd.Flags().GetBool("all-namespaces"); err == nil && all {
+		return api.AllNamespaces
+	}
+
+	return api.Namespace(viper.GetString("memory-namespace"))
+}
+
+// MemoryCommand returns a `cobra.Command` run function that runs fn with the
+// configured memory plugin, closing the plugin once it returns.
+func MemoryCommand(
+	fn func(cmd *cobra.Command, args []string, memory api.Memory) error,
+) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		manager := plugin.NewManager()
+		defer manager.Close()
+
+		ctx := cmd.Context()
+
+		memory, closeMemory, err := Memory(ctx, manager, viper.GetString("memory-plugin"))
+		if err != nil {
+			return fmt.Errorf("failed to get memory: %w", err)
+		}
+		defer func() {
+			if err := closeMemory(); err != nil {
+				log.Error(ctx, "failed to close memory", err)
+			}
+		}()
+
+		return fn(cmd, args, memory)
+	}
+}
+
+// Maintenance returns the maintenance of the plugin. If the plugin does not
+// implement one, the error wraps `plugin.ErrUnsupportedPluginInterface`.
+func Maintenance( //nolint:ireturn
+	ctx context.Context,
+	manager *plugin.Manager,
+	name string,
+) (api.Maintenance, func() error, error) {
+	interfaces, err := manager.Interfaces(ctx, name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get interfaces: %w", err)
+	}
+
+	if !Implements(interfaces, "maintenance") {
+		return nil, nil, fmt.Errorf("%w: %s does not implement maintenance", plugin.ErrUnsupportedPluginInterface, name)
+	}
+
+	client, err := manager.Client(ctx, name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get client: %w", err)
+	}
+
+	protocol, err := client.Client()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get protocol: %w", err)
+	}
+
+	raw, err := protocol.Dispense("maintenance")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to dispense: %w", err)
+	}
+
+	maintenance, ok := raw.(api.Maintenance)
+	if !ok {
+		return nil, nil, fmt.Errorf("failed to cast maintenance: %w", plugin.ErrUnexpectedInterface)
+	}
+
+	return maintenance, protocol.Close, nil
+}
+
+// MaintenanceCommand returns a `cobra.Command` run function that runs fn with
+// the maintenance of the configured memory plugin, closing the plugin once
+// it returns.
+func MaintenanceCommand(
+	fn func(cmd *cobra.Command, args []string, maintenance api.Maintenance) error,
+) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		manager := plugin.NewManager()
+		defer manager.Close()
+
+		ctx := cmd.Context()
+
+		maintenance, closeMaintenance, err := Maintenance(ctx, manager, viper.GetString("memory-plugin"))
+		if err != nil {
+			return fmt.Errorf("failed to get memory maintenance: %w", err)
+		}
+		defer func() {
+			if err := closeMaintenance(); err != nil {
+				log.Error(ctx, "failed to close memory maintenance", err)
+			}
+		}()
+
+		return fn(cmd, args, maintenance)
+	}
+}
+
+func InitMemoryCmd(app *LazyGPTApp) {
+	memoryCmd := &cobra.Command{
+		Use:   "memory",
+		Short: "Inspect and manage what LazyGPT remembers",
+	}
+
+	memoryCmd.AddCommand(
+		memoryListCmd(),
+		memorySearchCmd(),
+		memoryShowCmd(),
+		memoryForgetCmd(),
+		memoryClearCmd(),
+		memoryExportCmd(),
+		memoryImportCmd(),
+		memoryBackupCmd(),
+		memoryRestoreCmd(),
+		memoryCompactCmd(),
+	)
+
+	app.RootCmd.AddCommand(memoryCmd)
+}
+
+func memoryListCmd() *cobra.Command {
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List memories, oldest first",
+		Args:  cobra.NoArgs,
+		RunE: MemoryCommand(func(cmd *cobra.Command, _ []string, memory api.Memory) error {
+			cursor, _ := cmd.Flags().GetString("cursor")
+			limit, _ := cmd.Flags().GetInt("limit")
+			all, _ := cmd.Flags().GetBool("all")
+
+			writer := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0) //nolint:gomnd // column padding
+			fmt.Fprintln(writer, "ID\tNAMESPACE\tCREATED\tDATA")
+
+			for {
+				page, err := memory.List(cmd.Context(), api.ListOptions{
+					Namespace: MemoryNamespace(cmd),
+					Cursor:    cursor,
+					Limit:     limit,
+				})
+				if err != nil {
+					return fmt.Errorf("failed to list memories: %w", err)
+				}
+
+				for _, record := range page.Records {
+					fmt.Fprintf(
+						writer,
+						"%s\t%s\t%s\t%s\n",
+						record.ID,
+						record.Namespace,
+						Created(record.Created),
+						Preview(record.Data),
+					)
+				}
+
+				cursor = page.Next
+				if !all || cursor == "" {
+					break
+				}
+			}
+
+			if err := writer.Flush(); err != nil {
+				return fmt.Errorf("failed to write memories: %w", err)
+			}
+
+			if cursor != "" {
+				fmt.Fprintf(cmd.ErrOrStderr(), "more memories, continue with --cursor %s\n", cursor)
+			}
+
+			return nil
+		}),
+	}
+
+	listCmd.Flags().String("cursor", "", "id of the first memory to list")
+	listCmd.Flags().Int("limit", 0, "number of memories to list per page (default chosen by the plugin)")
+	listCmd.Flags().Bool("all", false, "list all the memories")
+	listCmd.Flags().Bool("all-namespaces", false, "list the memories of every namespace")
+
+	return listCmd
+}
+
+func memorySearchCmd() *cobra.Command {
+	searchCmd := &cobra.Command{
+		Use:   "search <query>",
+		Short: "Recall the memories closest to the query",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: MemoryCommand(func(cmd *cobra.Command, args []string, memory api.Memory) error {
+			count, _ := cmd.Flags().GetInt("count")
+			minScore, _ := cmd.Flags().GetFloat32("min-score")
+			similarity, _ := cmd.Flags().GetBool("similarity")
+			neighbors, _ := cmd.Flags().GetInt("neighbors")
+
+			query := api.Query{
+				Data:       strings.Join(args, " "),
+				Count:      count,
+				MinScore:   minScore,
+				Namespaces: []string{MemoryNamespace(cmd)},
+				Neighbors:  neighbors,
+			}
+
+			if similarity {
+				ranking := api.SimilarityRanking()
+				query.Ranking = &ranking
+			}
+
+			if cmd.Flags().Changed("keyword-weight") {
+				keyword, _ := cmd.Flags().GetFloat32("keyword-weight")
+				query.Fusion = &api.Fusion{Vector: 1, Keyword: keyword, K: api.DefaultFusionK}
+			}
+
+			records, err := memory.Recall(cmd.Context(), query)
+			if err != nil {
+				return fmt.Errorf("failed to recall memories: %w", err)
+			}
+
+			writer := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0) //nolint:gomnd // column padding
+			fmt.Fprintln(writer, "SCORE\tID\tNAMESPACE\tDATA")
+
+			for _, record := range records {
+				fmt.Fprintf(
+					writer,
+					"%.4f\t%s\t%s\t%s\n",
+					record.Score,
+					record.ID,
+					record.Namespace,
+					Preview(record.Data),
+				)
+
+				for _, neighbor := range record.Neighbors {
+					fmt.Fprintf(writer, "-\t%s\t%s\t%s\n", neighbor.ID, neighbor.Namespace, Preview(neighbor.Data))
+				}
+			}
+
+			if err := writer.Flush(); err != nil {
+				return fmt.Errorf("failed to write memories: %w", err)
+			}
+
+			return nil
+		}),
+	}
+
+	searchCmd.Flags().Int("count", MemoryCount, "number of memories to recall")
+	searchCmd.Flags().Float32("min-score", 0, "minimum score of the recalled memories")
+	searchCmd.Flags().Bool("similarity", false, "rank by similarity only, ignoring recency and importance")
+	searchCmd.Flags().Float32(
+		"keyword-weight",
+		1,
+		"weight of the keyword search relative to the vector search, 0 searches by vector only",
+	)
+	searchCmd.Flags().Int("neighbors", 0, "number of chunks of the same document to show around each memory")
+	searchCmd.Flags().Bool("all-namespaces", false, "recall the memories of every namespace")
+
+	return searchCmd
+}
+
+func memoryShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show <id>",
+		Short: "Show a memory",
+		Args:  cobra.ExactArgs(1),
+		RunE: MemoryCommand(func(cmd *cobra.Command, args []string, memory api.Memory) error {
+			record, err := memory.Get(cmd.Context(), args[0])
+			if err != nil {
+				return fmt.Errorf("failed to get memory: %w", err)
+			}
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "ID:         %s\n", record.ID)
+			fmt.Fprintf(out, "Namespace:  %s\n", record.Namespace)
+			fmt.Fprintf(out, "Created:    %s\n", Created(record.Created))
+			fmt.Fprintf(out, "Accessed:   %s\n", Created(record.Accessed))
+			fmt.Fprintf(out, "Importance: %.2f\n", record.Importance)
+
+			if !record.Expires.IsZero() {
+				fmt.Fprintf(out, "Expires:    %s\n", Created(record.Expires))
+			}
+
+			keys := make([]string, 0, len(record.Metadata))
+			for key := range record.Metadata {
+				keys = append(keys, key)
+			}
+
+			sort.Strings(keys)
+
+			for _, key := range keys {
+				fmt.Fprintf(out, "%s: %s\n", key, record.Metadata[key])
+			}
+
+			fmt.Fprintf(out, "\n%s\n", record.Data)
+
+			return nil
+		}),
+	}
+}
+
+func memoryForgetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "forget <id>...",
+		Short: "Forget memories",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: MemoryCommand(func(cmd *cobra.Command, args []string, memory api.Memory) error {
+			if err := memory.Delete(cmd.Context(), args); err != nil {
+				return fmt.Errorf("failed to forget memories: %w", err)
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "forgot %d memories\n", len(args))
+
+			return nil
+		}),
+	}
+}
+
+func memoryClearCmd() *cobra.Command {
+	clearCmd := &cobra.Command{
+		Use:   "clear",
+		Short: "Forget all memories of the namespace",
+		Args:  cobra.NoArgs,
+		RunE: MemoryCommand(func(cmd *cobra.Command, _ []string, memory api.Memory) error {
+			force, _ := cmd.Flags().GetBool("force")
+			namespace := MemoryNamespace(cmd)
+
+			question := fmt.Sprintf("Forget all memories of namespace %q?", namespace)
+			if namespace == api.AllNamespaces {
+				question = "Forget all memories of every namespace?"
+			}
+
+			if !force && !Confirm(cmd.InOrStdin(), cmd.OutOrStdout(), question) {
+				return nil
+			}
+
+			if err := memory.Clear(cmd.Context(), namespace); err != nil {
+				return fmt.Errorf("failed to clear memories: %w", err)
+			}
+
+			fmt.Fprintln(cmd.OutOrStdout(), "forgot all memories")
+
+			return nil
+		}),
+	}
+
+	clearCmd.Flags().BoolP("force", "f", false, "do not ask for confirmation")
+	clearCmd.Flags().Bool("all-namespaces", false, "forget the memories of every namespace")
+
+	return clearCmd
+}
+
+func memoryExportCmd() *cobra.Command {
+	exportCmd := &cobra.Command{
+		Use:   "export [file]",
+		Short: "Export the memories of the namespace as JSON lines",
+		Long: `Export the memories of the namespace as JSON lines, to the file or to
+standard output. The vectors are left out unless --vectors is given.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: MemoryCommand(func(cmd *cobra.Command, args []string, memory api.Memory) error {
+			vectors, _ := cmd.Flags().GetBool("vectors")
+
+			var file *os.File
+
+			out := cmd.OutOrStdout()
+
+			if len(args) == 1 && args[0] != "-" {
+				var err error
+
+				file, err = os.Create(args[0])
+				if err != nil {
+					return fmt.Errorf("failed to create export file: %w", err)
+				}
+
+				out = file
+			}
+
+			count, err := archive.Export(cmd.Context(), memory, MemoryNamespace(cmd), archive.NewWriter(out), vectors)
+
+			// NOTE(jkoelker) Closing the file flushes it, an export that
+			//                failed to close is incomplete.
+			if file != nil {
+				if closeErr := file.Close(); err == nil {
+					err = closeErr
+				}
+			}
+
+			if err != nil {
+				return fmt.Errorf("failed to export memories: %w", err)
+			}
+
+			fmt.Fprintf(cmd.ErrOrStderr(), "exported %d memories\n", count)
+
+			return nil
+		}),
+	}
+
+	exportCmd.Flags().Bool("vectors", false, "include the vectors and the model that embedded them")
+	exportCmd.Flags().Bool("all-namespaces", false, "export the memories of every namespace")
+
+	return exportCmd
+}
+
+func memoryImportCmd() *cobra.Command {
+	importCmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Import memories from JSON lines",
+		Long: `Import memories exported with "memory export", from the file or from
+standard input for "-". Exported vectors are trusted unless --reembed is
+given, in which case the data is embedded again with the current embedding
+plugin.`,
+		Args: cobra.ExactArgs(1),
+		RunE: MemoryCommand(func(cmd *cobra.Command, args []string, memory api.Memory) error {
+			reembed, _ := cmd.Flags().GetBool("reembed")
+			keepNamespaces, _ := cmd.Flags().GetBool("keep-namespaces")
+			batchSize, _ := cmd.Flags().GetInt("batch-size")
+
+			in := cmd.InOrStdin()
+
+			if args[0] != "-" {
+				file, err := os.Open(args[0])
+				if err != nil {
+					return fmt.Errorf("failed to open import file: %w", err)
+				}
+				defer file.Close()
+
+				in = file
+			}
+
+			options := archive.ImportOptions{
+				Namespace: MemoryNamespace(cmd),
+				Reembed:   reembed,
+				BatchSize: batchSize,
+			}
+
+			if keepNamespaces {
+				options.Namespace = ""
+			}
+
+			count, err := archive.Import(cmd.Context(), memory, archive.NewReader(in), options)
+			if err != nil {
+				return fmt.Errorf("failed to import memories after %d: %w", count, err)
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "imported %d memories\n", count)
+
+			return nil
+		}),
+	}
+
+	importCmd.Flags().Bool("reembed", false, "embed the data again instead of trusting the exported vectors")
+	importCmd.Flags().Bool("keep-namespaces", false, "import into the exported namespaces instead of the configured one")
+	importCmd.Flags().Int("batch-size", archive.DefaultBatchSize, "number of memories memorized at once")
+
+	return importCmd
+}
+
+func memoryBackupCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "backup <file>",
+		Short: "Back up the memories of every namespace",
+		Long: `Back up the storage of the memory plugin to the file, or to standard
+output for "-". The backup is taken while the memory is in use, memories
+stored meanwhile are left out. The file is only replaced once the backup is
+complete.`,
+		Args: cobra.ExactArgs(1),
+		RunE: MaintenanceCommand(func(cmd *cobra.Command, args []string, maintenance api.Maintenance) error {
+			if args[0] == "-" {
+				if err := maintenance.Backup(cmd.Context(), cmd.OutOrStdout()); err != nil {
+					return fmt.Errorf("failed to back up memories: %w", err)
+				}
+
+				return nil
+			}
+
+			// NOTE(jkoelker) Back up next to the file and move it into
+			//                place, a failed backup leaves the previous
+			//                one intact.
+			file, err := os.CreateTemp(filepath.Dir(args[0]), "."+filepath.Base(args[0])+".*")
+			if err != nil {
+				return fmt.Errorf("failed to create backup file: %w", err)
+			}
+			defer os.Remove(file.Name())
+
+			written := &countingWriter{Writer: file}
+
+			err = maintenance.Backup(cmd.Context(), written)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+
+			if err != nil {
+				return fmt.Errorf("failed to back up memories: %w", err)
+			}
+
+			if err := os.Rename(file.Name(), args[0]); err != nil {
+				return fmt.Errorf("failed to move backup file: %w", err)
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "backed up %s to %s\n", Size(written.count), args[0])
+
+			return nil
+		}),
+	}
+}
+
+func memoryRestoreCmd() *cobra.Command {
+	restoreCmd := &cobra.Command{
+		Use:   "restore <file>",
+		Short: "Replace all memories with a backup",
+		Long: `Replace the memories of every namespace with a backup made by
+"memory backup", read from the file or from standard input for "-". Other
+uses of the memory wait for the restore to finish.`,
+		Args: cobra.ExactArgs(1),
+		RunE: MaintenanceCommand(func(cmd *cobra.Command, args []string, maintenance api.Maintenance) error {
+			force, _ := cmd.Flags().GetBool("force")
+
+			in := cmd.InOrStdin()
+
+			if args[0] != "-" {
+				file, err := os.Open(args[0])
+				if err != nil {
+					return fmt.Errorf("failed to open backup file: %w", err)
+				}
+				defer file.Close()
+
+				in = file
+			} else if !force {
+				return ErrRestoreStdin
+			}
+
+			question := fmt.Sprintf("Replace all memories of every namespace with %s?", args[0])
+			if !force && !Confirm(cmd.InOrStdin(), cmd.OutOrStdout(), question) {
+				return nil
+			}
+
+			if err := maintenance.Restore(cmd.Context(), in); err != nil {
+				return fmt.Errorf("failed to restore memories: %w", err)
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "restored memories from %s\n", args[0])
+
+			return nil
+		}),
+	}
+
+	restoreCmd.Flags().BoolP("force", "f", false, "do not ask for confirmation")
+
+	return restoreCmd
+}
+
+func memoryCompactCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "compact",
+		Short: "Reclaim the space of forgotten memories",
+		Long: `Reclaim the space taken by forgotten and updated memories now, rather
+than waiting for the memory plugin to collect it in the background.`,
+		Args: cobra.NoArgs,
+		RunE: MaintenanceCommand(func(cmd *cobra.Command, _ []string, maintenance api.Maintenance) error {
+			compaction, err := maintenance.Compact(cmd.Context())
+			if err != nil {
+				return fmt.Errorf("failed to compact memories: %w", err)
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "compacted %s to %s\n", Size(compaction.Before), Size(compaction.After))
+
+			return nil
+		}),
+	}
+}
+
+// countingWriter counts the bytes written to the writer.
+type countingWriter struct {
+	io.Writer
+
+	count int64
+}
+
+// Write implements `io.Writer`.
+func (writer *countingWriter) Write(data []byte) (int, error) {
+	written, err := writer.Writer.Write(data)
+	writer.count += int64(written)
+
+	return written, err //nolint:wrapcheck // returned to the caller as is
+}
+
+// Confirm asks the question on out and returns true if the answer read from
+// in is yes.
+func Confirm(in io.Reader, out io.Writer, question string) bool {
+	fmt.Fprintf(out, "%s [y/N] ", question)
+
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
+
+// Created formats the creation time of a memory.
+func Created(created time.Time) string {
+	if created.IsZero() {
+		return "unknown"
+	}
+
+	return created.Local().Format(time.RFC3339)
+}
+
+// Preview returns the data on a single line, cut to `MemoryPreviewLength`
+// characters.
+func Preview(data string) string {
+	preview := strings.Join(strings.Fields(data), " ")
+
+	runes := []rune(preview)
+	if len(runes) > MemoryPreviewLength {
+		return string(runes[:MemoryPreviewLength-1]) + "…"
+	}
+
+	return preview
+}
+
+// Size formats a size in bytes with a binary unit.
+func Size(size int64) string {
+	const unit = 1024
+
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	value := float64(size) / unit
+	prefixes := "KMGTPE"
+
+	for idx := 0; idx < len(prefixes); idx++ {
+		if value < unit || idx == len(prefixes)-1 {
+			return fmt.Sprintf("%.1f %ciB", value, prefixes[idx])
+		}
+
+		value /= unit
+	}
+
+	return fmt.Sprintf("%d B", size)
+}
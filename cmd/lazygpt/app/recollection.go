@@ -0,0 +1,203 @@
+//
+
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/lazygpt/lazygpt/pkg/chunk"
+	"github.com/lazygpt/lazygpt/pkg/ingest"
+	"github.com/lazygpt/lazygpt/plugin/api"
+	"github.com/lazygpt/lazygpt/plugin/log"
+)
+
+// Recollection recalls the memories of the namespace closest to each of the
+// memories. Memories recalled by more than one query are merged keeping their
+// best score, the recollection is sorted most similar first.
+func Recollection(
+	ctx context.Context,
+	memory api.Memory,
+	namespace string,
+	memories []string,
+) ([]api.Record, error) {
+	queries := make([]api.Query, len(memories))
+	for idx := range memories {
+		queries[idx] = api.Query{
+			Data:       memories[idx],
+			Count:      MemoryCount,
+			Namespaces: []string{namespace},
+			Neighbors:  MemoryNeighbors,
+		}
+	}
+
+	results, err := memory.RecallBatch(ctx, queries)
+	if errors.Is(err, api.ErrUnimplemented) {
+		log.Debug(ctx, "Memory does not support batches, recalling concurrently")
+
+		results, err = RecallConcurrently(ctx, memory, queries, RecallWorkers)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to recall: %w", err)
+	}
+
+	best := make(map[string]api.Record)
+
+	for _, recall := range results {
+		for _, record := range recall {
+			if current, ok := best[record.ID]; !ok || record.Score > current.Score {
+				best[record.ID] = record
+			}
+		}
+	}
+
+	recollection := make([]api.Record, 0, len(best))
+	for _, record := range best {
+		recollection = append(recollection, record)
+	}
+
+	sort.Slice(recollection, func(i, j int) bool {
+		if recollection[i].Score == recollection[j].Score {
+			return recollection[i].ID < recollection[j].ID
+		}
+
+		return recollection[i].Score > recollection[j].Score
+	})
+
+	return recollection, nil
+}
+
+// RecalledData returns the data of the recalled memory, joined with the data
+// of its neighboring chunks in the order of their document.
+func RecalledData(record *api.Record) string {
+	if len(record.Neighbors) == 0 {
+		return record.Data
+	}
+
+	_, index, _ := record.Chunk()
+	data := make([]string, 0, len(record.Neighbors)+1)
+	added := false
+
+	for idx := range record.Neighbors {
+		if _, neighbor, _ := record.Neighbors[idx].Chunk(); neighbor > index && !added {
+			data = append(data, record.Data)
+			added = true
+		}
+
+		data = append(data, record.Neighbors[idx].Data)
+	}
+
+	if !added {
+		data = append(data, record.Data)
+	}
+
+	return strings.Join(data, "\n")
+}
+
+// Reminder returns the content of the message reminding of the recalled
+// memory. Ingested files are cited by their path, and the lines of the memory
+// and its neighbors.
+func Reminder(record *api.Record) string {
+	if record.Metadata[api.MetadataSource] != ingest.Source {
+		return fmt.Sprintf("This reminds you of this event from your past: %s", RecalledData(record))
+	}
+
+	source := record.Metadata[ingest.MetadataPath]
+
+	if first, last, ok := ingest.ParseLines(record.Metadata[ingest.MetadataLines]); ok {
+		for idx := range record.Neighbors {
+			start, end, ok := ingest.ParseLines(record.Neighbors[idx].Metadata[ingest.MetadataLines])
+			if !ok {
+				continue
+			}
+
+			if start < first {
+				first = start
+			}
+
+			if end > last {
+				last = end
+			}
+		}
+
+		source = fmt.Sprintf("%s, lines %d to %d", source, first, last)
+	}
+
+	return fmt.Sprintf("This is from %s: %s", source, RecalledData(record))
+}
+
+// MemoryRecords returns the records memorizing the record, the chunks of a
+// new document if its data does not fit in a single chunk.
+func MemoryRecords(ctx context.Context, chunker *chunk.Chunker, record api.Record) ([]api.Record, error) {
+	chunks, err := chunker.Split(ctx, record.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to chunk memory: %w", err)
+	}
+
+	if len(chunks) <= 1 {
+		return []api.Record{record}, nil
+	}
+
+	document, err := chunk.NewDocumentID()
+	if err != nil {
+		return nil, err //nolint:wrapcheck // already wrapped
+	}
+
+	return chunk.Records(document, chunks, record), nil
+}
+
+// RecallConcurrently recalls each query with at most workers concurrent
+// recalls, at least one, returning the records in the order of the queries.
+// The first failure cancels the recalls still pending.
+func RecallConcurrently(
+	ctx context.Context,
+	memory api.Memory,
+	queries []api.Query,
+	workers int,
+) ([][]api.Record, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([][]api.Record, len(queries))
+	errs := make([]error, len(queries))
+	jobs := make(chan int)
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	var wg sync.WaitGroup
+
+	for worker := 0; worker < workers && worker < len(queries); worker++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for idx := range jobs {
+				results[idx], errs[idx] = memory.Recall(ctx, queries[idx])
+				if errs[idx] != nil {
+					cancel()
+				}
+			}
+		}()
+	}
+
+	for idx := range queries {
+		jobs <- idx
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("failed to recall: %w", err)
+	}
+
+	return results, nil
+}
@@ -13,6 +13,8 @@ import (
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 
+	"github.com/lazygpt/lazygpt/pkg/models"
+	"github.com/lazygpt/lazygpt/plugin/api"
 	"github.com/lazygpt/lazygpt/plugin/log"
 )
 
@@ -41,6 +43,10 @@ server and serve a web UI.`,
 			ctx := log.NewContext(cmd.Context(), log.NewLogger("lazygpt", logLevel))
 			cmd.SetContext(ctx)
 
+			if err := app.InitModels(); err != nil {
+				return fmt.Errorf("can't load models: %w", err)
+			}
+
 			return nil
 		},
 	}
@@ -59,7 +65,23 @@ server and serve a web UI.`,
 		"log level (trace, debug, info, warn, error)",
 	)
 
+	app.RootCmd.PersistentFlags().String("memory-plugin", DefaultMemoryPlugin, "memory plugin to use")
+	app.RootCmd.PersistentFlags().String(
+		"memory-namespace",
+		api.DefaultNamespace,
+		"namespace of the memories to use, memories of other namespaces are not recalled, "+
+			"'*' recalls from every namespace and memorizes into the default one",
+	)
+
+	for _, name := range []string{"memory-plugin", "memory-namespace"} {
+		if err := viper.BindPFlag(name, app.RootCmd.PersistentFlags().Lookup(name)); err != nil {
+			panic(err)
+		}
+	}
+
 	InitChatCmd(app)
+	InitIngestCmd(app)
+	InitMemoryCmd(app)
 	InitServeCmd(app)
 
 	return app
@@ -110,3 +132,22 @@ func (app *LazyGPTApp) InitConfig() context.Context {
 
 	return ctx
 }
+
+// InitModels registers the models from the `models` config key with the
+// default model registry. Configured models replace builtin models with the
+// same name.
+func (app *LazyGPTApp) InitModels() error {
+	var configured []models.Model
+
+	if err := viper.UnmarshalKey("models", &configured); err != nil {
+		return fmt.Errorf("failed to decode models: %w", err)
+	}
+
+	for _, model := range configured {
+		if err := models.Register(model); err != nil {
+			return fmt.Errorf("failed to register model: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,243 @@
+//
+
+// Package archive exports memories to and imports them from JSON lines, one
+// memory per line, so they can be moved between memory plugins.
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/lazygpt/lazygpt/plugin/api"
+)
+
+// DefaultBatchSize is the number of memories memorized at once on import.
+const DefaultBatchSize = 64
+
+// Memory is a memory as it is archived.
+type Memory struct {
+	ID         string            `json:"id,omitempty"`
+	Namespace  string            `json:"namespace,omitempty"`
+	Data       string            `json:"data"`
+	Created    *time.Time        `json:"created,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	Model      string            `json:"model,omitempty"`
+	Vector     []float32         `json:"vector,omitempty"`
+	Importance float32           `json:"importance,omitempty"`
+	Accessed   *time.Time        `json:"accessed,omitempty"`
+	Expires    *time.Time        `json:"expires,omitempty"`
+}
+
+// timePointer returns a pointer to the time, nil if it is zero.
+func timePointer(value time.Time) *time.Time {
+	if value.IsZero() {
+		return nil
+	}
+
+	return &value
+}
+
+// timeValue returns the time pointed to, zero if nil.
+func timeValue(value *time.Time) time.Time {
+	if value == nil {
+		return time.Time{}
+	}
+
+	return *value
+}
+
+// FromRecord converts the record to an archived memory.
+func FromRecord(record api.Record) Memory {
+	return Memory{
+		ID:         record.ID,
+		Namespace:  record.Namespace,
+		Data:       record.Data,
+		Created:    timePointer(record.Created),
+		Metadata:   record.Metadata,
+		Model:      record.Model,
+		Vector:     record.Vector,
+		Importance: record.Importance,
+		Accessed:   timePointer(record.Accessed),
+		Expires:    timePointer(record.Expires),
+	}
+}
+
+// Record converts the archived memory to an `api.Record`. The id is not kept,
+// the memory plugin assigns a new one.
+func (memory *Memory) Record() api.Record {
+	return api.Record{
+		Data:       memory.Data,
+		Created:    timeValue(memory.Created),
+		Metadata:   memory.Metadata,
+		Namespace:  memory.Namespace,
+		Model:      memory.Model,
+		Vector:     memory.Vector,
+		Importance: memory.Importance,
+		Accessed:   timeValue(memory.Accessed),
+		Expires:    timeValue(memory.Expires),
+	}
+}
+
+// Writer writes archived memories as JSON lines.
+type Writer struct {
+	encoder *json.Encoder
+}
+
+// NewWriter creates a new Writer writing to the writer.
+func NewWriter(writer io.Writer) *Writer {
+	return &Writer{encoder: json.NewEncoder(writer)}
+}
+
+// Write writes the memory on its own line.
+func (writer *Writer) Write(memory Memory) error {
+	if err := writer.encoder.Encode(&memory); err != nil {
+		return fmt.Errorf("failed to write memory: %w", err)
+	}
+
+	return nil
+}
+
+// Reader reads archived memories from JSON lines.
+type Reader struct {
+	decoder *json.Decoder
+}
+
+// NewReader creates a new Reader reading from the reader.
+func NewReader(reader io.Reader) *Reader {
+	return &Reader{decoder: json.NewDecoder(reader)}
+}
+
+// Read returns the next memory, or `io.EOF` once all the memories are read.
+func (reader *Reader) Read() (Memory, error) {
+	var memory Memory
+
+	if err := reader.decoder.Decode(&memory); err != nil {
+		if errors.Is(err, io.EOF) {
+			return memory, io.EOF
+		}
+
+		return memory, fmt.Errorf("failed to read memory: %w", err)
+	}
+
+	return memory, nil
+}
+
+// Export writes the memories of the namespace, or of every namespace for
+// `api.AllNamespaces`, to the writer and returns how many were written. The
+// vectors are included if vectors is set.
+func Export(
+	ctx context.Context,
+	memory api.Memory,
+	namespace string,
+	writer *Writer,
+	vectors bool,
+) (int, error) {
+	var (
+		count  int
+		cursor string
+	)
+
+	for {
+		page, err := memory.List(ctx, api.ListOptions{
+			Namespace: namespace,
+			Cursor:    cursor,
+			Vectors:   vectors,
+		})
+		if err != nil {
+			return count, fmt.Errorf("failed to list memories: %w", err)
+		}
+
+		for _, record := range page.Records {
+			if err := writer.Write(FromRecord(record)); err != nil {
+				return count, err
+			}
+
+			count++
+		}
+
+		if page.Next == "" {
+			return count, nil
+		}
+
+		cursor = page.Next
+	}
+}
+
+// ImportOptions configure how memories are imported.
+type ImportOptions struct {
+	// Namespace the memories are imported into. If empty, the memories keep
+	// the namespace they were exported from.
+	Namespace string
+
+	// Reembed discards the archived vectors so the memory plugin embeds the
+	// data with its current embedding plugin.
+	Reembed bool
+
+	// BatchSize is the number of memories memorized at once, defaults to
+	// `DefaultBatchSize`.
+	BatchSize int
+}
+
+// Import memorizes the memories read from the reader and returns how many
+// were imported.
+func Import(ctx context.Context, memory api.Memory, reader *Reader, options ImportOptions) (int, error) {
+	batchSize := options.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	var count int
+
+	batch := make([]api.Record, 0, batchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if _, err := memory.Memorize(ctx, batch); err != nil {
+			return fmt.Errorf("failed to memorize memories: %w", err)
+		}
+
+		count += len(batch)
+		batch = batch[:0]
+
+		return nil
+	}
+
+	for {
+		archived, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return count, err
+		}
+
+		record := archived.Record()
+
+		if options.Namespace != "" {
+			record.Namespace = options.Namespace
+		}
+
+		if options.Reembed {
+			record.Vector = nil
+			record.Model = ""
+		}
+
+		batch = append(batch, record)
+
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+
+	return count, flush()
+}
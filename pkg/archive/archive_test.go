@@ -0,0 +1,182 @@
+//
+
+package archive_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/lazygpt/lazygpt/pkg/archive"
+	"github.com/lazygpt/lazygpt/plugin/api"
+)
+
+// memory is an `api.Memory` keeping the records in a slice, listing pages of
+// two records.
+type memory struct {
+	api.Memory
+
+	records []api.Record
+	batches int
+}
+
+func (memory *memory) List(_ context.Context, options api.ListOptions) (*api.Page, error) {
+	page := &api.Page{}
+
+	start := 0
+	if options.Cursor != "" {
+		fmt.Sscanf(options.Cursor, "%d", &start)
+	}
+
+	for idx := start; idx < len(memory.records); idx++ {
+		record := memory.records[idx]
+		if options.Namespace != api.AllNamespaces && record.Namespace != options.Namespace {
+			continue
+		}
+
+		if len(page.Records) == 2 {
+			page.Next = fmt.Sprintf("%d", idx)
+
+			break
+		}
+
+		if !options.Vectors {
+			record.Vector = nil
+		}
+
+		page.Records = append(page.Records, record)
+	}
+
+	return page, nil
+}
+
+func (memory *memory) Memorize(_ context.Context, records []api.Record) ([]string, error) {
+	memory.batches++
+	memory.records = append(memory.records, records...)
+
+	return make([]string, len(records)), nil
+}
+
+func records() []api.Record {
+	created := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	return []api.Record{
+		{ID: "1", Data: "one", Namespace: "a", Created: created, Model: "m", Vector: []float32{1, 0}},
+		{ID: "2", Data: "two", Namespace: "b", Created: created, Model: "m", Vector: []float32{0, 1}},
+		{
+			ID: "3", Data: "three", Namespace: "a", Created: created, Model: "m", Vector: []float32{1, 1},
+			Metadata: map[string]string{"source": "chat"},
+		},
+		{
+			ID: "4", Data: "four", Namespace: "a", Model: "m", Vector: []float32{0, 0},
+			Importance: 0.5, Accessed: created, Expires: created.Add(time.Hour),
+		},
+	}
+}
+
+func TestExport(t *testing.T) {
+	t.Parallel()
+
+	source := &memory{records: records()}
+
+	var out bytes.Buffer
+
+	count, err := archive.Export(context.Background(), source, "a", archive.NewWriter(&out), false)
+	assert.NilError(t, err)
+	assert.Equal(t, count, 3)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Equal(t, len(lines), 3)
+	assert.Equal(
+		t,
+		lines[1],
+		`{"id":"3","namespace":"a","data":"three","created":"2023-05-01T12:00:00Z",`+
+			`"metadata":{"source":"chat"},"model":"m"}`,
+	)
+	assert.Equal(
+		t,
+		lines[2],
+		`{"id":"4","namespace":"a","data":"four","model":"m","importance":0.5,`+
+			`"accessed":"2023-05-01T12:00:00Z","expires":"2023-05-01T13:00:00Z"}`,
+	)
+
+	out.Reset()
+
+	count, err = archive.Export(context.Background(), source, api.AllNamespaces, archive.NewWriter(&out), true)
+	assert.NilError(t, err)
+	assert.Equal(t, count, 4)
+	assert.Assert(t, strings.Contains(out.String(), `"vector":[0,1]`))
+}
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	source := &memory{records: records()}
+
+	var out bytes.Buffer
+
+	_, err := archive.Export(context.Background(), source, api.AllNamespaces, archive.NewWriter(&out), true)
+	assert.NilError(t, err)
+
+	target := &memory{}
+
+	count, err := archive.Import(
+		context.Background(),
+		target,
+		archive.NewReader(&out),
+		archive.ImportOptions{BatchSize: 3},
+	)
+	assert.NilError(t, err)
+	assert.Equal(t, count, 4)
+	assert.Equal(t, target.batches, 2)
+
+	for idx, record := range records() {
+		record.ID = ""
+		assert.DeepEqual(t, target.records[idx], record)
+	}
+}
+
+func TestImportOptions(t *testing.T) {
+	t.Parallel()
+
+	input := `{"id":"1","namespace":"a","data":"one","model":"m","vector":[1,0]}
+{"data":"two"}
+`
+
+	target := &memory{}
+
+	count, err := archive.Import(
+		context.Background(),
+		target,
+		archive.NewReader(strings.NewReader(input)),
+		archive.ImportOptions{Namespace: "b", Reembed: true},
+	)
+	assert.NilError(t, err)
+	assert.Equal(t, count, 2)
+	assert.Equal(t, target.batches, 1)
+	assert.DeepEqual(t, target.records, []api.Record{
+		{Data: "one", Namespace: "b"},
+		{Data: "two", Namespace: "b"},
+	})
+}
+
+func TestImportInvalid(t *testing.T) {
+	t.Parallel()
+
+	target := &memory{}
+
+	count, err := archive.Import(
+		context.Background(),
+		target,
+		archive.NewReader(strings.NewReader("{\"data\":\"one\"}\nnot json\n")),
+		archive.ImportOptions{},
+	)
+	assert.ErrorContains(t, err, "failed to read memory")
+	assert.Equal(t, count, 0)
+	assert.Equal(t, len(target.records), 0)
+}
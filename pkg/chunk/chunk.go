@@ -0,0 +1,399 @@
+//
+
+// Package chunk splits long text into chunks of a bounded number of tokens,
+// cut at paragraph, sentence or line boundaries, so each chunk is embedded on
+// its own instead of averaging a whole document into a single vector.
+package chunk
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/lazygpt/lazygpt/pkg/tokens"
+	"github.com/lazygpt/lazygpt/plugin/api"
+)
+
+const (
+	// DefaultMaxTokens is the default maximum number of tokens of a chunk.
+	DefaultMaxTokens = 512
+
+	// DefaultOverlap is the default number of tokens a chunk repeats from
+	// the end of the previous chunk.
+	DefaultOverlap = 64
+
+	// documentIDBytes is the number of random bytes of a document id.
+	documentIDBytes = 16
+)
+
+// Format is the kind of text being split, it chooses the boundaries chunks
+// are cut at.
+type Format int
+
+const (
+	// Prose is cut at paragraphs, then sentences, then words.
+	Prose Format = iota
+
+	// Code is cut at blank lines, then lines, then words.
+	Code
+)
+
+// ErrInvalidSize is returned when the maximum tokens of a chunk is not
+// positive, or the overlap is not less than it.
+var ErrInvalidSize = errors.New("invalid chunk size")
+
+var (
+	paragraphs = regexp.MustCompile(`\n[ \t]*\n\s*`)
+	sentences  = regexp.MustCompile(`[.!?]+["')\]]*\s+|\n`)
+	lines      = regexp.MustCompile(`\n`)
+	words      = regexp.MustCompile(`\s+`)
+)
+
+// Chunk is a piece of a text.
+type Chunk struct {
+	// Text of the chunk, without its surrounding whitespace.
+	Text string
+
+	// Start and End are the byte offsets of the text of the chunk in the
+	// split text.
+	Start int
+	End   int
+
+	// StartLine and EndLine are the first and last lines of the chunk in
+	// the split text, from 1.
+	StartLine int
+	EndLine   int
+
+	// Tokens is the number of tokens of the chunk, counted by the pieces it
+	// was assembled from.
+	Tokens int
+}
+
+// Chunker splits text into chunks of at most `MaxTokens` tokens, each
+// repeating up to `Overlap` tokens from the end of the previous one so a
+// thought cut in two is still found whole in one of them.
+type Chunker struct {
+	Tokenizer tokens.Tokenizer
+	MaxTokens int
+	Overlap   int
+	Format    Format
+}
+
+// NewChunker creates a new Chunker of prose counting tokens with the
+// tokenizer.
+func NewChunker(tokenizer tokens.Tokenizer, maxTokens int, overlap int) *Chunker {
+	return &Chunker{
+		Tokenizer: tokenizer,
+		MaxTokens: maxTokens,
+		Overlap:   overlap,
+		Format:    Prose,
+	}
+}
+
+// segment is a piece of the text that is not cut further, chunks are
+// assembled from consecutive segments. The boundary is the level of the
+// boundary the segment ends at, the lower the better a place to end a chunk.
+type segment struct {
+	start    int
+	end      int
+	tokens   int
+	boundary int
+}
+
+// Split returns the chunks of the text in order. Text that fits in a single
+// chunk is returned as is, without its surrounding whitespace.
+func (chunker *Chunker) Split(ctx context.Context, text string) ([]Chunk, error) {
+	if chunker.MaxTokens <= 0 || chunker.Overlap < 0 || chunker.Overlap >= chunker.MaxTokens {
+		return nil, fmt.Errorf("%w: %d tokens overlapping %d", ErrInvalidSize, chunker.MaxTokens, chunker.Overlap)
+	}
+
+	segments, err := chunker.segments(ctx, text, 0, len(text), 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	newlines := make([]int, 0)
+
+	for idx := range text {
+		if text[idx] == '\n' {
+			newlines = append(newlines, idx)
+		}
+	}
+
+	chunks := make([]Chunk, 0)
+	current := make([]segment, 0)
+	count := 0
+
+	for _, next := range segments {
+		for count+next.tokens > chunker.MaxTokens && len(current) > 0 {
+			keep := chunker.keep(current)
+			kept := sum(current[:keep])
+			rest := current[keep:]
+
+			chunks = appendChunk(chunks, text, newlines, current[:keep], kept)
+
+			overlap := chunker.overlap(current[:keep], count-kept+next.tokens)
+			current = append(overlap, rest...)
+			count = sum(current)
+		}
+
+		current = append(current, next)
+		count += next.tokens
+	}
+
+	if len(current) > 0 {
+		chunks = appendChunk(chunks, text, newlines, current, count)
+	}
+
+	return chunks, nil
+}
+
+// boundaries returns the boundaries the format is cut at, coarsest first.
+func (chunker *Chunker) boundaries() []*regexp.Regexp {
+	if chunker.Format == Code {
+		return []*regexp.Regexp{paragraphs, lines, words}
+	}
+
+	return []*regexp.Regexp{paragraphs, sentences, words}
+}
+
+// segments cuts the text from start to end, ending at the boundary, at the
+// boundaries of the level and finer. Paragraphs are always cut into sentences,
+// or lines of code, so chunks can end between them, sentences only into words
+// when they do not fit in a chunk.
+func (chunker *Chunker) segments(
+	ctx context.Context,
+	text string,
+	start int,
+	end int,
+	level int,
+	boundary int,
+) ([]segment, error) {
+	boundaries := chunker.boundaries()
+
+	if level >= len(boundaries)-1 {
+		count, err := chunker.Tokenizer.Count(ctx, text[start:end])
+		if err != nil {
+			return nil, fmt.Errorf("failed to count tokens: %w", err)
+		}
+
+		if count <= chunker.MaxTokens {
+			return []segment{{start: start, end: end, tokens: count, boundary: boundary}}, nil
+		}
+
+		if level == len(boundaries) {
+			return chunker.cut(ctx, text, start, end, boundary)
+		}
+	}
+
+	segments := make([]segment, 0)
+	from := start
+
+	for _, match := range boundaries[level].FindAllStringIndex(text[start:end], -1) {
+		to := start + match[1]
+		if to == end {
+			break
+		}
+
+		pieces, err := chunker.segments(ctx, text, from, to, level+1, level)
+		if err != nil {
+			return nil, err
+		}
+
+		segments = append(segments, pieces...)
+		from = to
+	}
+
+	pieces, err := chunker.segments(ctx, text, from, end, level+1, boundary)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(segments, pieces...), nil
+}
+
+// cut cuts the text from start to end, which has no boundary left, into the
+// longest runs of characters of at most `MaxTokens` tokens. The last run ends
+// at the boundary.
+func (chunker *Chunker) cut(ctx context.Context, text string, start int, end int, boundary int) ([]segment, error) {
+	runes := make([]int, 0, end-start+1)
+	for offset := range text[start:end] {
+		runes = append(runes, start+offset)
+	}
+
+	runes = append(runes, end)
+	segments := make([]segment, 0)
+
+	for first := 0; first < len(runes)-1; {
+		var failed error
+
+		// NOTE(jkoelker) Count how many of the following rune boundaries
+		//                end a run within the limit, a segment holds at
+		//                least one rune whatever its tokens.
+		fits := sort.Search(len(runes)-first-1, func(idx int) bool {
+			if failed != nil {
+				return true
+			}
+
+			count, err := chunker.Tokenizer.Count(ctx, text[runes[first]:runes[first+idx+1]])
+			if err != nil {
+				failed = err
+			}
+
+			return count > chunker.MaxTokens
+		})
+		if failed != nil {
+			return nil, fmt.Errorf("failed to count tokens: %w", failed)
+		}
+
+		last := first + fits
+		if fits == 0 {
+			last = first + 1
+		}
+
+		count, err := chunker.Tokenizer.Count(ctx, text[runes[first]:runes[last]])
+		if err != nil {
+			return nil, fmt.Errorf("failed to count tokens: %w", err)
+		}
+
+		segments = append(segments, segment{
+			start:    runes[first],
+			end:      runes[last],
+			tokens:   count,
+			boundary: len(chunker.boundaries()),
+		})
+		first = last
+	}
+
+	segments[len(segments)-1].boundary = boundary
+
+	return segments, nil
+}
+
+// keep returns how many of the segments go in the chunk, ending it at the
+// best boundary among those leaving it at least half full.
+func (chunker *Chunker) keep(chunk []segment) int {
+	keep := len(chunk)
+	boundary := chunk[keep-1].boundary
+	count := sum(chunk)
+
+	for idx := len(chunk) - 1; idx > 0; idx-- {
+		count -= chunk[idx].tokens
+		if count*2 < chunker.MaxTokens {
+			break
+		}
+
+		if chunk[idx-1].boundary < boundary {
+			keep, boundary = idx, chunk[idx-1].boundary
+		}
+	}
+
+	return keep
+}
+
+// sum returns the tokens of the segments.
+func sum(segments []segment) int {
+	count := 0
+	for _, segment := range segments {
+		count += segment.tokens
+	}
+
+	return count
+}
+
+// overlap returns the segments at the end of the chunk repeated at the start
+// of the next chunk, at most `Overlap` tokens leaving room for the next tokens
+// of the chunk.
+func (chunker *Chunker) overlap(chunk []segment, next int) []segment {
+	count := 0
+	first := len(chunk)
+
+	for first > 0 {
+		tokens := chunk[first-1].tokens
+		if count+tokens > chunker.Overlap || count+tokens+next > chunker.MaxTokens {
+			break
+		}
+
+		count += tokens
+		first--
+	}
+
+	return append(make([]segment, 0, len(chunk)-first), chunk[first:]...)
+}
+
+// appendChunk appends the chunk of the segments to the chunks, unless it is
+// only whitespace.
+func appendChunk(chunks []Chunk, text string, newlines []int, segments []segment, count int) []Chunk {
+	start, end := segments[0].start, segments[len(segments)-1].end
+
+	for start < end {
+		char, size := utf8.DecodeRuneInString(text[start:end])
+		if !unicode.IsSpace(char) {
+			break
+		}
+
+		start += size
+	}
+
+	for end > start {
+		char, size := utf8.DecodeLastRuneInString(text[start:end])
+		if !unicode.IsSpace(char) {
+			break
+		}
+
+		end -= size
+	}
+
+	if start == end {
+		return chunks
+	}
+
+	return append(chunks, Chunk{
+		Text:      text[start:end],
+		Start:     start,
+		End:       end,
+		StartLine: sort.SearchInts(newlines, start) + 1,
+		EndLine:   sort.SearchInts(newlines, end-1) + 1,
+		Tokens:    count,
+	})
+}
+
+// NewDocumentID returns a new random document id.
+func NewDocumentID() (string, error) {
+	buf := make([]byte, documentIDBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate document id: %w", err)
+	}
+
+	return hex.EncodeToString(buf), nil
+}
+
+// Records returns the records memorizing the chunks of the document, each a
+// copy of the record with the text of its chunk and the metadata linking it
+// to the document and its place in it.
+func Records(document string, chunks []Chunk, record api.Record) []api.Record {
+	records := make([]api.Record, len(chunks))
+
+	for idx := range chunks {
+		metadata := make(map[string]string, len(record.Metadata)+2)
+		for key, value := range record.Metadata {
+			metadata[key] = value
+		}
+
+		metadata[api.MetadataDocument] = document
+		metadata[api.MetadataChunk] = strconv.Itoa(idx)
+
+		records[idx] = record
+		records[idx].Data = chunks[idx].Text
+		records[idx].Metadata = metadata
+	}
+
+	return records
+}
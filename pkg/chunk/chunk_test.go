@@ -0,0 +1,161 @@
+//
+
+package chunk_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/lazygpt/lazygpt/pkg/chunk"
+	"github.com/lazygpt/lazygpt/plugin/api"
+)
+
+// words is a `tokens.Tokenizer` counting a token per word, or per character
+// of words of `x`.
+type words struct{}
+
+func (words) Count(_ context.Context, text string) (int, error) {
+	count := 0
+
+	for _, word := range strings.Fields(text) {
+		if strings.Trim(word, "x") == "" {
+			count += len(word)
+		} else {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (words) Encode(context.Context, string) ([]int, error) {
+	return nil, nil
+}
+
+func (words) Decode(context.Context, []int) (string, error) {
+	return "", nil
+}
+
+func split(t *testing.T, chunker *chunk.Chunker, text string) []string {
+	t.Helper()
+
+	chunks, err := chunker.Split(context.Background(), text)
+	assert.NilError(t, err)
+
+	texts := make([]string, len(chunks))
+
+	for idx, chunk := range chunks {
+		assert.Assert(t, chunk.Tokens <= chunker.MaxTokens, chunk.Text)
+		assert.Equal(t, text[chunk.Start:chunk.End], chunk.Text)
+
+		texts[idx] = chunk.Text
+	}
+
+	return texts
+}
+
+func TestSplitShort(t *testing.T) {
+	t.Parallel()
+
+	chunker := chunk.NewChunker(words{}, 10, 2)
+
+	assert.DeepEqual(t, split(t, chunker, "  one short paragraph.\n\n"), []string{"one short paragraph."})
+	assert.DeepEqual(t, split(t, chunker, " \n\n "), []string{})
+}
+
+func TestSplitParagraphs(t *testing.T) {
+	t.Parallel()
+
+	chunker := chunk.NewChunker(words{}, 8, 0)
+
+	text := "One two three. Four five six.\n\nSeven eight. Nine ten eleven.\n\nTwelve."
+
+	assert.DeepEqual(t, split(t, chunker, text), []string{
+		"One two three. Four five six.",
+		"Seven eight. Nine ten eleven.\n\nTwelve.",
+	})
+}
+
+func TestSplitSentences(t *testing.T) {
+	t.Parallel()
+
+	chunker := chunk.NewChunker(words{}, 6, 3)
+
+	text := "One two three. Four five six. Seven eight nine."
+
+	assert.DeepEqual(t, split(t, chunker, text), []string{
+		"One two three. Four five six.",
+		"Four five six. Seven eight nine.",
+	})
+}
+
+func TestSplitWords(t *testing.T) {
+	t.Parallel()
+
+	chunker := chunk.NewChunker(words{}, 3, 0)
+
+	assert.DeepEqual(t, split(t, chunker, "one two three four five"), []string{
+		"one two three",
+		"four five",
+	})
+	assert.DeepEqual(t, split(t, chunker, "xxxxxxxx"), []string{"xxx", "xxx", "xx"})
+}
+
+func TestSplitCode(t *testing.T) {
+	t.Parallel()
+
+	chunker := chunk.NewChunker(words{}, 6, 0)
+	chunker.Format = chunk.Code
+
+	text := "func a() {\n\treturn 1\n}\n\nfunc b() {\n\treturn 2\n}\n"
+
+	chunks, err := chunker.Split(context.Background(), text)
+	assert.NilError(t, err)
+	assert.Equal(t, len(chunks), 2)
+	assert.Equal(t, chunks[0].Text, "func a() {\n\treturn 1\n}")
+	assert.Equal(t, chunks[0].StartLine, 1)
+	assert.Equal(t, chunks[0].EndLine, 3)
+	assert.Equal(t, chunks[1].Text, "func b() {\n\treturn 2\n}")
+	assert.Equal(t, chunks[1].StartLine, 5)
+	assert.Equal(t, chunks[1].EndLine, 7)
+}
+
+func TestSplitInvalidSize(t *testing.T) {
+	t.Parallel()
+
+	for _, chunker := range []*chunk.Chunker{
+		chunk.NewChunker(words{}, 0, 0),
+		chunk.NewChunker(words{}, 4, 4),
+		chunk.NewChunker(words{}, 4, -1),
+	} {
+		_, err := chunker.Split(context.Background(), "text")
+		assert.ErrorIs(t, err, chunk.ErrInvalidSize)
+	}
+}
+
+func TestRecords(t *testing.T) {
+	t.Parallel()
+
+	records := chunk.Records(
+		"doc",
+		[]chunk.Chunk{{Text: "one"}, {Text: "two"}},
+		api.Record{Namespace: "work", Metadata: map[string]string{api.MetadataSource: "test"}},
+	)
+
+	assert.Equal(t, len(records), 2)
+	assert.Equal(t, records[1].Data, "two")
+	assert.Equal(t, records[1].Namespace, "work")
+	assert.DeepEqual(t, records[1].Metadata, map[string]string{
+		api.MetadataSource:   "test",
+		api.MetadataDocument: "doc",
+		api.MetadataChunk:    "1",
+	})
+
+	document, index, ok := records[1].Chunk()
+	assert.Assert(t, ok)
+	assert.Equal(t, document, "doc")
+	assert.Equal(t, index, 1)
+}
@@ -0,0 +1,435 @@
+//
+
+package context
+
+import (
+	stdcontext "context"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/lazygpt/lazygpt/pkg/models"
+	"github.com/lazygpt/lazygpt/pkg/tokens"
+	"github.com/lazygpt/lazygpt/plugin/api"
+)
+
+// truncateAttempts is the number of times truncating a message is retried
+// when re-tokenizing the truncated text does not fit.
+const truncateAttempts = 3
+
+// Budgeter packs sections of messages into a token budget by priority.
+type Budgeter struct {
+	// Budget is the number of tokens the packed messages may use.
+	Budget int
+
+	model     models.Model
+	tokenizer []api.Tokenizer
+	sections  []Section
+}
+
+// NewBudgeter creates a new Budgeter for the model with the given budget. The
+// optional tokenizer is used to count tokens for the model.
+func NewBudgeter(model models.Model, budget int, tokenizer ...api.Tokenizer) *Budgeter {
+	return &Budgeter{
+		Budget: budget,
+
+		model:     model,
+		tokenizer: tokenizer,
+	}
+}
+
+// Add registers a section. Sections are packed in the order they are added.
+func (budgeter *Budgeter) Add(sections ...Section) {
+	budgeter.sections = append(budgeter.sections, sections...)
+}
+
+// packing is the state of a section while it is being packed.
+type packing struct {
+	section *Section
+	costs   []int
+	needed  int
+	min     int
+	max     int
+	budget  int
+	report  SectionReport
+	content []string
+}
+
+// Pack returns the messages of all sections trimmed to fit the budget and a
+// report of the tokens used by each section.
+func (budgeter *Budgeter) Pack(ctx stdcontext.Context) ([]api.Message, *Report, error) {
+	counter, err := tokens.NewModelCounter(budgeter.model, budgeter.tokenizer...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create counter: %w", err)
+	}
+
+	tokenizer, err := tokens.NewTokenizer(budgeter.model, budgeter.tokenizer...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create tokenizer: %w", err)
+	}
+
+	available := budgeter.Budget - tokens.PrimedTokens
+	packs := make([]*packing, len(budgeter.sections))
+
+	for idx := range budgeter.sections {
+		pack, err := measure(ctx, counter, &budgeter.sections[idx], budgeter.Budget)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		packs[idx] = pack
+	}
+
+	allocate(packs, available)
+
+	for _, pack := range packs {
+		if err := pack.trim(ctx, counter, tokenizer); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// NOTE(jkoelker) Sections rarely use their whole allocation exactly, give
+	//                what is left to trimmed sections by priority.
+	if err := redistribute(ctx, packs, available, counter, tokenizer); err != nil {
+		return nil, nil, err
+	}
+
+	report := &Report{
+		Budget:   budgeter.Budget,
+		Tokens:   tokens.PrimedTokens,
+		Sections: make([]SectionReport, len(packs)),
+	}
+
+	var messages []api.Message
+
+	for idx, pack := range packs {
+		for _, kept := range pack.report.Kept {
+			message := pack.section.Messages[kept]
+			message.Content = pack.content[kept]
+			messages = append(messages, message)
+		}
+
+		report.Tokens += pack.report.Tokens
+		report.Sections[idx] = pack.report
+	}
+
+	return messages, report, nil
+}
+
+// cost returns the number of tokens the message adds to the context.
+func cost(ctx stdcontext.Context, counter *tokens.Counter, message api.Message) (int, error) {
+	before := counter.Tokens
+
+	if err := counter.AddContext(ctx, message); err != nil {
+		return 0, fmt.Errorf("failed to count message: %w", err)
+	}
+
+	used := counter.Tokens - before
+	counter.Tokens = before
+
+	return used, nil
+}
+
+// share returns the fraction of the budget in tokens.
+func share(fraction float64, budget int) int {
+	return int(math.Floor(fraction * float64(budget)))
+}
+
+// measure returns the packing state of the section.
+func measure(
+	ctx stdcontext.Context,
+	counter *tokens.Counter,
+	section *Section,
+	budget int,
+) (*packing, error) {
+	pack := &packing{
+		section: section,
+		costs:   make([]int, len(section.Messages)),
+		content: make([]string, len(section.Messages)),
+		report: SectionReport{
+			Name: section.Name,
+		},
+	}
+
+	for idx, message := range section.Messages {
+		used, err := cost(ctx, counter, message)
+		if err != nil {
+			return nil, fmt.Errorf("failed to measure section %q: %w", section.Name, err)
+		}
+
+		pack.costs[idx] = used
+		pack.content[idx] = message.Content
+		pack.needed += used
+	}
+
+	pack.max = budget
+	if section.MaxShare > 0 {
+		pack.max = share(section.MaxShare, budget)
+	}
+
+	pack.max = minInt(pack.max, pack.needed)
+	pack.min = minInt(share(section.MinShare, budget), pack.max)
+	pack.report.Needed = pack.needed
+
+	return pack, nil
+}
+
+// byPriority returns the packs ordered by descending priority, keeping the
+// registration order for equal priorities.
+func byPriority(packs []*packing) []*packing {
+	ordered := make([]*packing, len(packs))
+	copy(ordered, packs)
+
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].section.Priority > ordered[j].section.Priority
+	})
+
+	return ordered
+}
+
+// allocate sets the budget of each pack. Minimum shares are reserved first,
+// if they do not fit the lowest priority sections give theirs up. The rest of
+// the budget is given by priority up to the maximum share of each section.
+func allocate(packs []*packing, available int) {
+	ordered := byPriority(packs)
+	remaining := available
+
+	for _, pack := range ordered {
+		pack.budget = pack.min
+		remaining -= pack.min
+	}
+
+	for idx := len(ordered) - 1; idx >= 0 && remaining < 0; idx-- {
+		reclaim := minInt(ordered[idx].budget, -remaining)
+		ordered[idx].budget -= reclaim
+		remaining += reclaim
+	}
+
+	for _, pack := range ordered {
+		if remaining <= 0 {
+			break
+		}
+
+		grant := minInt(pack.max-pack.budget, remaining)
+		if grant > 0 {
+			pack.budget += grant
+			remaining -= grant
+		}
+	}
+}
+
+// redistribute gives the tokens left after trimming to the sections that
+// were trimmed, by priority.
+func redistribute(
+	ctx stdcontext.Context,
+	packs []*packing,
+	available int,
+	counter *tokens.Counter,
+	tokenizer tokens.Tokenizer,
+) error {
+	used := 0
+	for _, pack := range packs {
+		used += pack.report.Tokens
+	}
+
+	for _, pack := range byPriority(packs) {
+		slack := available - used
+		if slack <= 0 {
+			break
+		}
+
+		if len(pack.report.Dropped) == 0 && len(pack.report.Truncated) == 0 {
+			continue
+		}
+
+		grant := minInt(pack.max-pack.budget, slack)
+		if grant <= 0 {
+			continue
+		}
+
+		before := pack.report.Tokens
+		pack.budget += grant
+
+		if err := pack.trim(ctx, counter, tokenizer); err != nil {
+			return err
+		}
+
+		used += pack.report.Tokens - before
+	}
+
+	return nil
+}
+
+// trim selects the messages of the section that fit its budget using the
+// strategy of the section.
+func (pack *packing) trim(
+	ctx stdcontext.Context,
+	counter *tokens.Counter,
+	tokenizer tokens.Tokenizer,
+) error {
+	pack.report.Budget = pack.budget
+	pack.report.Tokens = 0
+	pack.report.Kept = nil
+	pack.report.Dropped = nil
+	pack.report.Truncated = nil
+
+	for idx := range pack.section.Messages {
+		pack.content[idx] = pack.section.Messages[idx].Content
+	}
+
+	var keep []bool
+
+	switch pack.section.Strategy {
+	case DropOldest:
+		keep = pack.dropOldest()
+	case DropLowestScore:
+		keep = pack.dropLowestScore()
+	case TruncateText:
+		var err error
+
+		keep, err = pack.truncateText(ctx, counter, tokenizer)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: %d", ErrUnknownStrategy, pack.section.Strategy)
+	}
+
+	for idx, kept := range keep {
+		if kept {
+			pack.report.Kept = append(pack.report.Kept, idx)
+		} else {
+			pack.report.Dropped = append(pack.report.Dropped, idx)
+		}
+	}
+
+	return nil
+}
+
+// dropOldest keeps the most recent messages that fit.
+func (pack *packing) dropOldest() []bool {
+	keep := make([]bool, len(pack.costs))
+
+	for idx := len(pack.costs) - 1; idx >= 0; idx-- {
+		if pack.report.Tokens+pack.costs[idx] > pack.budget {
+			break
+		}
+
+		pack.report.Tokens += pack.costs[idx]
+		keep[idx] = true
+	}
+
+	return keep
+}
+
+// dropLowestScore keeps the highest scored messages that fit.
+func (pack *packing) dropLowestScore() []bool {
+	keep := make([]bool, len(pack.costs))
+	order := make([]int, len(pack.costs))
+
+	for idx := range order {
+		order[idx] = idx
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return pack.section.score(order[i]) > pack.section.score(order[j])
+	})
+
+	for _, idx := range order {
+		if pack.report.Tokens+pack.costs[idx] > pack.budget {
+			continue
+		}
+
+		pack.report.Tokens += pack.costs[idx]
+		keep[idx] = true
+	}
+
+	return keep
+}
+
+// truncateText keeps the messages in order, truncating the first message
+// that does not fit.
+func (pack *packing) truncateText(
+	ctx stdcontext.Context,
+	counter *tokens.Counter,
+	tokenizer tokens.Tokenizer,
+) ([]bool, error) {
+	keep := make([]bool, len(pack.costs))
+
+	for idx := range pack.costs {
+		if pack.report.Tokens+pack.costs[idx] <= pack.budget {
+			pack.report.Tokens += pack.costs[idx]
+			keep[idx] = true
+
+			continue
+		}
+
+		used, err := pack.truncate(ctx, counter, tokenizer, idx, pack.budget-pack.report.Tokens)
+		if err != nil {
+			return nil, err
+		}
+
+		if used > 0 {
+			pack.report.Tokens += used
+			pack.report.Truncated = append(pack.report.Truncated, idx)
+			keep[idx] = true
+		}
+
+		break
+	}
+
+	return keep, nil
+}
+
+// truncate cuts the text of the message so the message fits in available
+// tokens. It returns the tokens used by the truncated message, or zero if
+// nothing of the message fits.
+func (pack *packing) truncate(
+	ctx stdcontext.Context,
+	counter *tokens.Counter,
+	tokenizer tokens.Tokenizer,
+	idx int,
+	available int,
+) (int, error) {
+	message := pack.section.Messages[idx]
+	message.Content = ""
+
+	overhead, err := cost(ctx, counter, message)
+	if err != nil {
+		return 0, err
+	}
+
+	limit := available - overhead
+
+	for attempt := 0; attempt < truncateAttempts && limit > 0; attempt++ {
+		text, err := tokens.Truncate(ctx, tokenizer, pack.section.Messages[idx].Content, limit)
+		if err != nil {
+			return 0, fmt.Errorf("failed to truncate section %q: %w", pack.section.Name, err)
+		}
+
+		message.Content = text
+
+		used, err := cost(ctx, counter, message)
+		if err != nil {
+			return 0, err
+		}
+
+		if used <= available {
+			pack.content[idx] = text
+
+			return used, nil
+		}
+
+		limit -= used - available
+	}
+
+	return 0, nil
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
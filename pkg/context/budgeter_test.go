@@ -0,0 +1,176 @@
+//
+
+package context_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	aicontext "github.com/lazygpt/lazygpt/pkg/context"
+	"github.com/lazygpt/lazygpt/pkg/models"
+	"github.com/lazygpt/lazygpt/plugin/api"
+)
+
+// wordTokenizer is an `api.Tokenizer` with a token per word.
+type wordTokenizer struct{}
+
+func (wordTokenizer) Count(_ context.Context, _ string, text string) (int, error) {
+	return len(strings.Fields(text)), nil
+}
+
+func (wordTokenizer) Encode(_ context.Context, _ string, text string) ([]int, error) {
+	return make([]int, len(strings.Fields(text))), nil
+}
+
+func (wordTokenizer) Decode(_ context.Context, _ string, tokens []int) (string, error) {
+	return strings.TrimSpace(strings.Repeat("word ", len(tokens))), nil
+}
+
+// model has no per message tokens, with the word tokenizer a message costs
+// one token for the role plus its words.
+var model = models.Model{
+	Name:          "words",
+	ContextWindow: 1000,
+}
+
+func words(count int) string {
+	return strings.TrimSpace(strings.Repeat("word ", count))
+}
+
+func message(role string, count int) api.Message {
+	return api.Message{Role: role, Content: words(count)}
+}
+
+func TestBudgeterFits(t *testing.T) {
+	t.Parallel()
+
+	budgeter := aicontext.NewBudgeter(model, 100, wordTokenizer{})
+	budgeter.Add(
+		aicontext.Section{
+			Name:     aicontext.SectionSystem,
+			Priority: 100,
+			Strategy: aicontext.TruncateText,
+			Messages: []api.Message{message("system", 9)},
+		},
+		aicontext.Section{
+			Name:     aicontext.SectionHistory,
+			Priority: 50,
+			Strategy: aicontext.DropOldest,
+			Messages: []api.Message{message("user", 9), message("assistant", 9)},
+		},
+	)
+
+	messages, report, err := budgeter.Pack(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, len(messages), 3)
+	assert.Equal(t, report.Tokens, 3+30)
+	assert.Equal(t, report.Section(aicontext.SectionHistory).Tokens, 20)
+	assert.Assert(t, report.Section("missing") == nil)
+}
+
+func TestBudgeterDropOldest(t *testing.T) {
+	t.Parallel()
+
+	budgeter := aicontext.NewBudgeter(model, 33, wordTokenizer{})
+	budgeter.Add(aicontext.Section{
+		Name:     aicontext.SectionHistory,
+		Strategy: aicontext.DropOldest,
+		Messages: []api.Message{
+			message("user", 9),
+			message("assistant", 9),
+			message("user", 9),
+			message("assistant", 9),
+		},
+	})
+
+	messages, report, err := budgeter.Pack(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, len(messages), 3)
+	assert.DeepEqual(t, report.Section(aicontext.SectionHistory).Dropped, []int{0})
+	assert.DeepEqual(t, report.Section(aicontext.SectionHistory).Kept, []int{1, 2, 3})
+}
+
+func TestBudgeterDropLowestScore(t *testing.T) {
+	t.Parallel()
+
+	budgeter := aicontext.NewBudgeter(model, 23, wordTokenizer{})
+	budgeter.Add(aicontext.Section{
+		Name:     aicontext.SectionMemories,
+		Strategy: aicontext.DropLowestScore,
+		Messages: []api.Message{
+			{Role: "system", Content: "a " + words(8)},
+			{Role: "system", Content: "b " + words(8)},
+			{Role: "system", Content: "c " + words(8)},
+		},
+		Scores: []float64{0.5, 0.1, 0.9},
+	})
+
+	messages, _, err := budgeter.Pack(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, len(messages), 2)
+	assert.Assert(t, strings.HasPrefix(messages[0].Content, "a "))
+	assert.Assert(t, strings.HasPrefix(messages[1].Content, "c "))
+}
+
+func TestBudgeterTruncateText(t *testing.T) {
+	t.Parallel()
+
+	budgeter := aicontext.NewBudgeter(model, 14, wordTokenizer{})
+	budgeter.Add(aicontext.Section{
+		Name:     aicontext.SectionTools,
+		Strategy: aicontext.TruncateText,
+		Messages: []api.Message{message("system", 50), message("system", 5)},
+	})
+
+	messages, report, err := budgeter.Pack(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, len(messages), 1)
+	assert.Equal(t, messages[0].Content, words(10))
+	assert.DeepEqual(t, report.Section(aicontext.SectionTools).Truncated, []int{0})
+	assert.DeepEqual(t, report.Section(aicontext.SectionTools).Dropped, []int{1})
+}
+
+func TestBudgeterPriorityAndShares(t *testing.T) {
+	t.Parallel()
+
+	budgeter := aicontext.NewBudgeter(model, 103, wordTokenizer{})
+	budgeter.Add(
+		aicontext.Section{
+			Name:     aicontext.SectionMemories,
+			Priority: 10,
+			MinShare: 0.2,
+			Strategy: aicontext.DropLowestScore,
+			Messages: []api.Message{
+				message("system", 19),
+				message("system", 19),
+				message("system", 19),
+			},
+		},
+		aicontext.Section{
+			Name:     aicontext.SectionHistory,
+			Priority: 50,
+			MaxShare: 0.5,
+			Strategy: aicontext.DropOldest,
+			Messages: []api.Message{
+				message("user", 24),
+				message("assistant", 24),
+				message("user", 24),
+			},
+		},
+	)
+
+	_, report, err := budgeter.Pack(context.Background())
+	assert.NilError(t, err)
+
+	history := report.Section(aicontext.SectionHistory)
+	memories := report.Section(aicontext.SectionMemories)
+
+	// NOTE(jkoelker) History is capped at half the budget, so only two of
+	//                its messages fit, and the memories get the rest.
+	assert.Equal(t, history.Tokens, 50)
+	assert.Equal(t, memories.Tokens, 40)
+	assert.Assert(t, report.Tokens <= 103)
+}
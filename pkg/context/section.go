@@ -0,0 +1,142 @@
+//
+
+package context
+
+import (
+	"errors"
+
+	"github.com/lazygpt/lazygpt/plugin/api"
+)
+
+// ErrUnknownStrategy is returned when a section has an unknown trimming
+// strategy.
+var ErrUnknownStrategy = errors.New("unknown strategy")
+
+// Names of the sections LazyGPT packs into the context, in the order they are
+// usually registered.
+const (
+	SectionSystem   = "system"
+	SectionTime     = "time"
+	SectionPinned   = "pinned"
+	SectionMemories = "memories"
+	SectionSummary  = "summary"
+	SectionPlan     = "plan"
+	SectionHistory  = "history"
+	SectionTools    = "tools"
+)
+
+// Strategy is how a section is trimmed when it does not fit its share of the
+// budget.
+type Strategy int
+
+const (
+	// DropOldest drops messages from the start of the section, keeping the
+	// most recent messages.
+	DropOldest Strategy = iota
+
+	// DropLowestScore drops the messages with the lowest score first.
+	DropLowestScore
+
+	// TruncateText keeps messages in order and truncates the text of the
+	// first message that does not fit, dropping the ones after it.
+	TruncateText
+)
+
+// String returns the name of the strategy.
+func (strategy Strategy) String() string {
+	switch strategy {
+	case DropOldest:
+		return "drop-oldest"
+	case DropLowestScore:
+		return "drop-lowest-score"
+	case TruncateText:
+		return "truncate-text"
+	default:
+		return "unknown"
+	}
+}
+
+// Section is a group of messages packed into the context together.
+type Section struct {
+	// Name of the section used in the report.
+	Name string
+
+	// Priority of the section, sections with a higher priority are given
+	// their share of the budget first.
+	Priority int
+
+	// MinShare is the fraction of the budget reserved for the section, if it
+	// needs it.
+	MinShare float64
+
+	// MaxShare is the largest fraction of the budget the section can use. A
+	// zero value means the section may use the whole budget.
+	MaxShare float64
+
+	// Strategy used to trim the section to its share.
+	Strategy Strategy
+
+	// Messages of the section in the order they are sent.
+	Messages []api.Message
+
+	// Scores of the messages, used by `DropLowestScore`. Messages without a
+	// score are scored zero.
+	Scores []float64
+}
+
+// score returns the score of the message at the index.
+func (section *Section) score(idx int) float64 {
+	if idx < len(section.Scores) {
+		return section.Scores[idx]
+	}
+
+	return 0
+}
+
+// SectionReport is the outcome of packing a section.
+type SectionReport struct {
+	// Name of the section.
+	Name string
+
+	// Budget is the number of tokens the section was allocated.
+	Budget int
+
+	// Tokens is the number of tokens the section used.
+	Tokens int
+
+	// Needed is the number of tokens the section needed to fit untrimmed.
+	Needed int
+
+	// Kept are the indexes of the messages sent.
+	Kept []int
+
+	// Dropped are the indexes of the messages not sent.
+	Dropped []int
+
+	// Truncated are the indexes of the messages sent with truncated text.
+	Truncated []int
+}
+
+// Report is the outcome of packing all the sections.
+type Report struct {
+	// Budget is the number of tokens available.
+	Budget int
+
+	// Tokens is the number of tokens used, including the priming tokens.
+	Tokens int
+
+	// Sections in the order they were registered.
+	Sections []SectionReport
+}
+
+// Section returns the report of the named section, or `nil` if there is no
+// such section.
+func (report *Report) Section(name string) *SectionReport {
+	for idx := range report.Sections {
+		if report.Sections[idx].Name == name {
+			return &report.Sections[idx]
+		}
+	}
+
+	return nil
+}
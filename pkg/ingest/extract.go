@@ -0,0 +1,273 @@
+//
+
+package ingest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/lazygpt/lazygpt/pkg/chunk"
+)
+
+// binarySniffLength is how many bytes of a file are looked at for a NUL byte
+// to tell binary files apart from text.
+const binarySniffLength = 8000
+
+// Kind is a kind of file that is ingested.
+type Kind struct {
+	// Name of the kind.
+	Name string
+
+	// Format the text of the file is chunked as.
+	Format chunk.Format
+
+	// Lines is set if the lines of the text are the lines of the file, so
+	// chunks are memorized with their line range.
+	Lines bool
+
+	// Extract returns the text of the file.
+	Extract func(data []byte) (string, error)
+}
+
+var (
+	markdown  = Kind{Name: "markdown", Format: chunk.Prose, Lines: true, Extract: extractText}
+	plainText = Kind{Name: "text", Format: chunk.Prose, Lines: true, Extract: extractText}
+	code      = Kind{Name: "code", Format: chunk.Code, Lines: true, Extract: extractText}
+	hypertext = Kind{Name: "html", Format: chunk.Prose, Lines: false, Extract: extractHTML}
+
+	// kinds are the kinds of files by their extension.
+	kinds = map[string]Kind{
+		".md":       markdown,
+		".markdown": markdown,
+		".mdx":      markdown,
+		".txt":      plainText,
+		".text":     plainText,
+		".rst":      plainText,
+		".adoc":     plainText,
+		".html":     hypertext,
+		".htm":      hypertext,
+		".xhtml":    hypertext,
+		".go":       code,
+		".py":       code,
+		".js":       code,
+		".jsx":      code,
+		".ts":       code,
+		".tsx":      code,
+		".java":     code,
+		".kt":       code,
+		".scala":    code,
+		".c":        code,
+		".h":        code,
+		".cc":       code,
+		".cpp":      code,
+		".hpp":      code,
+		".cs":       code,
+		".rs":       code,
+		".rb":       code,
+		".php":      code,
+		".swift":    code,
+		".lua":      code,
+		".sh":       code,
+		".bash":     code,
+		".sql":      code,
+		".proto":    code,
+		".tf":       code,
+		".yaml":     code,
+		".yml":      code,
+		".toml":     code,
+		".json":     code,
+	}
+
+	// names are the kinds of files without an extension by their name.
+	names = map[string]Kind{
+		"README":     plainText,
+		"LICENSE":    plainText,
+		"Makefile":   code,
+		"Dockerfile": code,
+	}
+)
+
+// ErrBinary is returned when extracting the text of a file that is not text.
+var ErrBinary = errors.New("binary file")
+
+// LookupKind returns the kind of the file at the path, false if files like it
+// are not ingested.
+func LookupKind(path string) (Kind, bool) {
+	if kind, ok := kinds[strings.ToLower(filepath.Ext(path))]; ok {
+		return kind, true
+	}
+
+	kind, ok := names[filepath.Base(path)]
+
+	return kind, ok
+}
+
+// Extract returns the text of the file of the kind.
+func Extract(kind Kind, data []byte) (string, error) {
+	sniff := data
+	if len(sniff) > binarySniffLength {
+		sniff = sniff[:binarySniffLength]
+	}
+
+	if bytes.IndexByte(sniff, 0) >= 0 || !utf8.Valid(data) {
+		return "", ErrBinary
+	}
+
+	return kind.Extract(data)
+}
+
+// extractText returns the text of a text file, with Windows line endings
+// replaced so line numbers match the file.
+func extractText(data []byte) (string, error) {
+	return strings.ReplaceAll(string(data), "\r\n", "\n"), nil
+}
+
+var (
+	// htmlSpaces are runs of whitespace HTML renders as a single space.
+	htmlSpaces = regexp.MustCompile(`[ \t\r\n\f]+`)
+
+	// htmlBlankLines are runs of blank lines left between blocks.
+	htmlBlankLines = regexp.MustCompile(`\n{3,}`)
+
+	// htmlSkipped are the elements whose text is not rendered.
+	htmlSkipped = map[atom.Atom]bool{
+		atom.Script:   true,
+		atom.Style:    true,
+		atom.Noscript: true,
+		atom.Template: true,
+		atom.Svg:      true,
+	}
+
+	// htmlBlocks are the elements rendered as paragraphs of their own.
+	htmlBlocks = map[atom.Atom]bool{
+		atom.Address:    true,
+		atom.Article:    true,
+		atom.Aside:      true,
+		atom.Blockquote: true,
+		atom.Dd:         true,
+		atom.Div:        true,
+		atom.Dl:         true,
+		atom.Dt:         true,
+		atom.Figcaption: true,
+		atom.Figure:     true,
+		atom.Footer:     true,
+		atom.H1:         true,
+		atom.H2:         true,
+		atom.H3:         true,
+		atom.H4:         true,
+		atom.H5:         true,
+		atom.H6:         true,
+		atom.Header:     true,
+		atom.Hr:         true,
+		atom.Li:         true,
+		atom.Main:       true,
+		atom.Nav:        true,
+		atom.Ol:         true,
+		atom.P:          true,
+		atom.Pre:        true,
+		atom.Section:    true,
+		atom.Table:      true,
+		atom.Title:      true,
+		atom.Tr:         true,
+		atom.Ul:         true,
+	}
+)
+
+// extractHTML returns the text of an HTML document, without its markup,
+// scripts and styles. Blocks are separated by blank lines so they are chunked
+// as paragraphs, whitespace is kept as is only in preformatted text.
+func extractHTML(data []byte) (string, error) {
+	tokenizer := html.NewTokenizer(bytes.NewReader(data))
+
+	var (
+		builder   strings.Builder
+		skipped   int
+		preformed int
+	)
+
+	for {
+		tokenType := tokenizer.Next()
+
+		switch tokenType { //nolint:exhaustive // comments and doctypes have no text
+		case html.ErrorToken:
+			if err := tokenizer.Err(); !errors.Is(err, io.EOF) {
+				return "", fmt.Errorf("failed to parse html: %w", err)
+			}
+
+			return cleanHTML(builder.String()), nil
+
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			name, _ := tokenizer.TagName()
+			tag := atom.Lookup(name)
+
+			if htmlSkipped[tag] {
+				skipped = depth(skipped, tokenType)
+			}
+
+			if tag == atom.Pre {
+				preformed = depth(preformed, tokenType)
+			}
+
+			switch {
+			case htmlBlocks[tag]:
+				builder.WriteString("\n\n")
+			case tag == atom.Br:
+				builder.WriteString("\n")
+			case tag == atom.Td || tag == atom.Th:
+				builder.WriteString(" ")
+			}
+
+		case html.TextToken:
+			if skipped > 0 {
+				continue
+			}
+
+			text := string(tokenizer.Text())
+			if preformed == 0 {
+				text = htmlSpaces.ReplaceAllString(text, " ")
+
+				if builder.Len() == 0 || strings.HasSuffix(builder.String(), "\n") {
+					text = strings.TrimLeft(text, " ")
+				}
+			}
+
+			builder.WriteString(text)
+		}
+	}
+}
+
+// cleanHTML trims the spaces ending the lines of the text of an HTML
+// document and keeps at most one blank line between them.
+func cleanHTML(text string) string {
+	lines := strings.Split(text, "\n")
+	for idx := range lines {
+		lines[idx] = strings.TrimRight(lines[idx], " \t")
+		if strings.TrimSpace(lines[idx]) == "" {
+			lines[idx] = ""
+		}
+	}
+
+	return strings.TrimSpace(htmlBlankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+// depth returns the depth of the nested elements of a tag after the token of
+// the tag.
+func depth(current int, tokenType html.TokenType) int {
+	switch {
+	case tokenType == html.StartTagToken:
+		return current + 1
+	case tokenType == html.EndTagToken && current > 0:
+		return current - 1
+	default:
+		return current
+	}
+}
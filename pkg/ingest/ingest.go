@@ -0,0 +1,430 @@
+//
+
+// Package ingest memorizes the text of files, chunked and tagged with the
+// file and lines each chunk comes from, so documents and code are recalled
+// like any other memory. The hash of each file is memorized with its chunks
+// so files that did not change are not ingested again.
+package ingest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/lazygpt/lazygpt/pkg/chunk"
+	"github.com/lazygpt/lazygpt/pkg/tokens"
+	"github.com/lazygpt/lazygpt/plugin/api"
+	"github.com/lazygpt/lazygpt/plugin/log"
+)
+
+const (
+	// Source is the source metadata of ingested memories.
+	Source = "ingest"
+
+	// MetadataPath is the metadata key of the absolute path of the file a
+	// memory was ingested from.
+	MetadataPath = "path"
+
+	// MetadataLines is the metadata key of the lines of the file a memory
+	// was ingested from, as `first-last`.
+	MetadataLines = "lines"
+
+	// MetadataHash is the metadata key of the SHA-256 hash of the file a
+	// memory was ingested from.
+	MetadataHash = "hash"
+
+	// DefaultMaxFileSize is the size in bytes of the largest file ingested
+	// by default.
+	DefaultMaxFileSize = 1 << 20
+)
+
+// DefaultExclude are the patterns of the files and directories not ingested
+// by default, hidden ones and installed dependencies.
+func DefaultExclude() []string {
+	return []string{".*", "node_modules"}
+}
+
+// Report counts what an ingestion did.
+type Report struct {
+	// Ingested is the number of new or changed files memorized.
+	Ingested int
+
+	// Unchanged is the number of files already memorized as they are.
+	Unchanged int
+
+	// Skipped is the number of files too large or not text.
+	Skipped int
+
+	// Removed is the number of files forgotten because they are gone, or
+	// no longer included.
+	Removed int
+
+	// Chunks is the number of memories memorized.
+	Chunks int
+}
+
+// Add adds the counts of the other report to the report.
+func (report *Report) Add(other Report) {
+	report.Ingested += other.Ingested
+	report.Unchanged += other.Unchanged
+	report.Skipped += other.Skipped
+	report.Removed += other.Removed
+	report.Chunks += other.Chunks
+}
+
+// Ingester memorizes the files of directories in a namespace.
+type Ingester struct {
+	Memory    api.Memory
+	Tokenizer tokens.Tokenizer
+	Namespace string
+
+	// Include are the patterns of the files ingested, every file of a known
+	// kind if empty. Exclude are the patterns of the files and directories
+	// not ingested, whether they are included or not. See `Match`.
+	Include []string
+	Exclude []string
+
+	// MaxTokens and Overlap size the chunks, see `chunk.Chunker`.
+	MaxTokens int
+	Overlap   int
+
+	// MaxFileSize is the size in bytes of the largest file ingested.
+	MaxFileSize int64
+}
+
+// NewIngester creates a new Ingester memorizing in the namespace, with the
+// default exclusions and chunk sizes.
+func NewIngester(memory api.Memory, tokenizer tokens.Tokenizer, namespace string) *Ingester {
+	return &Ingester{
+		Memory:      memory,
+		Tokenizer:   tokenizer,
+		Namespace:   api.Namespace(namespace),
+		Exclude:     DefaultExclude(),
+		MaxTokens:   chunk.DefaultMaxTokens,
+		Overlap:     chunk.DefaultOverlap,
+		MaxFileSize: DefaultMaxFileSize,
+	}
+}
+
+// file is a memorized file.
+type file struct {
+	// hash of the file, empty if its memories disagree.
+	hash string
+
+	// ids of the memories of the file.
+	ids []string
+}
+
+// ingestion is the state of an ingestion of a root.
+type ingestion struct {
+	*Ingester
+
+	root   string
+	files  map[string]file
+	seen   map[string]bool
+	report Report
+}
+
+// Ingest memorizes the files under the root, a directory or a single file.
+// Files that changed since they were last ingested replace their memories,
+// memories of the files under the root that are gone or excluded are
+// forgotten.
+func (ingester *Ingester) Ingest(ctx context.Context, root string) (Report, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return Report{}, fmt.Errorf("failed to resolve path: %w", err)
+	}
+
+	files, err := ingester.files(ctx)
+	if err != nil {
+		return Report{}, err
+	}
+
+	run := &ingestion{
+		Ingester: ingester,
+		root:     root,
+		files:    files,
+		seen:     make(map[string]bool),
+	}
+
+	if err := filepath.WalkDir(root, run.visit(ctx)); err != nil {
+		return run.report, fmt.Errorf("failed to ingest %s: %w", root, err)
+	}
+
+	if err := run.prune(ctx); err != nil {
+		return run.report, err
+	}
+
+	return run.report, nil
+}
+
+// files returns the memorized files of the namespace by their path.
+func (ingester *Ingester) files(ctx context.Context) (map[string]file, error) {
+	files := make(map[string]file)
+
+	var cursor string
+
+	for {
+		page, err := ingester.Memory.List(ctx, api.ListOptions{
+			Namespace: ingester.Namespace,
+			Cursor:    cursor,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list memories: %w", err)
+		}
+
+		for _, record := range page.Records {
+			path := record.Metadata[MetadataPath]
+			if record.Metadata[api.MetadataSource] != Source || path == "" {
+				continue
+			}
+
+			memorized := files[path]
+
+			switch hash := record.Metadata[MetadataHash]; {
+			case len(memorized.ids) == 0:
+				memorized.hash = hash
+			case memorized.hash != hash:
+				memorized.hash = ""
+			}
+
+			memorized.ids = append(memorized.ids, record.ID)
+			files[path] = memorized
+		}
+
+		if page.Next == "" {
+			return files, nil
+		}
+
+		cursor = page.Next
+	}
+}
+
+// visit returns the function visiting each file and directory under the root.
+func (run *ingestion) visit(ctx context.Context) fs.WalkDirFunc {
+	return func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relative, err := filepath.Rel(run.root, path)
+		if err != nil {
+			return fmt.Errorf("failed to resolve path: %w", err)
+		}
+
+		// NOTE(jkoelker) The root itself is always walked, even when it
+		//                matches an exclusion such as `.*` for `.`.
+		relative = filepath.ToSlash(relative)
+		if relative == "." {
+			relative = filepath.Base(path)
+		} else if MatchAny(run.Exclude, relative) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if entry.IsDir() || !entry.Type().IsRegular() {
+			return nil
+		}
+
+		if len(run.Include) > 0 && !MatchAny(run.Include, relative) {
+			return nil
+		}
+
+		kind, ok := LookupKind(path)
+		if !ok {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("failed to stat file: %w", err)
+		}
+
+		if run.MaxFileSize > 0 && info.Size() > run.MaxFileSize {
+			log.Debug(ctx, "Skipping large file", "path", path, "size", info.Size())
+
+			run.report.Skipped++
+
+			return nil
+		}
+
+		return run.ingest(ctx, path, kind)
+	}
+}
+
+// ingest memorizes the file of the kind at the path, unless it is memorized
+// as it is.
+func (run *ingestion) ingest(ctx context.Context, path string, kind Kind) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	memorized := run.files[path]
+
+	if memorized.hash == hash {
+		run.seen[path] = true
+		run.report.Unchanged++
+
+		return nil
+	}
+
+	text, err := Extract(kind, data)
+	if errors.Is(err, ErrBinary) {
+		log.Debug(ctx, "Skipping binary file", "path", path)
+
+		run.report.Skipped++
+
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to extract %s: %w", path, err)
+	}
+
+	chunker := chunk.NewChunker(run.Tokenizer, run.MaxTokens, run.Overlap)
+	chunker.Format = kind.Format
+
+	chunks, err := chunker.Split(ctx, text)
+	if err != nil {
+		return fmt.Errorf("failed to chunk %s: %w", path, err)
+	}
+
+	if len(chunks) > 0 {
+		if err := run.memorize(ctx, path, hash, kind, chunks); err != nil {
+			return err
+		}
+	}
+
+	// NOTE(jkoelker) The previous memories of the file are only forgotten
+	//                once the new ones are memorized, so a failure leaves
+	//                the file recalled as it was.
+	if err := forget(ctx, run.Memory, memorized.ids); err != nil {
+		return err
+	}
+
+	log.Debug(ctx, "Ingested file", "path", path, "chunks", len(chunks))
+
+	run.seen[path] = true
+	run.report.Ingested++
+	run.report.Chunks += len(chunks)
+
+	return nil
+}
+
+// memorize memorizes the chunks of the file at the path.
+func (run *ingestion) memorize(ctx context.Context, path string, hash string, kind Kind, chunks []chunk.Chunk) error {
+	document, err := chunk.NewDocumentID()
+	if err != nil {
+		return err //nolint:wrapcheck // already wrapped
+	}
+
+	records := chunk.Records(document, chunks, api.Record{
+		Namespace: run.Namespace,
+		Metadata: map[string]string{
+			api.MetadataSource: Source,
+			MetadataPath:       path,
+			MetadataHash:       hash,
+		},
+	})
+
+	if kind.Lines {
+		for idx := range records {
+			records[idx].Metadata[MetadataLines] = Lines(chunks[idx].StartLine, chunks[idx].EndLine)
+		}
+	}
+
+	if _, err := run.Memory.Memorize(ctx, records); err != nil {
+		return fmt.Errorf("failed to memorize %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// prune forgets the memorized files under the root that were not seen.
+func (run *ingestion) prune(ctx context.Context) error {
+	prefix := run.root
+	if !strings.HasSuffix(prefix, string(filepath.Separator)) {
+		prefix += string(filepath.Separator)
+	}
+
+	for path, memorized := range run.files {
+		if run.seen[path] || (path != run.root && !strings.HasPrefix(path, prefix)) {
+			continue
+		}
+
+		if err := forget(ctx, run.Memory, memorized.ids); err != nil {
+			return err
+		}
+
+		log.Debug(ctx, "Forgot file", "path", path)
+
+		run.report.Removed++
+	}
+
+	return nil
+}
+
+// forget deletes the memories with the ids, ignoring those already gone.
+func forget(ctx context.Context, memory api.Memory, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	err := memory.Delete(ctx, ids)
+	if errors.Is(err, api.ErrNotFound) {
+		// NOTE(jkoelker) A memory of the file expired since it was listed,
+		//                delete the others one by one.
+		for _, id := range ids {
+			if err := memory.Delete(ctx, []string{id}); err != nil && !errors.Is(err, api.ErrNotFound) {
+				return fmt.Errorf("failed to forget memory: %w", err)
+			}
+		}
+
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to forget memories: %w", err)
+	}
+
+	return nil
+}
+
+// Lines returns the line range metadata of the lines from first to last.
+func Lines(first int, last int) string {
+	return strconv.Itoa(first) + "-" + strconv.Itoa(last)
+}
+
+// ParseLines returns the first and last lines of the line range metadata,
+// false if it is not a line range.
+func ParseLines(lines string) (int, int, bool) {
+	first, last, ok := strings.Cut(lines, "-")
+	if !ok {
+		return 0, 0, false
+	}
+
+	start, err := strconv.Atoi(first)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	end, err := strconv.Atoi(last)
+	if err != nil || end < start {
+		return 0, 0, false
+	}
+
+	return start, end, true
+}
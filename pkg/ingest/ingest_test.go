@@ -0,0 +1,303 @@
+//
+
+package ingest_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/lazygpt/lazygpt/pkg/ingest"
+	"github.com/lazygpt/lazygpt/pkg/models"
+	"github.com/lazygpt/lazygpt/pkg/tokens"
+	"github.com/lazygpt/lazygpt/plugin/api"
+)
+
+// memory is an `api.Memory` keeping the records in a map, listing pages of
+// two records.
+type memory struct {
+	api.Memory
+
+	records map[string]api.Record
+	next    int
+}
+
+func (memory *memory) List(_ context.Context, options api.ListOptions) (*api.Page, error) {
+	ids := make([]string, 0, len(memory.records))
+	for id := range memory.records {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	page := &api.Page{}
+
+	for _, id := range ids {
+		if id < options.Cursor || memory.records[id].Namespace != options.Namespace {
+			continue
+		}
+
+		if len(page.Records) == 2 {
+			page.Next = id
+
+			break
+		}
+
+		page.Records = append(page.Records, memory.records[id])
+	}
+
+	return page, nil
+}
+
+func (memory *memory) Memorize(_ context.Context, records []api.Record) ([]string, error) {
+	ids := make([]string, len(records))
+
+	for idx, record := range records {
+		memory.next++
+		record.ID = fmt.Sprintf("%04d", memory.next)
+		memory.records[record.ID] = record
+		ids[idx] = record.ID
+	}
+
+	return ids, nil
+}
+
+func (memory *memory) Delete(_ context.Context, ids []string) error {
+	for _, id := range ids {
+		if _, ok := memory.records[id]; !ok {
+			return fmt.Errorf("%w: %s", api.ErrNotFound, id)
+		}
+	}
+
+	for _, id := range ids {
+		delete(memory.records, id)
+	}
+
+	return nil
+}
+
+// paths returns the paths of the ingested memories, relative to the root.
+func (memory *memory) paths(t *testing.T, root string) []string {
+	t.Helper()
+
+	seen := make(map[string]bool)
+
+	for _, record := range memory.records {
+		relative, err := filepath.Rel(root, record.Metadata[ingest.MetadataPath])
+		assert.NilError(t, err)
+
+		seen[filepath.ToSlash(relative)] = true
+	}
+
+	paths := make([]string, 0, len(seen))
+	for path := range seen {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	return paths
+}
+
+func write(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		assert.NilError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.NilError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+}
+
+func newIngester(t *testing.T, memory api.Memory) *ingest.Ingester {
+	t.Helper()
+
+	tokenizer, err := tokens.NewTiktoken(models.EncodingCl100kBase)
+	assert.NilError(t, err)
+
+	return ingest.NewIngester(memory, tokenizer, "docs")
+}
+
+func TestMatch(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"*.md", "README.md", true},
+		{"*.md", "docs/guide/intro.md", true},
+		{"*.md", "docs/intro.txt", false},
+		{".*", ".git", true},
+		{".*", "docs/.hidden", true},
+		{"docs/*.md", "docs/intro.md", true},
+		{"docs/*.md", "docs/guide/intro.md", false},
+		{"docs/**/*.md", "docs/intro.md", true},
+		{"docs/**/*.md", "docs/guide/deep/intro.md", true},
+		{"docs/**", "docs/guide/intro.md", true},
+		{"**/testdata", "pkg/chunk/testdata", true},
+		{"/docs/", "docs", true},
+		{"./docs/*.md", "docs/intro.md", true},
+		{"docs/**/*.md", "src/docs/intro.md", false},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, ingest.Match(test.pattern, test.name), test.match, "%s %s", test.pattern, test.name)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	t.Parallel()
+
+	kind, ok := ingest.LookupKind("page.HTML")
+	assert.Assert(t, ok)
+
+	text, err := ingest.Extract(kind, []byte(`<!DOCTYPE html>
+<html>
+  <head><title>Runbook</title><style>p { color: red; }</style></head>
+  <body>
+    <h1>Restarting   the
+      service</h1>
+    <p>Run the <code>restart</code> job &amp; wait.<br>Then check it.</p>
+    <script>alert("no");</script>
+    <pre>line one
+  indented</pre>
+  </body>
+</html>`))
+	assert.NilError(t, err)
+	assert.Equal(
+		t,
+		text,
+		"Runbook\n\nRestarting the service\n\nRun the restart job & wait.\nThen check it.\n\nline one\n  indented",
+	)
+
+	kind, ok = ingest.LookupKind("Makefile")
+	assert.Assert(t, ok)
+
+	_, err = ingest.Extract(kind, []byte("all:\x00\x01"))
+	assert.ErrorIs(t, err, ingest.ErrBinary)
+
+	_, ok = ingest.LookupKind("image.png")
+	assert.Assert(t, !ok)
+}
+
+func TestIngest(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	root := t.TempDir()
+	memory := &memory{records: make(map[string]api.Record)}
+	ingester := newIngester(t, memory)
+	ingester.Exclude = append(ingester.Exclude, "build")
+
+	write(t, root, map[string]string{
+		"README.md":        "# Service\n\nThe service answers questions.\n",
+		"docs/runbook.txt": "Restart it with make restart.\n",
+		"src/main.go":      "package main\n\nfunc main() {}\n",
+		"src/logo.png":     "not ingested",
+		"build/out.txt":    "excluded",
+		".git/config":      "hidden",
+		"notes.txt":        "binary\x00",
+	})
+
+	report, err := ingester.Ingest(ctx, root)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, report, ingest.Report{Ingested: 3, Skipped: 1, Chunks: 3})
+	assert.DeepEqual(t, memory.paths(t, root), []string{"README.md", "docs/runbook.txt", "src/main.go"})
+
+	for _, record := range memory.records {
+		assert.Equal(t, record.Namespace, "docs")
+		assert.Equal(t, record.Metadata[api.MetadataSource], ingest.Source)
+		assert.Equal(t, len(record.Metadata[ingest.MetadataHash]), 64)
+
+		if strings.HasSuffix(record.Metadata[ingest.MetadataPath], "main.go") {
+			assert.Equal(t, record.Data, "package main\n\nfunc main() {}")
+			assert.Equal(t, record.Metadata[ingest.MetadataLines], "1-3")
+		}
+	}
+
+	report, err = ingester.Ingest(ctx, root)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, report, ingest.Report{Unchanged: 3, Skipped: 1})
+
+	write(t, root, map[string]string{"docs/runbook.txt": "Restart it with make restart, then wait.\n"})
+	assert.NilError(t, os.Remove(filepath.Join(root, "README.md")))
+
+	report, err = ingester.Ingest(ctx, root)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, report, ingest.Report{Ingested: 1, Unchanged: 1, Skipped: 1, Removed: 1, Chunks: 1})
+	assert.DeepEqual(t, memory.paths(t, root), []string{"docs/runbook.txt", "src/main.go"})
+	assert.Equal(t, len(memory.records), 2)
+
+	for _, record := range memory.records {
+		if strings.HasSuffix(record.Metadata[ingest.MetadataPath], "runbook.txt") {
+			assert.Equal(t, record.Data, "Restart it with make restart, then wait.")
+		}
+	}
+
+	// NOTE(jkoelker) Ingesting a subdirectory leaves the memories of the
+	//                files outside of it alone.
+	ingester.Include = []string{"*.md"}
+
+	report, err = ingester.Ingest(ctx, filepath.Join(root, "src"))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, report, ingest.Report{Removed: 1})
+	assert.DeepEqual(t, memory.paths(t, root), []string{"docs/runbook.txt"})
+}
+
+func TestIngestChunks(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	root := t.TempDir()
+	memory := &memory{records: make(map[string]api.Record)}
+	ingester := newIngester(t, memory)
+	ingester.MaxTokens = 16
+	ingester.Overlap = 0
+
+	lines := make([]string, 0, 12)
+	for idx := 0; idx < 12; idx++ {
+		lines = append(lines, fmt.Sprintf("Line %d of the guide explains a step.", idx+1))
+	}
+
+	write(t, root, map[string]string{"guide.md": strings.Join(lines, "\n")})
+
+	report, err := ingester.Ingest(ctx, filepath.Join(root, "guide.md"))
+	assert.NilError(t, err)
+	assert.Equal(t, report.Ingested, 1)
+	assert.Assert(t, report.Chunks > 1)
+
+	chunks := make(map[int]api.Record)
+	document := ""
+
+	for _, record := range memory.records {
+		id, index, ok := record.Chunk()
+		assert.Assert(t, ok)
+		assert.Assert(t, document == "" || document == id)
+
+		document = id
+		chunks[index] = record
+	}
+
+	assert.Equal(t, len(chunks), report.Chunks)
+
+	next := 1
+
+	for index := 0; index < len(chunks); index++ {
+		first, last, ok := ingest.ParseLines(chunks[index].Metadata[ingest.MetadataLines])
+		assert.Assert(t, ok)
+		assert.Equal(t, first, next)
+		assert.Equal(t, chunks[index].Data, strings.Join(lines[first-1:last], "\n"))
+
+		next = last + 1
+	}
+
+	assert.Equal(t, next, len(lines)+1)
+}
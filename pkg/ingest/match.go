@@ -0,0 +1,63 @@
+//
+
+package ingest
+
+import (
+	"path"
+	"strings"
+)
+
+// Match reports whether the slash separated path matches the glob pattern.
+// Patterns without a slash match the last element of the path, so `*.md`
+// matches Markdown files in every directory. Otherwise the pattern matches
+// the whole path, a `**` element matching any number of directories.
+func Match(pattern string, name string) bool {
+	pattern = strings.TrimSuffix(strings.TrimPrefix(pattern, "./"), "/")
+
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(name))
+
+		return ok
+	}
+
+	return matchElements(strings.Split(strings.TrimPrefix(pattern, "/"), "/"), strings.Split(name, "/"))
+}
+
+// MatchAny reports whether the path matches any of the patterns.
+func MatchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if Match(pattern, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchElements reports whether the elements of a path match the elements of
+// a pattern.
+func matchElements(patterns []string, names []string) bool {
+	for len(patterns) > 0 {
+		if patterns[0] == "**" {
+			for skip := 0; skip <= len(names); skip++ {
+				if matchElements(patterns[1:], names[skip:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(names) == 0 {
+			return false
+		}
+
+		if ok, _ := path.Match(patterns[0], names[0]); !ok {
+			return false
+		}
+
+		patterns, names = patterns[1:], names[1:]
+	}
+
+	return len(names) == 0
+}
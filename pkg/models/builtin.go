@@ -0,0 +1,75 @@
+//
+
+package models
+
+const (
+	// EncodingCl100kBase is the tiktoken encoding used by the chat models.
+	EncodingCl100kBase = "cl100k_base"
+
+	// NOTE(jkoelker) The original chat models prime every message with four
+	//                tokens and omit the role when a name is present, later
+	//                snapshots use three tokens and add one for the name.
+	legacyPerMessage = 4
+	legacyPerName    = -1
+	chatPerMessage   = 3
+	chatPerName      = 1
+)
+
+// Builtin returns the models known to LazyGPT out of the box.
+func Builtin() []Model {
+	gpt35 := Model{
+		ContextWindow:   4096,
+		MaxOutput:       1024,
+		Encoding:        EncodingCl100kBase,
+		PerMessage:      chatPerMessage,
+		PerName:         chatPerName,
+		PromptPrice:     0.0015,
+		CompletionPrice: 0.002,
+	}
+
+	gpt35Legacy := gpt35
+	gpt35Legacy.PerMessage = legacyPerMessage
+	gpt35Legacy.PerName = legacyPerName
+
+	gpt3516k := gpt35
+	gpt3516k.ContextWindow = 16384
+	gpt3516k.MaxOutput = 4096
+	gpt3516k.PromptPrice = 0.003
+	gpt3516k.CompletionPrice = 0.004
+
+	gpt4 := Model{
+		ContextWindow:   8192,
+		MaxOutput:       2048,
+		Encoding:        EncodingCl100kBase,
+		PerMessage:      chatPerMessage,
+		PerName:         chatPerName,
+		PromptPrice:     0.03,
+		CompletionPrice: 0.06,
+	}
+
+	gpt432k := gpt4
+	gpt432k.ContextWindow = 32768
+	gpt432k.MaxOutput = 8192
+	gpt432k.PromptPrice = 0.06
+	gpt432k.CompletionPrice = 0.12
+
+	return []Model{
+		named("gpt-3.5-turbo", gpt35Legacy),
+		named("gpt-3.5-turbo-0301", gpt35Legacy),
+		named("gpt-3.5-turbo-0613", gpt35),
+		named("gpt-3.5-turbo-16k", gpt3516k),
+		named("gpt-3.5-turbo-16k-0613", gpt3516k),
+		named("gpt-4", gpt4),
+		named("gpt-4-0314", gpt4),
+		named("gpt-4-0613", gpt4),
+		named("gpt-4-32k", gpt432k),
+		named("gpt-4-32k-0314", gpt432k),
+		named("gpt-4-32k-0613", gpt432k),
+	}
+}
+
+func named(name string, model Model) Model {
+	model.Name = name
+
+	return model
+}
@@ -0,0 +1,95 @@
+//
+
+package models
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/tiktoken-go/tokenizer"
+)
+
+var (
+	// ErrUnknownModel is returned when a model is not in the registry.
+	ErrUnknownModel = errors.New("unknown model")
+
+	// ErrInvalidModel is returned when a model definition is not usable.
+	ErrInvalidModel = errors.New("invalid model")
+)
+
+// TokensPerPrice is the number of tokens the model prices are quoted for.
+const TokensPerPrice = 1000
+
+// encodings are the tiktoken encodings a model may count tokens with.
+var encodings = map[string]bool{
+	string(tokenizer.Cl100kBase): true,
+	string(tokenizer.P50kBase):   true,
+	string(tokenizer.P50kEdit):   true,
+	string(tokenizer.R50kBase):   true,
+}
+
+// Model describes the limits, tokenization and pricing of a language model.
+type Model struct {
+	// Name of the model as the completion plugin knows it.
+	Name string `mapstructure:"name"`
+
+	// ContextWindow is the total number of tokens the model accepts for the
+	// prompt and the response combined.
+	ContextWindow int `mapstructure:"context-window"`
+
+	// MaxOutput is the number of tokens reserved out of the context window
+	// for the response.
+	MaxOutput int `mapstructure:"max-output"`
+
+	// Encoding is the tiktoken encoding used to count tokens for the model.
+	Encoding string `mapstructure:"encoding"`
+
+	// PerMessage is the number of tokens added for every message.
+	PerMessage int `mapstructure:"per-message"`
+
+	// PerName is the number of tokens added for every message with a name.
+	PerName int `mapstructure:"per-name"`
+
+	// PromptPrice is the price in USD per 1K prompt tokens.
+	PromptPrice float64 `mapstructure:"prompt-price"`
+
+	// CompletionPrice is the price in USD per 1K completion tokens.
+	CompletionPrice float64 `mapstructure:"completion-price"`
+}
+
+// Validate checks that the model definition is usable for budgeting.
+func (model *Model) Validate() error {
+	if model.Name == "" {
+		return fmt.Errorf("%w: missing name", ErrInvalidModel)
+	}
+
+	if model.ContextWindow <= 0 {
+		return fmt.Errorf("%w: %q context window must be positive", ErrInvalidModel, model.Name)
+	}
+
+	if model.MaxOutput < 0 || model.MaxOutput >= model.ContextWindow {
+		return fmt.Errorf(
+			"%w: %q max output must be between 0 and the context window",
+			ErrInvalidModel,
+			model.Name,
+		)
+	}
+
+	if !encodings[model.Encoding] {
+		return fmt.Errorf("%w: %q unknown encoding %q", ErrInvalidModel, model.Name, model.Encoding)
+	}
+
+	return nil
+}
+
+// SendTokens returns the number of tokens available for the prompt once the
+// response tokens have been reserved.
+func (model *Model) SendTokens() int {
+	return model.ContextWindow - model.MaxOutput
+}
+
+// Cost returns the price in USD for the given prompt and completion tokens.
+func (model *Model) Cost(promptTokens int, completionTokens int) float64 {
+	return (float64(promptTokens)*model.PromptPrice +
+		float64(completionTokens)*model.CompletionPrice) / TokensPerPrice
+}
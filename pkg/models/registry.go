@@ -0,0 +1,103 @@
+//
+
+package models
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Registry is a set of known models indexed by name.
+type Registry struct {
+	models map[string]Model
+	mu     sync.RWMutex
+}
+
+// NewRegistry creates a new registry containing the given models.
+func NewRegistry(models ...Model) (*Registry, error) {
+	registry := &Registry{
+		models: make(map[string]Model, len(models)),
+	}
+
+	for _, model := range models {
+		if err := registry.Register(model); err != nil {
+			return nil, err
+		}
+	}
+
+	return registry, nil
+}
+
+// Register adds the model to the registry, replacing any model with the
+// same name.
+func (registry *Registry) Register(model Model) error {
+	if err := model.Validate(); err != nil {
+		return err
+	}
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	registry.models[model.Name] = model
+
+	return nil
+}
+
+// Lookup returns the model with the given name.
+func (registry *Registry) Lookup(name string) (Model, error) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	model, ok := registry.models[name]
+	if !ok {
+		return Model{}, fmt.Errorf("%w: %q", ErrUnknownModel, name)
+	}
+
+	return model, nil
+}
+
+// Models returns all the registered models sorted by name.
+func (registry *Registry) Models() []Model {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	models := make([]Model, 0, len(registry.models))
+	for _, model := range registry.models {
+		models = append(models, model)
+	}
+
+	sort.Slice(models, func(i, j int) bool {
+		return models[i].Name < models[j].Name
+	})
+
+	return models
+}
+
+// defaultRegistry is the registry used by the package level functions.
+var defaultRegistry = mustRegistry(Builtin()...)
+
+func mustRegistry(models ...Model) *Registry {
+	registry, err := NewRegistry(models...)
+	if err != nil {
+		panic(err)
+	}
+
+	return registry
+}
+
+// Default returns the default registry, pre-populated with the builtin
+// models.
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// Register adds the model to the default registry.
+func Register(model Model) error {
+	return defaultRegistry.Register(model)
+}
+
+// Lookup returns the model with the given name from the default registry.
+func Lookup(name string) (Model, error) {
+	return defaultRegistry.Lookup(name)
+}
@@ -0,0 +1,63 @@
+//
+
+package models_test
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/lazygpt/lazygpt/pkg/models"
+)
+
+func TestRegistryBuiltin(t *testing.T) {
+	t.Parallel()
+
+	model, err := models.Lookup("gpt-4-32k")
+	assert.NilError(t, err)
+	assert.Equal(t, model.ContextWindow, 32768)
+	assert.Equal(t, model.SendTokens(), 32768-8192)
+
+	_, err = models.Lookup("llama-7b")
+	assert.ErrorIs(t, err, models.ErrUnknownModel)
+}
+
+func TestRegistryRegister(t *testing.T) {
+	t.Parallel()
+
+	registry, err := models.NewRegistry(models.Builtin()...)
+	assert.NilError(t, err)
+
+	err = registry.Register(models.Model{
+		Name:          "gpt-4",
+		ContextWindow: 1000,
+		MaxOutput:     100,
+		Encoding:      models.EncodingCl100kBase,
+	})
+	assert.NilError(t, err)
+
+	model, err := registry.Lookup("gpt-4")
+	assert.NilError(t, err)
+	assert.Equal(t, model.ContextWindow, 1000)
+
+	err = registry.Register(models.Model{Name: "broken", ContextWindow: 10, MaxOutput: 10})
+	assert.ErrorIs(t, err, models.ErrInvalidModel)
+
+	err = registry.Register(models.Model{Name: "no-encoding", ContextWindow: 10})
+	assert.ErrorIs(t, err, models.ErrInvalidModel)
+
+	err = registry.Register(models.Model{Name: "unknown-encoding", ContextWindow: 10, Encoding: "o200k_base"})
+	assert.ErrorIs(t, err, models.ErrInvalidModel)
+
+	err = registry.Register(models.Model{ContextWindow: 10})
+	assert.ErrorIs(t, err, models.ErrInvalidModel)
+}
+
+func TestModelCost(t *testing.T) {
+	t.Parallel()
+
+	model := models.Model{PromptPrice: 0.03, CompletionPrice: 0.06}
+
+	assert.Equal(t, model.Cost(1000, 500), 0.06)
+	assert.Equal(t, model.Cost(0, 0), 0.0)
+}
@@ -0,0 +1,201 @@
+//
+
+package summary
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lazygpt/lazygpt/pkg/models"
+	"github.com/lazygpt/lazygpt/pkg/tokens"
+	"github.com/lazygpt/lazygpt/plugin/api"
+	"github.com/lazygpt/lazygpt/plugin/log"
+)
+
+// ErrNoSummary is returned when the completion does not return a summary.
+var ErrNoSummary = errors.New("no summary returned")
+
+const (
+	// Instructions are the system instructions given to the model to update
+	// the summary. It is formatted with the token budget of the summary.
+	Instructions = `You maintain a running summary of a conversation between a
+user and an AI assistant. Update the summary with the new messages. Keep every
+decision, fact, name and open question, drop pleasantries and repetition.
+Reply with the updated summary only, using at most %d tokens.`
+
+	// Prefix is prepended to the summary when it is added to the context.
+	Prefix = "This is a summary of the conversation so far: "
+)
+
+// Summarizer condenses messages that fall out of the context window into a
+// running summary of the conversation using a completion plugin.
+type Summarizer struct {
+	// Summary of the conversation so far.
+	Summary string
+
+	// MaxTokens is the token budget of the summary message.
+	MaxTokens int
+
+	completion api.Completion
+	model      models.Model
+	tokenizer  api.Tokenizer
+}
+
+// NewSummarizer creates a new Summarizer keeping the summary message within
+// maxTokens. The optional tokenizer is used to count tokens for the model.
+func NewSummarizer(
+	completion api.Completion,
+	model models.Model,
+	maxTokens int,
+	tokenizer ...api.Tokenizer,
+) *Summarizer {
+	summarizer := &Summarizer{
+		MaxTokens: maxTokens,
+
+		completion: completion,
+		model:      model,
+	}
+
+	if len(tokenizer) > 0 {
+		summarizer.tokenizer = tokenizer[0]
+	}
+
+	return summarizer
+}
+
+// Message returns the summary as a system message, or `nil` if nothing has
+// been summarized yet.
+func (summarizer *Summarizer) Message() *api.Message {
+	if summarizer.Summary == "" {
+		return nil
+	}
+
+	return &api.Message{
+		Role:    "system",
+		Content: Prefix + summarizer.Summary,
+	}
+}
+
+// Summarize folds the messages into the summary. The messages are split in
+// batches that fit the model alongside the current summary, each batch
+// updating the summary in turn. The summary is only replaced once every batch
+// is folded, so a failure leaves it as it was.
+func (summarizer *Summarizer) Summarize(ctx context.Context, messages []api.Message) error {
+	summary := summarizer.Summary
+
+	for len(messages) > 0 {
+		size, err := summarizer.batch(ctx, summary, messages)
+		if err != nil {
+			return fmt.Errorf("failed to batch messages: %w", err)
+		}
+
+		if summary, err = summarizer.update(ctx, summary, messages[:size]); err != nil {
+			return fmt.Errorf("failed to update summary: %w", err)
+		}
+
+		messages = messages[size:]
+	}
+
+	summarizer.Summary = summary
+
+	return nil
+}
+
+// prompt returns the messages asking the model to fold the batch into the
+// summary.
+func (summarizer *Summarizer) prompt(summary string, batch []api.Message) []api.Message {
+	var conversation strings.Builder
+
+	for _, message := range batch {
+		fmt.Fprintf(&conversation, "%s: %s\n", message.Role, message.Content)
+	}
+
+	current := summary
+	if current == "" {
+		current = "(empty)"
+	}
+
+	return []api.Message{
+		{
+			Role:    "system",
+			Content: fmt.Sprintf(Instructions, summarizer.MaxTokens),
+		},
+		{
+			Role: "user",
+			Content: fmt.Sprintf(
+				"Summary so far:\n%s\n\nNew messages:\n%s",
+				current,
+				conversation.String(),
+			),
+		},
+	}
+}
+
+// batch returns how many of the messages fit in a single summarization
+// request. At least one message is always returned so progress is made, the
+// model truncating an oversized message is preferable to never summarizing
+// it.
+func (summarizer *Summarizer) batch(ctx context.Context, summary string, messages []api.Message) (int, error) {
+	limit := summarizer.model.SendTokens()
+
+	for size := 1; size <= len(messages); size++ {
+		counter, err := tokens.NewModelCounter(summarizer.model, summarizer.tokenizer)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create counter: %w", err)
+		}
+
+		if err := counter.AddContext(ctx, summarizer.prompt(summary, messages[:size])...); err != nil {
+			return 0, fmt.Errorf("failed to count prompt: %w", err)
+		}
+
+		if counter.Tokens > limit {
+			if size == 1 {
+				return 1, nil
+			}
+
+			return size - 1, nil
+		}
+	}
+
+	return len(messages), nil
+}
+
+// update returns the summary with a single batch folded into it.
+func (summarizer *Summarizer) update(ctx context.Context, summary string, batch []api.Message) (string, error) {
+	response, _, err := summarizer.completion.Complete(
+		ctx,
+		summarizer.model.Name,
+		summarizer.prompt(summary, batch),
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to complete summary: %w", err)
+	}
+
+	if response == nil || strings.TrimSpace(response.Content) == "" {
+		return "", ErrNoSummary
+	}
+
+	tokenizer, err := tokens.NewTokenizer(summarizer.model, summarizer.tokenizer)
+	if err != nil {
+		return "", fmt.Errorf("failed to create tokenizer: %w", err)
+	}
+
+	// NOTE(jkoelker) The model does not always honor the requested length,
+	//                enforce the budget so the summary can't crowd out the
+	//                rest of the context.
+	budget := summarizer.MaxTokens
+	if prefix, err := tokenizer.Count(ctx, Prefix); err == nil {
+		budget -= prefix
+	}
+
+	updated, err := tokens.Truncate(ctx, tokenizer, strings.TrimSpace(response.Content), budget)
+	if err != nil {
+		return "", fmt.Errorf("failed to truncate summary: %w", err)
+	}
+
+	log.Debug(ctx, "Updated conversation summary", "summary", updated, "messages", len(batch))
+
+	return updated, nil
+}
@@ -0,0 +1,148 @@
+//
+
+package summary_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/lazygpt/lazygpt/pkg/models"
+	"github.com/lazygpt/lazygpt/pkg/summary"
+	"github.com/lazygpt/lazygpt/plugin/api"
+)
+
+// recorder is an `api.Completion` that records the prompts and replies with
+// the new messages appended to the summary.
+type recorder struct {
+	prompts [][]api.Message
+}
+
+func (r *recorder) Complete(
+	_ context.Context,
+	_ string,
+	messages []api.Message,
+) (*api.Message, api.Reason, error) {
+	r.prompts = append(r.prompts, messages)
+
+	content := messages[len(messages)-1].Content
+	content = strings.TrimPrefix(content, "Summary so far:\n")
+	content = strings.Replace(content, "(empty)", "", 1)
+	content = strings.Replace(content, "\n\nNew messages:\n", " ", 1)
+
+	return &api.Message{Role: "assistant", Content: content}, api.Reason_STOP, nil
+}
+
+func TestSummarizerIncremental(t *testing.T) {
+	t.Parallel()
+
+	model, err := models.Lookup("gpt-4")
+	assert.NilError(t, err)
+
+	completion := &recorder{}
+	summarizer := summary.NewSummarizer(completion, model, 100)
+
+	assert.Assert(t, summarizer.Message() == nil)
+
+	err = summarizer.Summarize(context.Background(), []api.Message{
+		{Role: "user", Content: "use postgres"},
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, summarizer.Summary, "user: use postgres")
+
+	err = summarizer.Summarize(context.Background(), []api.Message{
+		{Role: "assistant", Content: "ok"},
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, len(completion.prompts), 2)
+	assert.Assert(t, strings.Contains(completion.prompts[1][1].Content, "user: use postgres"))
+	assert.Equal(t, summarizer.Message().Content, summary.Prefix+"user: use postgres assistant: ok")
+}
+
+func TestSummarizerBudget(t *testing.T) {
+	t.Parallel()
+
+	model, err := models.Lookup("gpt-4")
+	assert.NilError(t, err)
+
+	summarizer := summary.NewSummarizer(&recorder{}, model, 20)
+
+	err = summarizer.Summarize(context.Background(), []api.Message{
+		{Role: "user", Content: strings.Repeat("lorem ipsum ", 100)},
+	})
+	assert.NilError(t, err)
+	assert.Assert(t, len(strings.Fields(summarizer.Summary)) < 20)
+}
+
+func TestSummarizerBatches(t *testing.T) {
+	t.Parallel()
+
+	model := models.Model{
+		Name:          "tiny",
+		ContextWindow: 200,
+		MaxOutput:     50,
+		Encoding:      models.EncodingCl100kBase,
+		PerMessage:    3,
+	}
+
+	completion := &recorder{}
+	summarizer := summary.NewSummarizer(completion, model, 10)
+
+	messages := make([]api.Message, 0, 10)
+	for i := 0; i < 10; i++ {
+		messages = append(messages, api.Message{Role: "user", Content: strings.Repeat("word ", 20)})
+	}
+
+	assert.NilError(t, summarizer.Summarize(context.Background(), messages))
+	assert.Assert(t, len(completion.prompts) > 1)
+}
+
+// failing is a `recorder` failing once it replied to `after` prompts.
+type failing struct {
+	recorder
+
+	after int
+}
+
+func (f *failing) Complete(
+	ctx context.Context,
+	model string,
+	messages []api.Message,
+) (*api.Message, api.Reason, error) {
+	if len(f.prompts) == f.after {
+		return nil, api.Reason_STOP, errors.New("unavailable")
+	}
+
+	return f.recorder.Complete(ctx, model, messages)
+}
+
+func TestSummarizerFailedBatch(t *testing.T) {
+	t.Parallel()
+
+	model := models.Model{
+		Name:          "tiny",
+		ContextWindow: 200,
+		MaxOutput:     50,
+		Encoding:      models.EncodingCl100kBase,
+		PerMessage:    3,
+	}
+
+	completion := &failing{after: 1}
+	summarizer := summary.NewSummarizer(completion, model, 10)
+	summarizer.Summary = "before"
+
+	messages := make([]api.Message, 0, 10)
+	for i := 0; i < 10; i++ {
+		messages = append(messages, api.Message{Role: "user", Content: strings.Repeat("word ", 20)})
+	}
+
+	// NOTE(jkoelker) The first batch is folded before the second fails, the
+	//                summary is kept as it was so the batch is not folded
+	//                twice when the messages are summarized again.
+	assert.Assert(t, summarizer.Summarize(context.Background(), messages) != nil)
+	assert.Equal(t, len(completion.prompts), 1)
+	assert.Equal(t, summarizer.Summary, "before")
+}
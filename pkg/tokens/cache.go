@@ -0,0 +1,93 @@
+//
+
+package tokens
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/lazygpt/lazygpt/plugin/api"
+)
+
+// DefaultCacheSize is the number of counts a `CachedTokenizer` keeps.
+const DefaultCacheSize = 4096
+
+// CachedTokenizer is an `api.Tokenizer` keeping the counts of another, so the
+// messages of a conversation are counted by a tokenizer plugin once rather
+// than on every turn. Once full, the counts are dropped and counted again.
+type CachedTokenizer struct {
+	Impl api.Tokenizer
+
+	// Size is the number of counts kept.
+	Size int
+
+	mu     sync.Mutex
+	counts map[countKey]int
+}
+
+// countKey is the key of a count of a `CachedTokenizer`.
+type countKey struct {
+	model string
+	text  string
+}
+
+var _ api.Tokenizer = (*CachedTokenizer)(nil)
+
+// NewCachedTokenizer returns a new CachedTokenizer of the tokenizer keeping
+// `DefaultCacheSize` counts.
+func NewCachedTokenizer(tokenizer api.Tokenizer) *CachedTokenizer {
+	return &CachedTokenizer{
+		Impl: tokenizer,
+		Size: DefaultCacheSize,
+	}
+}
+
+// Count implements the `api.Tokenizer` interface.
+func (cached *CachedTokenizer) Count(ctx context.Context, model string, text string) (int, error) {
+	key := countKey{model: model, text: text}
+
+	cached.mu.Lock()
+	count, ok := cached.counts[key]
+	cached.mu.Unlock()
+
+	if ok {
+		return count, nil
+	}
+
+	count, err := cached.Impl.Count(ctx, model, text)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count tokens: %w", err)
+	}
+
+	cached.mu.Lock()
+	defer cached.mu.Unlock()
+
+	if cached.counts == nil || len(cached.counts) >= cached.Size {
+		cached.counts = make(map[countKey]int)
+	}
+
+	cached.counts[key] = count
+
+	return count, nil
+}
+
+// Encode implements the `api.Tokenizer` interface.
+func (cached *CachedTokenizer) Encode(ctx context.Context, model string, text string) ([]int, error) {
+	tokens, err := cached.Impl.Encode(ctx, model, text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode text: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// Decode implements the `api.Tokenizer` interface.
+func (cached *CachedTokenizer) Decode(ctx context.Context, model string, tokens []int) (string, error) {
+	text, err := cached.Impl.Decode(ctx, model, tokens)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode tokens: %w", err)
+	}
+
+	return text, nil
+}
@@ -3,10 +3,10 @@
 package tokens
 
 import (
+	"context"
 	"fmt"
 
-	"github.com/tiktoken-go/tokenizer"
-
+	"github.com/lazygpt/lazygpt/pkg/models"
 	"github.com/lazygpt/lazygpt/plugin/api"
 )
 
@@ -21,8 +21,8 @@ type Counter struct {
 	// Token count.
 	Tokens int
 
-	// encoding used for the model.
-	encoding tokenizer.Codec
+	// tokenizer used for the model.
+	tokenizer Tokenizer
 
 	// perMessage number of tokens per message.
 	perMessage int
@@ -31,64 +31,68 @@ type Counter struct {
 	perName int
 }
 
-// NewCounter creates a new counter.
-func NewCounter(model string) (*Counter, error) {
-	var perMessage, perName int
-
-	switch model {
-	case "gpt-4-32k-0314", "gpt-4-32k", "gpt-4-0314", "gpt-4":
-		perMessage = 3
-		perName = 1
-	case "gpt-3.5-turbo-0301", "gpt-3.5-turbo":
-		perMessage = 4
-		perName = -1
-	default:
-		// NOTE(jkoelker) default to gpt4
-		perMessage = 3
-		perName = 1
+// NewCounter creates a new counter for the named model in the default model
+// registry.
+func NewCounter(name string, tokenizer ...api.Tokenizer) (*Counter, error) {
+	model, err := models.Lookup(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup model: %w", err)
 	}
 
-	enc, err := tokenizer.Get(tokenizer.Cl100kBase)
+	return NewModelCounter(model, tokenizer...)
+}
+
+// NewModelCounter creates a new counter using the tokenization rules of the
+// model. If a tokenizer plugin is given, tokens are counted by the plugin,
+// otherwise the tiktoken encoding of the model is used.
+func NewModelCounter(model models.Model, tokenizer ...api.Tokenizer) (*Counter, error) {
+	tok, err := NewTokenizer(model, tokenizer...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get encoding: %w", err)
+		return nil, fmt.Errorf("failed to create tokenizer: %w", err)
 	}
 
 	return &Counter{
-		Model:  model,
+		Model:  model.Name,
 		Tokens: PrimedTokens,
 
-		encoding:   enc,
-		perMessage: perMessage,
-		perName:    perName,
+		tokenizer:  tok,
+		perMessage: model.PerMessage,
+		perName:    model.PerName,
 	}, nil
 }
 
 // Add adds a message to the counter taking into account the model to
 // add necessary tokens.
 func (c *Counter) Add(messages ...api.Message) error {
+	return c.AddContext(context.Background(), messages...)
+}
+
+// AddContext adds a message to the counter taking into account the model to
+// add necessary tokens. The context is passed to the tokenizer.
+func (c *Counter) AddContext(ctx context.Context, messages ...api.Message) error {
 	for _, msg := range messages {
 		c.Tokens += c.perMessage
 
-		_, tokens, err := c.encoding.Encode(msg.Content)
+		tokens, err := c.count(ctx, msg.Content)
 		if err != nil {
 			return fmt.Errorf("failed to encode message: %w", err)
 		}
 
-		c.Tokens += len(tokens)
+		c.Tokens += tokens
 
-		_, tokens, err = c.encoding.Encode(msg.Name)
+		tokens, err = c.count(ctx, msg.Name)
 		if err != nil {
 			return fmt.Errorf("failed to encode name: %w", err)
 		}
 
-		c.Tokens += len(tokens)
+		c.Tokens += tokens
 
-		_, tokens, err = c.encoding.Encode(msg.Role)
+		tokens, err = c.count(ctx, msg.Role)
 		if err != nil {
 			return fmt.Errorf("failed to encode role: %w", err)
 		}
 
-		c.Tokens += len(tokens)
+		c.Tokens += tokens
 
 		if msg.Name != "" {
 			c.Tokens += c.perName
@@ -97,3 +101,12 @@ func (c *Counter) Add(messages ...api.Message) error {
 
 	return nil
 }
+
+// count returns the number of tokens in the text, an empty text has none.
+func (c *Counter) count(ctx context.Context, text string) (int, error) {
+	if text == "" {
+		return 0, nil
+	}
+
+	return c.tokenizer.Count(ctx, text) //nolint:wrapcheck // wrapped by the caller
+}
@@ -3,10 +3,13 @@
 package tokens_test
 
 import (
+	"context"
+	"strings"
 	"testing"
 
 	"gotest.tools/v3/assert"
 
+	"github.com/lazygpt/lazygpt/pkg/models"
 	. "github.com/lazygpt/lazygpt/pkg/tokens"
 	"github.com/lazygpt/lazygpt/plugin/api"
 )
@@ -71,3 +74,80 @@ func TestCounterGPT40314(t *testing.T) {
 
 	assert.Equal(t, counter.Tokens, 129)
 }
+
+func TestCounterUnknownModel(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewCounter("not-a-model")
+	assert.ErrorIs(t, err, models.ErrUnknownModel)
+}
+
+// wordTokenizer is an `api.Tokenizer` counting a token per word.
+type wordTokenizer struct{}
+
+func (wordTokenizer) Count(_ context.Context, _ string, text string) (int, error) {
+	return len(strings.Fields(text)), nil
+}
+
+func (wordTokenizer) Encode(_ context.Context, _ string, text string) ([]int, error) {
+	return make([]int, len(strings.Fields(text))), nil
+}
+
+func (wordTokenizer) Decode(_ context.Context, _ string, tokens []int) (string, error) {
+	return strings.Repeat("word ", len(tokens)), nil
+}
+
+func TestCounterPluginTokenizer(t *testing.T) {
+	t.Parallel()
+
+	model := models.Model{
+		Name:          "llama-7b",
+		ContextWindow: 2048,
+		PerMessage:    1,
+	}
+
+	counter, err := NewModelCounter(model, wordTokenizer{})
+	assert.NilError(t, err)
+
+	assert.NilError(t, counter.Add(api.Message{Role: "user", Content: "one two three"}))
+	assert.Equal(t, counter.Tokens, PrimedTokens+1+3+1)
+}
+
+// countingTokenizer is a `wordTokenizer` counting the texts it counts.
+type countingTokenizer struct {
+	wordTokenizer
+
+	counted []string
+}
+
+func (counting *countingTokenizer) Count(ctx context.Context, model string, text string) (int, error) {
+	counting.counted = append(counting.counted, text)
+
+	return counting.wordTokenizer.Count(ctx, model, text)
+}
+
+func TestCounterCachedTokenizer(t *testing.T) {
+	t.Parallel()
+
+	model := models.Model{
+		Name:          "llama-7b",
+		ContextWindow: 2048,
+		PerMessage:    1,
+	}
+
+	counting := &countingTokenizer{}
+	cached := NewCachedTokenizer(counting)
+	message := api.Message{Role: "user", Content: "one two three"}
+
+	for turn := 0; turn < 3; turn++ {
+		counter, err := NewModelCounter(model, cached)
+		assert.NilError(t, err)
+
+		assert.NilError(t, counter.Add(message, message))
+		assert.Equal(t, counter.Tokens, PrimedTokens+2*(1+3+1))
+	}
+
+	// NOTE(jkoelker) The empty name is never counted, the content and role
+	//                only the first time.
+	assert.DeepEqual(t, counting.counted, []string{"one two three", "user"})
+}
@@ -0,0 +1,170 @@
+//
+
+package tokens
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tiktoken-go/tokenizer"
+
+	"github.com/lazygpt/lazygpt/pkg/models"
+	"github.com/lazygpt/lazygpt/plugin/api"
+)
+
+// Tokenizer splits text into the tokens of a model.
+type Tokenizer interface {
+	// Count returns the number of tokens in the text.
+	Count(ctx context.Context, text string) (int, error)
+
+	// Encode returns the tokens of the text.
+	Encode(ctx context.Context, text string) ([]int, error)
+
+	// Decode returns the text of the tokens.
+	Decode(ctx context.Context, tokens []int) (string, error)
+}
+
+// NewTokenizer returns the tokenizer for the model. If a tokenizer plugin is
+// given, it is used, otherwise the tiktoken encoding of the model is used.
+func NewTokenizer(model models.Model, tokenizer ...api.Tokenizer) (Tokenizer, error) { //nolint:ireturn
+	if len(tokenizer) > 0 && tokenizer[0] != nil {
+		return NewPluginTokenizer(tokenizer[0], model.Name), nil
+	}
+
+	tiktoken, err := NewTiktoken(model.Encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	return tiktoken, nil
+}
+
+// Truncate returns the text cut down to at most limit tokens.
+func Truncate(ctx context.Context, tokenizer Tokenizer, text string, limit int) (string, error) {
+	tokens, err := tokenizer.Encode(ctx, text)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode text: %w", err)
+	}
+
+	if len(tokens) <= limit {
+		return text, nil
+	}
+
+	if limit <= 0 {
+		return "", nil
+	}
+
+	truncated, err := tokenizer.Decode(ctx, tokens[:limit])
+	if err != nil {
+		return "", fmt.Errorf("failed to decode tokens: %w", err)
+	}
+
+	return truncated, nil
+}
+
+// Tiktoken is a `Tokenizer` using the tiktoken encodings of the OpenAI
+// models.
+type Tiktoken struct {
+	codec tokenizer.Codec
+}
+
+var _ Tokenizer = (*Tiktoken)(nil)
+
+// NewTiktoken creates a new Tiktoken tokenizer for the named encoding.
+func NewTiktoken(encoding string) (*Tiktoken, error) {
+	codec, err := tokenizer.Get(tokenizer.Encoding(encoding))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get encoding: %w", err)
+	}
+
+	return &Tiktoken{
+		codec: codec,
+	}, nil
+}
+
+// Count implements the `Tokenizer` interface.
+func (tiktoken *Tiktoken) Count(_ context.Context, text string) (int, error) {
+	ids, _, err := tiktoken.codec.Encode(text)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode text: %w", err)
+	}
+
+	return len(ids), nil
+}
+
+// Encode implements the `Tokenizer` interface.
+func (tiktoken *Tiktoken) Encode(_ context.Context, text string) ([]int, error) {
+	ids, _, err := tiktoken.codec.Encode(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode text: %w", err)
+	}
+
+	tokens := make([]int, len(ids))
+	for idx, id := range ids {
+		tokens[idx] = int(id)
+	}
+
+	return tokens, nil
+}
+
+// Decode implements the `Tokenizer` interface.
+func (tiktoken *Tiktoken) Decode(_ context.Context, tokens []int) (string, error) {
+	ids := make([]uint, len(tokens))
+	for idx, token := range tokens {
+		ids[idx] = uint(token)
+	}
+
+	text, err := tiktoken.codec.Decode(ids)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode tokens: %w", err)
+	}
+
+	return text, nil
+}
+
+// PluginTokenizer is a `Tokenizer` delegating to a tokenizer plugin for a
+// model.
+type PluginTokenizer struct {
+	Model     string
+	Tokenizer api.Tokenizer
+}
+
+var _ Tokenizer = (*PluginTokenizer)(nil)
+
+// NewPluginTokenizer creates a new PluginTokenizer for the model.
+func NewPluginTokenizer(tokenizer api.Tokenizer, model string) *PluginTokenizer {
+	return &PluginTokenizer{
+		Model:     model,
+		Tokenizer: tokenizer,
+	}
+}
+
+// Count implements the `Tokenizer` interface.
+func (plugin *PluginTokenizer) Count(ctx context.Context, text string) (int, error) {
+	count, err := plugin.Tokenizer.Count(ctx, plugin.Model, text)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count tokens: %w", err)
+	}
+
+	return count, nil
+}
+
+// Encode implements the `Tokenizer` interface.
+func (plugin *PluginTokenizer) Encode(ctx context.Context, text string) ([]int, error) {
+	tokens, err := plugin.Tokenizer.Encode(ctx, plugin.Model, text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode text: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// Decode implements the `Tokenizer` interface.
+func (plugin *PluginTokenizer) Decode(ctx context.Context, tokens []int) (string, error) {
+	text, err := plugin.Tokenizer.Decode(ctx, plugin.Model, tokens)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode tokens: %w", err)
+	}
+
+	return text, nil
+}
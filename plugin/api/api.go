@@ -30,10 +30,12 @@ func HandshakeConfig() plugin.HandshakeConfig {
 
 func Plugins() map[string]plugin.Plugin {
 	return map[string]plugin.Plugin{
-		"completion": NewCompletionPlugin(nil),
-		"embedding":  NewEmbeddingPlugin(nil),
-		"interfaces": NewInterfacesPlugin(nil),
-		"memory":     NewMemoryPlugin(nil),
+		"completion":  NewCompletionPlugin(nil),
+		"embedding":   NewEmbeddingPlugin(nil),
+		"interfaces":  NewInterfacesPlugin(nil),
+		"maintenance": NewMaintenancePlugin(nil),
+		"memory":      NewMemoryPlugin(nil),
+		"tokenizer":   NewTokenizerPlugin(nil),
 	}
 }
 
@@ -0,0 +1,136 @@
+//
+
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/lazygpt/lazygpt/plugin/log"
+)
+
+// EmbeddingStore persists the embeddings cached by `CachedEmbedding`.
+type EmbeddingStore interface {
+	// GetEmbedding returns the embedding stored under the key, or nil if
+	// there is none.
+	GetEmbedding(key string) ([]float32, error)
+
+	// SetEmbeddings stores each embedding under its key, at once.
+	SetEmbeddings(embeddings map[string][]float32) error
+}
+
+// EmbeddingKey returns the key of the embedding of the input by the model,
+// a hash of both so the key does not depend on the size of the input.
+func EmbeddingKey(model string, input string) string {
+	hash := sha256.New()
+	hash.Write([]byte(model))
+	hash.Write([]byte{0})
+	hash.Write([]byte(input))
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// CachedEmbedding is an `Embedding` that keeps the embeddings of another
+// `Embedding` in a store, so the same input is embedded by a model once.
+// Failing to use the store is logged and the input embedded as if it was not
+// cached.
+type CachedEmbedding struct {
+	Impl  Embedding
+	Store EmbeddingStore
+}
+
+var _ Embedding = (*CachedEmbedding)(nil)
+
+// NewCachedEmbedding returns a new CachedEmbedding of the embedding using the
+// store.
+func NewCachedEmbedding(embedding Embedding, store EmbeddingStore) *CachedEmbedding {
+	return &CachedEmbedding{
+		Impl:  embedding,
+		Store: store,
+	}
+}
+
+// Embedding implements the `Embedding` interface.
+func (cached *CachedEmbedding) Embedding(ctx context.Context, model string, input string) ([]float32, error) {
+	key := EmbeddingKey(model, input)
+
+	if embedding := cached.get(ctx, key); embedding != nil {
+		return embedding, nil
+	}
+
+	embedding, err := cached.Impl.Embedding(ctx, model, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed input: %w", err)
+	}
+
+	cached.set(ctx, map[string][]float32{key: embedding})
+
+	return embedding, nil
+}
+
+// EmbeddingBatch implements the `Embedding` interface. Only the inputs
+// missing from the store are embedded, in a single batch.
+func (cached *CachedEmbedding) EmbeddingBatch(
+	ctx context.Context,
+	model string,
+	inputs []string,
+) ([][]float32, error) {
+	embeddings := make([][]float32, len(inputs))
+	keys := make([]string, len(inputs))
+	missing := make([]int, 0, len(inputs))
+	uncached := make([]string, 0, len(inputs))
+
+	for idx, input := range inputs {
+		keys[idx] = EmbeddingKey(model, input)
+
+		if embeddings[idx] = cached.get(ctx, keys[idx]); embeddings[idx] == nil {
+			missing = append(missing, idx)
+			uncached = append(uncached, input)
+		}
+	}
+
+	if len(missing) == 0 {
+		return embeddings, nil
+	}
+
+	embedded, err := cached.Impl.EmbeddingBatch(ctx, model, uncached)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed inputs: %w", err)
+	}
+
+	if len(embedded) != len(uncached) {
+		return nil, fmt.Errorf("%w: %d embeddings for %d inputs", ErrEmbeddingCount, len(embedded), len(uncached))
+	}
+
+	stored := make(map[string][]float32, len(missing))
+
+	for idx, input := range missing {
+		embeddings[input] = embedded[idx]
+		stored[keys[input]] = embedded[idx]
+	}
+
+	cached.set(ctx, stored)
+
+	return embeddings, nil
+}
+
+// get returns the cached embedding of the key, or nil.
+func (cached *CachedEmbedding) get(ctx context.Context, key string) []float32 {
+	embedding, err := cached.Store.GetEmbedding(key)
+	if err != nil {
+		log.Warn(ctx, "Failed to get cached embedding", "error", err)
+
+		return nil
+	}
+
+	return embedding
+}
+
+// set caches each embedding under its key.
+func (cached *CachedEmbedding) set(ctx context.Context, embeddings map[string][]float32) {
+	if err := cached.Store.SetEmbeddings(embeddings); err != nil {
+		log.Warn(ctx, "Failed to cache embeddings", "error", err)
+	}
+}
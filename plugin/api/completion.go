@@ -18,8 +18,9 @@ type Message struct {
 // Completion is the interface that plugins must implement to provide
 // completion suggestions.
 type Completion interface {
-	// Complete returns a list of possible completions for the given input.
-	Complete(ctx context.Context, messages []Message) (*Message, Reason, error)
+	// Complete returns a list of possible completions for the given input
+	// using the named model.
+	Complete(ctx context.Context, model string, messages []Message) (*Message, Reason, error)
 }
 
 // NewCompletionPlugin returns a new CompletionPlugin.
@@ -65,7 +66,7 @@ func (s *CompletionGRPCServer) Complete(
 
 	ctx = InitLogging(ctx, "completion")
 
-	msg, reason, err := s.Impl.Complete(ctx, msgs)
+	msg, reason, err := s.Impl.Complete(ctx, req.Model, msgs)
 	if err != nil {
 		return nil, fmt.Errorf("completion failed: %w", err)
 	}
@@ -102,10 +103,12 @@ func NewCompletionGRPCClient(client CompletionClient) *CompletionGRPCClient {
 // Complete implements the gRPC client for the completion plugin.
 func (c *CompletionGRPCClient) Complete(
 	ctx context.Context,
+	model string,
 	messages []Message,
 ) (*Message, Reason, error) {
 	req := &CompletionRequest{
 		Messages: make([]*CompletionMessage, len(messages)),
+		Model:    model,
 	}
 
 	for idx := range messages {
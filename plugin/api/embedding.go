@@ -12,8 +12,14 @@ import (
 // Embedding is the interface that plugins must implement to provide
 // embedding functionality.
 type Embedding interface {
-	// Embedding returns the embedding for the given input.
-	Embedding(ctx context.Context, input string) ([]float32, error)
+	// Embedding returns the embedding of the input by the model, or by the
+	// default model of the plugin if model is empty. Embeddings of different
+	// models are not comparable.
+	Embedding(ctx context.Context, model string, input string) ([]float32, error)
+
+	// EmbeddingBatch returns the embeddings of the inputs by the model, in
+	// the order of the inputs, as by `Embedding`.
+	EmbeddingBatch(ctx context.Context, model string, inputs []string) ([][]float32, error)
 }
 
 // NewEmbeddingPlugin returns a new EmbeddingPlugin.
@@ -51,7 +57,7 @@ func (s *EmbeddingGRPCServer) Embedding(
 ) (*EmbeddingResponse, error) {
 	ctx = InitLogging(ctx, "embedding")
 
-	embedding, err := s.Impl.Embedding(ctx, req.Input)
+	embedding, err := s.Impl.Embedding(ctx, req.Model, req.Input)
 	if err != nil {
 		return nil, fmt.Errorf("embedding failed: %w", err)
 	}
@@ -61,6 +67,32 @@ func (s *EmbeddingGRPCServer) Embedding(
 	}, nil
 }
 
+// EmbeddingBatch implements the gRPC server for the embedding plugin batch
+// method.
+func (s *EmbeddingGRPCServer) EmbeddingBatch(
+	ctx context.Context,
+	req *EmbeddingBatchRequest,
+) (*EmbeddingBatchResponse, error) {
+	ctx = InitLogging(ctx, "embedding")
+
+	embeddings, err := s.Impl.EmbeddingBatch(ctx, req.Model, req.Inputs)
+	if err != nil {
+		return nil, fmt.Errorf("embedding batch failed: %w", err)
+	}
+
+	resp := &EmbeddingBatchResponse{
+		Embeddings: make([]*EmbeddingResponse, len(embeddings)),
+	}
+
+	for idx := range embeddings {
+		resp.Embeddings[idx] = &EmbeddingResponse{
+			Embedding: embeddings[idx],
+		}
+	}
+
+	return resp, nil
+}
+
 // EmbeddingGRPCClient is the gRPC client implementation of the plugin.
 type EmbeddingGRPCClient struct {
 	Client EmbeddingClient
@@ -78,10 +110,12 @@ func NewEmbeddingGRPCClient(client EmbeddingClient) *EmbeddingGRPCClient {
 // Embedding implements the gRPC client for the embedding plugin.
 func (c *EmbeddingGRPCClient) Embedding(
 	ctx context.Context,
+	model string,
 	input string,
 ) ([]float32, error) {
 	req := &EmbeddingRequest{
 		Input: input,
+		Model: model,
 	}
 
 	resp, err := c.Client.Embedding(ctx, req)
@@ -91,3 +125,28 @@ func (c *EmbeddingGRPCClient) Embedding(
 
 	return resp.Embedding, nil
 }
+
+// EmbeddingBatch implements the gRPC client for the embedding plugin. If the
+// plugin does not support batches, the error wraps `ErrUnimplemented`.
+func (c *EmbeddingGRPCClient) EmbeddingBatch(
+	ctx context.Context,
+	model string,
+	inputs []string,
+) ([][]float32, error) {
+	req := &EmbeddingBatchRequest{
+		Inputs: inputs,
+		Model:  model,
+	}
+
+	resp, err := c.Client.EmbeddingBatch(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("embedding batch failed: %w", unimplemented(err))
+	}
+
+	embeddings := make([][]float32, len(resp.Embeddings))
+	for idx := range resp.Embeddings {
+		embeddings[idx] = resp.Embeddings[idx].Embedding
+	}
+
+	return embeddings, nil
+}
@@ -2,7 +2,59 @@
 
 package api
 
-import "errors"
+import (
+	"errors"
+	"fmt"
 
-// ErrNotGRPC is returned when a plugin is not a gRPC plugin.
-var ErrNotGRPC = errors.New("only gRPC plugins supported")
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrNotGRPC is returned when a plugin is not a gRPC plugin.
+	ErrNotGRPC = errors.New("only gRPC plugins supported")
+
+	// ErrUnimplemented is returned when a plugin does not implement a method,
+	// usually because it was built against an older protocol.
+	ErrUnimplemented = errors.New("method not implemented by plugin")
+
+	// ErrNotFound is returned when a plugin does not have the requested
+	// item.
+	ErrNotFound = errors.New("not found")
+
+	// ErrNoRecord is returned when a memory request or response is missing
+	// its record.
+	ErrNoRecord = errors.New("no record")
+
+	// ErrEmbeddingCount is returned when an embedding plugin does not return
+	// an embedding for each input.
+	ErrEmbeddingCount = errors.New("unexpected number of embeddings")
+)
+
+// unimplemented returns `ErrUnimplemented` if the gRPC error is due to the
+// method not being implemented, `ErrNotFound` if the item was not found,
+// otherwise the error is returned as is.
+func unimplemented(err error) error {
+	switch status.Code(err) { //nolint:exhaustive // other codes are returned as is
+	case codes.Unimplemented:
+		return ErrUnimplemented
+	case codes.NotFound:
+		return fmt.Errorf("%w: %s", ErrNotFound, status.Convert(err).Message())
+	default:
+		return err
+	}
+}
+
+// grpcError returns the error as a gRPC status error so the client can tell
+// when an item was not found, or the request was missing its record. Any other
+// error keeps the status it wraps, if it has one.
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrNoRecord):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return err
+	}
+}
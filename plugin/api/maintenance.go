@@ -0,0 +1,269 @@
+//
+
+package api
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"google.golang.org/grpc"
+)
+
+// ChunkSize is the maximum size of the chunks of a backup streamed between
+// the plugin and the host.
+const ChunkSize = 1 << 20
+
+// Compaction reports the size of the storage of a plugin around a compaction.
+type Compaction struct {
+	// Before is the size in bytes before the compaction.
+	Before int64
+
+	// After is the size in bytes after the compaction.
+	After int64
+}
+
+// Maintenance is the interface that plugins storing data may implement to
+// back up, restore and compact their storage while they run.
+type Maintenance interface {
+	// Backup writes a backup of the storage to the writer.
+	Backup(ctx context.Context, writer io.Writer) error
+
+	// Restore replaces the storage with the backup read from the reader.
+	Restore(ctx context.Context, reader io.Reader) error
+
+	// Compact reclaims the space of the storage taken by deleted and
+	// overwritten data.
+	Compact(ctx context.Context) (*Compaction, error)
+}
+
+// NewMaintenancePlugin returns a new MaintenancePlugin.
+func NewMaintenancePlugin(maintenance Maintenance) *Plugin {
+	return NewPlugin(
+		func(srv *grpc.Server) {
+			RegisterMaintenanceServer(srv, NewMaintenanceGRPCServer(maintenance))
+		},
+		func(client *grpc.ClientConn) (interface{}, error) {
+			return NewMaintenanceGRPCClient(NewMaintenanceClient(client)), nil
+		},
+	)
+}
+
+// MaintenanceGRPCServer is the gRPC server implementation of the plugin.
+type MaintenanceGRPCServer struct {
+	UnimplementedMaintenanceServer
+
+	Impl Maintenance
+}
+
+var _ MaintenanceServer = (*MaintenanceGRPCServer)(nil)
+
+// NewMaintenanceGRPCServer returns a new MaintenanceGRPCServer.
+func NewMaintenanceGRPCServer(impl Maintenance) *MaintenanceGRPCServer {
+	return &MaintenanceGRPCServer{
+		Impl: impl,
+	}
+}
+
+// Backup implements the gRPC server for the maintenance plugin backup method.
+func (s *MaintenanceGRPCServer) Backup(
+	_ *BackupRequest,
+	stream Maintenance_BackupServer,
+) error {
+	ctx := InitLogging(stream.Context(), "backup")
+
+	// NOTE(jkoelker) Backups are written in many small pieces, buffer them
+	//                into chunks rather than sending a message for each.
+	writer := bufio.NewWriterSize(&backupWriter{stream: stream}, ChunkSize)
+
+	if err := s.Impl.Backup(ctx, writer); err != nil {
+		return fmt.Errorf("backup failed: %w", err)
+	}
+
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("backup failed: %w", err)
+	}
+
+	return nil
+}
+
+// Restore implements the gRPC server for the maintenance plugin restore
+// method.
+func (s *MaintenanceGRPCServer) Restore(stream Maintenance_RestoreServer) error {
+	ctx := InitLogging(stream.Context(), "restore")
+
+	if err := s.Impl.Restore(ctx, &restoreReader{stream: stream}); err != nil {
+		return fmt.Errorf("restore failed: %w", err)
+	}
+
+	if err := stream.SendAndClose(&RestoreResponse{}); err != nil {
+		return fmt.Errorf("restore failed: %w", err)
+	}
+
+	return nil
+}
+
+// Compact implements the gRPC server for the maintenance plugin compact
+// method.
+func (s *MaintenanceGRPCServer) Compact(
+	ctx context.Context,
+	_ *CompactRequest,
+) (*CompactResponse, error) {
+	ctx = InitLogging(ctx, "compact")
+
+	compaction, err := s.Impl.Compact(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("compact failed: %w", err)
+	}
+
+	return &CompactResponse{
+		SizeBefore: compaction.Before,
+		SizeAfter:  compaction.After,
+	}, nil
+}
+
+// backupWriter sends what is written to it as chunks of a backup stream.
+type backupWriter struct {
+	stream Maintenance_BackupServer
+}
+
+// Write implements `io.Writer`.
+func (writer *backupWriter) Write(data []byte) (int, error) {
+	written := 0
+
+	for written < len(data) {
+		end := len(data)
+		if end-written > ChunkSize {
+			end = written + ChunkSize
+		}
+
+		if err := writer.stream.Send(&BackupChunk{Data: data[written:end]}); err != nil {
+			return written, fmt.Errorf("failed to send backup chunk: %w", err)
+		}
+
+		written = end
+	}
+
+	return written, nil
+}
+
+// restoreReader reads the chunks of a restore stream.
+type restoreReader struct {
+	stream  Maintenance_RestoreServer
+	pending []byte
+}
+
+// Read implements `io.Reader`.
+func (reader *restoreReader) Read(data []byte) (int, error) {
+	for len(reader.pending) == 0 {
+		chunk, err := reader.stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return 0, io.EOF
+		}
+
+		if err != nil {
+			return 0, fmt.Errorf("failed to receive restore chunk: %w", err)
+		}
+
+		reader.pending = chunk.Data
+	}
+
+	read := copy(data, reader.pending)
+	reader.pending = reader.pending[read:]
+
+	return read, nil
+}
+
+// MaintenanceGRPCClient is the gRPC client implementation of the plugin.
+type MaintenanceGRPCClient struct {
+	Client MaintenanceClient
+}
+
+var _ Maintenance = (*MaintenanceGRPCClient)(nil)
+
+// NewMaintenanceGRPCClient returns a new MaintenanceGRPCClient.
+func NewMaintenanceGRPCClient(client MaintenanceClient) *MaintenanceGRPCClient {
+	return &MaintenanceGRPCClient{
+		Client: client,
+	}
+}
+
+// Backup implements the gRPC client for the maintenance plugin.
+func (c *MaintenanceGRPCClient) Backup(ctx context.Context, writer io.Writer) error {
+	stream, err := c.Client.Backup(ctx, &BackupRequest{})
+	if err != nil {
+		return fmt.Errorf("backup failed: %w", unimplemented(err))
+	}
+
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("backup failed: %w", unimplemented(err))
+		}
+
+		if _, err := writer.Write(chunk.Data); err != nil {
+			return fmt.Errorf("failed to write backup: %w", err)
+		}
+	}
+}
+
+// Restore implements the gRPC client for the maintenance plugin.
+func (c *MaintenanceGRPCClient) Restore(ctx context.Context, reader io.Reader) error {
+	stream, err := c.Client.Restore(ctx)
+	if err != nil {
+		return fmt.Errorf("restore failed: %w", unimplemented(err))
+	}
+
+	buffer := make([]byte, ChunkSize)
+
+	for {
+		read, err := io.ReadFull(reader, buffer)
+		if read > 0 {
+			// NOTE(jkoelker) The server stopped reading if sending fails
+			//                with `io.EOF`, its error is returned by
+			//                `CloseAndRecv`.
+			if err := stream.Send(&RestoreChunk{Data: buffer[:read]}); err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+
+				return fmt.Errorf("restore failed: %w", unimplemented(err))
+			}
+		}
+
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+
+		if err != nil {
+			_ = stream.CloseSend()
+
+			return fmt.Errorf("failed to read backup: %w", err)
+		}
+	}
+
+	if _, err := stream.CloseAndRecv(); err != nil {
+		return fmt.Errorf("restore failed: %w", unimplemented(err))
+	}
+
+	return nil
+}
+
+// Compact implements the gRPC client for the maintenance plugin.
+func (c *MaintenanceGRPCClient) Compact(ctx context.Context) (*Compaction, error) {
+	resp, err := c.Client.Compact(ctx, &CompactRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("compact failed: %w", unimplemented(err))
+	}
+
+	return &Compaction{
+		Before: resp.SizeBefore,
+		After:  resp.SizeAfter,
+	}, nil
+}
@@ -5,19 +5,295 @@ package api
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+const (
+	// MetadataSource is the metadata key of where a memory came from.
+	MetadataSource = "source"
+
+	// MetadataDocument is the metadata key of the id of the document a
+	// memory is a chunk of.
+	MetadataDocument = "document"
+
+	// MetadataChunk is the metadata key of the index of the chunk of the
+	// document a memory is, from 0.
+	MetadataChunk = "chunk"
+
+	// DefaultNamespace is the namespace of memories memorized without one.
+	DefaultNamespace = "default"
+
+	// AllNamespaces selects the memories of every namespace when recalling,
+	// listing or clearing.
+	AllNamespaces = "*"
+
+	// DefaultImportance is the importance of memories memorized without one.
+	DefaultImportance = 0.5
+
+	// DefaultHalfLife is the time after which the recency of a memory that
+	// was not recalled is halved.
+	DefaultHalfLife = 7 * 24 * time.Hour
+
+	// DefaultFusionK is the rank constant of reciprocal rank fusion, the
+	// larger it is the less the top ranks dominate.
+	DefaultFusionK = 60
+)
+
+// Namespace returns the namespace, or `DefaultNamespace` if it is empty.
+func Namespace(namespace string) string {
+	if namespace == "" {
+		return DefaultNamespace
+	}
+
+	return namespace
+}
+
+// Record is a memory to memorize or returned by a recall.
+type Record struct {
+	// ID uniquely identifies the memory in the plugin. It is assigned by the
+	// plugin when memorizing.
+	ID string
+
+	// Data is the memorized data.
+	Data string
+
+	// Score is the similarity of the memory to the query, higher is more
+	// similar.
+	Score float32
+
+	// Created is when the memory was memorized, zero if unknown. When
+	// memorizing, a zero value is the time of the memorization.
+	Created time.Time
+
+	// Metadata of the memory.
+	Metadata map[string]string
+
+	// Namespace the memory is in, memories are only recalled from the
+	// namespaces of the query. An empty namespace is `DefaultNamespace`.
+	Namespace string
+
+	// Vector is the embedding of the data. It is only returned when listing
+	// with `ListOptions.Vectors`. When memorizing, a vector is stored as is
+	// instead of embedding the data.
+	Vector []float32
+
+	// Model is the name of the model that embedded the data.
+	Model string
+
+	// Importance of the memory, from 0 to 1. When memorizing, zero is
+	// `DefaultImportance`.
+	Importance float32
+
+	// Accessed is when the memory was last recalled, zero if never.
+	Accessed time.Time
+
+	// Expires is when the memory is forgotten, zero if never.
+	Expires time.Time
+
+	// Neighbors are the chunks of the document of the memory around it, in
+	// the order of the document. They are only returned when recalling with
+	// `Query.Neighbors`.
+	Neighbors []Record
+}
+
+// Chunk returns the id of the document the memory is a chunk of and the
+// index of the chunk, false if the memory is not a chunk of a document.
+func (record *Record) Chunk() (string, int, bool) {
+	return DocumentChunk(record.Metadata)
+}
+
+// DocumentChunk returns the id of the document and the index of the chunk in
+// the metadata, false if they are missing or invalid.
+func DocumentChunk(metadata map[string]string) (string, int, bool) {
+	document := metadata[MetadataDocument]
+	if document == "" {
+		return "", 0, false
+	}
+
+	chunk, err := strconv.Atoi(metadata[MetadataChunk])
+	if err != nil || chunk < 0 {
+		return "", 0, false
+	}
+
+	return document, chunk, true
+}
+
+// Ranking weighs the similarity, recency and importance of the memories into
+// the score they are recalled by. The score is the weighted mean of the
+// three, each from 0 to 1 except the similarity which depends on the metric
+// of the plugin. The recency decays from 1 exponentially since the memory was
+// last recalled, or created, halving every half life.
+type Ranking struct {
+	Similarity float32
+	Recency    float32
+	Importance float32
+	HalfLife   time.Duration
+}
+
+// DefaultRanking returns the ranking of queries without one, weighing the
+// similarity, recency and importance equally.
+func DefaultRanking() Ranking {
+	return Ranking{
+		Similarity: 1,
+		Recency:    1,
+		Importance: 1,
+		HalfLife:   DefaultHalfLife,
+	}
+}
+
+// SimilarityRanking returns a ranking by similarity only.
+func SimilarityRanking() Ranking {
+	return Ranking{Similarity: 1}
+}
+
+// Fusion weighs the vector and keyword searches of a recall, whose rankings
+// are merged by reciprocal rank fusion: each memory scores the weight of each
+// search over K plus its rank in the search. A zero weight disables the
+// search, without keyword search the memories are scored by similarity.
+type Fusion struct {
+	Vector  float32
+	Keyword float32
+	K       int
+}
+
+// DefaultFusion returns a fusion weighing the vector and keyword searches
+// equally.
+func DefaultFusion() Fusion {
+	return Fusion{
+		Vector:  1,
+		Keyword: 1,
+		K:       DefaultFusionK,
+	}
+}
+
+// VectorFusion returns a fusion searching by vector only.
+func VectorFusion() Fusion {
+	return Fusion{Vector: 1, K: DefaultFusionK}
+}
+
+// Page is a page of listed memories.
+type Page struct {
+	// Records of the page, in the order the plugin lists them.
+	Records []Record
+
+	// Next is the cursor of the next page, empty on the last page.
+	Next string
+}
+
+// ListOptions describes the memories to list.
+type ListOptions struct {
+	// Namespace to list the memories of, `AllNamespaces` lists the memories
+	// of every namespace.
+	Namespace string
+
+	// Cursor of the first memory to list, empty starts at the first memory.
+	Cursor string
+
+	// Limit is the maximum number of memories to list, if zero the plugin
+	// chooses the page size.
+	Limit int
+
+	// Vectors requests the vectors of the memories.
+	Vectors bool
+}
+
+// Query describes the memories to recall.
+type Query struct {
+	// Data to recall the closest memories of.
+	Data string
+
+	// Count of memories to return, if zero a single memory is returned.
+	Count int
+
+	// MinScore is the minimum score of the returned memories.
+	MinScore float32
+
+	// Metadata the memories must have, every key must match the value.
+	Metadata map[string]string
+
+	// Namespaces to recall the memories from. If empty, memories are
+	// recalled from `DefaultNamespace`, and `AllNamespaces` recalls from
+	// every namespace.
+	Namespaces []string
+
+	// Ranking of the recalled memories, if nil `DefaultRanking` is used.
+	// The minimum score applies to the ranked score.
+	Ranking *Ranking
+
+	// Fusion of the vector and keyword searches, if nil the plugin chooses.
+	Fusion *Fusion
+
+	// Neighbors is the number of chunks before and after each recalled
+	// chunk of a document returned with it.
+	Neighbors int
+}
+
+// InNamespace returns true if memories of the namespace are recalled by the
+// query.
+func (query *Query) InNamespace(namespace string) bool {
+	if len(query.Namespaces) == 0 {
+		return Namespace(namespace) == DefaultNamespace
+	}
+
+	for _, candidate := range query.Namespaces {
+		if candidate == AllNamespaces || Namespace(candidate) == Namespace(namespace) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Matches returns true if the metadata contains every key and value of the
+// query metadata.
+func (query *Query) Matches(metadata map[string]string) bool {
+	for key, value := range query.Metadata {
+		if metadata[key] != value {
+			return false
+		}
+	}
+
+	return true
+}
+
 // Memory is the interface that plugins must implement to provide
 // memory functionality.
 type Memory interface {
-	// Memorize memorizes each data string.
-	Memorize(ctx context.Context, data []string) error
+	// Memorize memorizes the data and metadata of each record, returning the
+	// ids of the new memories in the order of the records.
+	Memorize(ctx context.Context, records []Record) ([]string, error)
+
+	// Recall recalls the memories closest to the query data, most similar
+	// first.
+	Recall(ctx context.Context, query Query) ([]Record, error)
 
-	// Recall recalls the memory closest to the data string. If a count is
-	// specified, it returns the count closest memories.
-	Recall(ctx context.Context, data string, count ...int) ([]string, error)
+	// RecallBatch recalls the memories of each query, returning the records
+	// in the order of the queries.
+	RecallBatch(ctx context.Context, queries []Query) ([][]Record, error)
+
+	// List returns a page of the memories described by the options.
+	List(ctx context.Context, options ListOptions) (*Page, error)
+
+	// Get returns the memory with the id. If there is no such memory the
+	// error wraps `ErrNotFound`.
+	Get(ctx context.Context, id string) (*Record, error)
+
+	// Update replaces the data and metadata of the memory with the record
+	// id, empty data or nil metadata keeps those of the memory. If there is
+	// no such memory the error wraps `ErrNotFound`.
+	Update(ctx context.Context, record Record) error
+
+	// Delete forgets the memories with the ids. If any memory does not exist
+	// the error wraps `ErrNotFound`.
+	Delete(ctx context.Context, ids []string) error
+
+	// Clear forgets all the memories of the namespace.
+	Clear(ctx context.Context, namespace string) error
 }
 
 // NewMemoryPlugin returns a new MemoryPlugin.
@@ -55,11 +331,17 @@ func (s *MemoryGRPCServer) Memorize(
 ) (*MemorizeResponse, error) {
 	ctx = InitLogging(ctx, "memorize")
 
-	if err := s.Impl.Memorize(ctx, req.Data); err != nil {
-		return nil, fmt.Errorf("memorize failed: %w", err)
+	records := make([]Record, len(req.Records))
+	for idx := range req.Records {
+		records[idx] = RecordFromProto(req.Records[idx])
+	}
+
+	ids, err := s.Impl.Memorize(ctx, records)
+	if err != nil {
+		return nil, grpcError(fmt.Errorf("memorize failed: %w", err))
 	}
 
-	return &MemorizeResponse{}, nil
+	return &MemorizeResponse{Ids: ids}, nil
 }
 
 // Recall implements the gRPC server for the memory plugin recall method.
@@ -69,14 +351,154 @@ func (s *MemoryGRPCServer) Recall(
 ) (*RecallResponse, error) {
 	ctx = InitLogging(ctx, "recall")
 
-	memory, err := s.Impl.Recall(ctx, req.Data, int(req.Count))
+	records, err := s.Impl.Recall(ctx, QueryFromProto(req))
 	if err != nil {
-		return nil, fmt.Errorf("recall failed: %w", err)
+		return nil, grpcError(fmt.Errorf("recall failed: %w", err))
+	}
+
+	return recallResponse(records), nil
+}
+
+// RecallBatch implements the gRPC server for the memory plugin recall batch
+// method.
+func (s *MemoryGRPCServer) RecallBatch(
+	ctx context.Context,
+	req *RecallBatchRequest,
+) (*RecallBatchResponse, error) {
+	ctx = InitLogging(ctx, "recall-batch")
+
+	queries := make([]Query, len(req.Queries))
+	for idx := range req.Queries {
+		queries[idx] = QueryFromProto(req.Queries[idx])
+	}
+
+	results, err := s.Impl.RecallBatch(ctx, queries)
+	if err != nil {
+		return nil, grpcError(fmt.Errorf("recall batch failed: %w", err))
+	}
+
+	resp := &RecallBatchResponse{
+		Results: make([]*RecallResponse, len(results)),
+	}
+
+	for idx := range results {
+		resp.Results[idx] = recallResponse(results[idx])
+	}
+
+	return resp, nil
+}
+
+// List implements the gRPC server for the memory plugin list method.
+func (s *MemoryGRPCServer) List(
+	ctx context.Context,
+	req *ListMemoriesRequest,
+) (*ListMemoriesResponse, error) {
+	ctx = InitLogging(ctx, "list")
+
+	page, err := s.Impl.List(ctx, ListOptions{
+		Namespace: req.Namespace,
+		Cursor:    req.Cursor,
+		Limit:     int(req.Limit),
+		Vectors:   req.Vectors,
+	})
+	if err != nil {
+		return nil, grpcError(fmt.Errorf("list failed: %w", err))
+	}
+
+	resp := &ListMemoriesResponse{
+		Records: make([]*MemoryRecord, len(page.Records)),
+		Next:    page.Next,
+	}
+
+	for idx := range page.Records {
+		resp.Records[idx] = RecordToProto(&page.Records[idx])
+	}
+
+	return resp, nil
+}
+
+// Get implements the gRPC server for the memory plugin get method.
+func (s *MemoryGRPCServer) Get(
+	ctx context.Context,
+	req *GetMemoryRequest,
+) (*GetMemoryResponse, error) {
+	ctx = InitLogging(ctx, "get")
+
+	record, err := s.Impl.Get(ctx, req.Id)
+	if err != nil {
+		return nil, grpcError(fmt.Errorf("get failed: %w", err))
+	}
+
+	return &GetMemoryResponse{Record: RecordToProto(record)}, nil
+}
+
+// Update implements the gRPC server for the memory plugin update method.
+func (s *MemoryGRPCServer) Update(
+	ctx context.Context,
+	req *UpdateMemoryRequest,
+) (*UpdateMemoryResponse, error) {
+	ctx = InitLogging(ctx, "update")
+
+	if req.Record == nil {
+		return nil, grpcError(fmt.Errorf("update failed: %w", ErrNoRecord))
+	}
+
+	if err := s.Impl.Update(ctx, RecordFromProto(req.Record)); err != nil {
+		return nil, grpcError(fmt.Errorf("update failed: %w", err))
+	}
+
+	return &UpdateMemoryResponse{}, nil
+}
+
+// Delete implements the gRPC server for the memory plugin delete method.
+func (s *MemoryGRPCServer) Delete(
+	ctx context.Context,
+	req *DeleteMemoriesRequest,
+) (*DeleteMemoriesResponse, error) {
+	ctx = InitLogging(ctx, "delete")
+
+	if err := s.Impl.Delete(ctx, req.Ids); err != nil {
+		return nil, grpcError(fmt.Errorf("delete failed: %w", err))
+	}
+
+	return &DeleteMemoriesResponse{}, nil
+}
+
+// Clear implements the gRPC server for the memory plugin clear method.
+func (s *MemoryGRPCServer) Clear(
+	ctx context.Context,
+	req *ClearMemoriesRequest,
+) (*ClearMemoriesResponse, error) {
+	ctx = InitLogging(ctx, "clear")
+
+	if err := s.Impl.Clear(ctx, req.Namespace); err != nil {
+		return nil, grpcError(fmt.Errorf("clear failed: %w", err))
 	}
 
-	return &RecallResponse{
-		Data: memory,
-	}, nil
+	return &ClearMemoriesResponse{}, nil
+}
+
+// recallResponse converts records to a recall response.
+func recallResponse(records []Record) *RecallResponse {
+	resp := &RecallResponse{
+		Records: make([]*MemoryRecord, len(records)),
+	}
+
+	for idx := range records {
+		resp.Records[idx] = RecordToProto(&records[idx])
+	}
+
+	return resp
+}
+
+// recallRecords converts a recall response to records.
+func recallRecords(resp *RecallResponse) []Record {
+	records := make([]Record, len(resp.Records))
+	for idx := range resp.Records {
+		records[idx] = RecordFromProto(resp.Records[idx])
+	}
+
+	return records
 }
 
 // MemoryGRPCClient is the gRPC client implementation of the plugin.
@@ -96,39 +518,268 @@ func NewMemoryGRPCClient(client MemoryClient) *MemoryGRPCClient {
 // Memorize implements the gRPC client for the memory plugin.
 func (c *MemoryGRPCClient) Memorize(
 	ctx context.Context,
-	data []string,
-) error {
+	records []Record,
+) ([]string, error) {
 	req := &MemorizeRequest{
-		Data: data,
+		Records: make([]*MemoryRecord, len(records)),
 	}
 
-	_, err := c.Client.Memorize(ctx, req)
+	for idx := range records {
+		req.Records[idx] = RecordToProto(&records[idx])
+	}
+
+	resp, err := c.Client.Memorize(ctx, req)
 	if err != nil {
-		return fmt.Errorf("memory failed: %w", err)
+		return nil, fmt.Errorf("memory failed: %w", err)
 	}
 
-	return nil
+	return resp.Ids, nil
 }
 
 // Recall implements the gRPC client for the memory plugin.
 func (c *MemoryGRPCClient) Recall(
 	ctx context.Context,
-	data string,
-	count ...int,
-) ([]string, error) {
-	req := &RecallRequest{
-		Data:  data,
-		Count: 1,
+	query Query,
+) ([]Record, error) {
+	resp, err := c.Client.Recall(ctx, QueryToProto(&query))
+	if err != nil {
+		return nil, fmt.Errorf("recall failed: %w", err)
+	}
+
+	return recallRecords(resp), nil
+}
+
+// RecallBatch implements the gRPC client for the memory plugin. If the
+// plugin does not support batches, the error wraps `ErrUnimplemented`.
+func (c *MemoryGRPCClient) RecallBatch(
+	ctx context.Context,
+	queries []Query,
+) ([][]Record, error) {
+	req := &RecallBatchRequest{
+		Queries: make([]*RecallRequest, len(queries)),
 	}
 
-	if len(count) > 0 {
-		req.Count = int32(count[0])
+	for idx := range queries {
+		req.Queries[idx] = QueryToProto(&queries[idx])
 	}
 
-	resp, err := c.Client.Recall(ctx, req)
+	resp, err := c.Client.RecallBatch(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("recall failed: %w", err)
+		return nil, fmt.Errorf("recall batch failed: %w", unimplemented(err))
+	}
+
+	results := make([][]Record, len(resp.Results))
+	for idx := range resp.Results {
+		results[idx] = recallRecords(resp.Results[idx])
+	}
+
+	return results, nil
+}
+
+// List implements the gRPC client for the memory plugin.
+func (c *MemoryGRPCClient) List(
+	ctx context.Context,
+	options ListOptions,
+) (*Page, error) {
+	resp, err := c.Client.List(ctx, &ListMemoriesRequest{
+		Namespace: options.Namespace,
+		Cursor:    options.Cursor,
+		Limit:     int32(options.Limit),
+		Vectors:   options.Vectors,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list failed: %w", unimplemented(err))
+	}
+
+	page := &Page{
+		Records: make([]Record, len(resp.Records)),
+		Next:    resp.Next,
+	}
+
+	for idx := range resp.Records {
+		page.Records[idx] = RecordFromProto(resp.Records[idx])
+	}
+
+	return page, nil
+}
+
+// Get implements the gRPC client for the memory plugin.
+func (c *MemoryGRPCClient) Get(
+	ctx context.Context,
+	id string,
+) (*Record, error) {
+	resp, err := c.Client.Get(ctx, &GetMemoryRequest{Id: id})
+	if err != nil {
+		return nil, fmt.Errorf("get failed: %w", unimplemented(err))
+	}
+
+	if resp.Record == nil {
+		return nil, fmt.Errorf("get failed: %w", ErrNoRecord)
+	}
+
+	record := RecordFromProto(resp.Record)
+
+	return &record, nil
+}
+
+// Update implements the gRPC client for the memory plugin.
+func (c *MemoryGRPCClient) Update(
+	ctx context.Context,
+	record Record,
+) error {
+	if _, err := c.Client.Update(ctx, &UpdateMemoryRequest{
+		Record: RecordToProto(&record),
+	}); err != nil {
+		return fmt.Errorf("update failed: %w", unimplemented(err))
+	}
+
+	return nil
+}
+
+// Delete implements the gRPC client for the memory plugin.
+func (c *MemoryGRPCClient) Delete(
+	ctx context.Context,
+	ids []string,
+) error {
+	if _, err := c.Client.Delete(ctx, &DeleteMemoriesRequest{Ids: ids}); err != nil {
+		return fmt.Errorf("delete failed: %w", unimplemented(err))
+	}
+
+	return nil
+}
+
+// Clear implements the gRPC client for the memory plugin.
+func (c *MemoryGRPCClient) Clear(ctx context.Context, namespace string) error {
+	if _, err := c.Client.Clear(ctx, &ClearMemoriesRequest{Namespace: namespace}); err != nil {
+		return fmt.Errorf("clear failed: %w", unimplemented(err))
+	}
+
+	return nil
+}
+
+// QueryToProto converts a query to its protocol message.
+func QueryToProto(query *Query) *RecallRequest {
+	req := &RecallRequest{
+		Data:       query.Data,
+		Count:      int32(query.Count),
+		MinScore:   query.MinScore,
+		Metadata:   query.Metadata,
+		Namespaces: query.Namespaces,
+		Neighbors:  int32(query.Neighbors),
+	}
+
+	if query.Ranking != nil {
+		req.Ranking = &RecallRanking{
+			Similarity: query.Ranking.Similarity,
+			Recency:    query.Ranking.Recency,
+			Importance: query.Ranking.Importance,
+			HalfLife:   durationpb.New(query.Ranking.HalfLife),
+		}
+	}
+
+	if query.Fusion != nil {
+		req.Fusion = &RecallFusion{
+			Vector:  query.Fusion.Vector,
+			Keyword: query.Fusion.Keyword,
+			K:       int32(query.Fusion.K),
+		}
+	}
+
+	return req
+}
+
+// QueryFromProto converts a protocol message to a query.
+func QueryFromProto(req *RecallRequest) Query {
+	query := Query{
+		Data:       req.Data,
+		Count:      int(req.Count),
+		MinScore:   req.MinScore,
+		Metadata:   req.Metadata,
+		Namespaces: req.Namespaces,
+		Neighbors:  int(req.Neighbors),
+	}
+
+	if req.Ranking != nil {
+		query.Ranking = &Ranking{
+			Similarity: req.Ranking.Similarity,
+			Recency:    req.Ranking.Recency,
+			Importance: req.Ranking.Importance,
+			HalfLife:   req.Ranking.HalfLife.AsDuration(),
+		}
+	}
+
+	if req.Fusion != nil {
+		query.Fusion = &Fusion{
+			Vector:  req.Fusion.Vector,
+			Keyword: req.Fusion.Keyword,
+			K:       int(req.Fusion.K),
+		}
+	}
+
+	return query
+}
+
+// RecordToProto converts a record to its protocol message.
+func RecordToProto(record *Record) *MemoryRecord {
+	message := &MemoryRecord{
+		Id:         record.ID,
+		Data:       record.Data,
+		Score:      record.Score,
+		Metadata:   record.Metadata,
+		Namespace:  record.Namespace,
+		Vector:     record.Vector,
+		Model:      record.Model,
+		Importance: record.Importance,
+	}
+
+	if !record.Created.IsZero() {
+		message.Created = timestamppb.New(record.Created)
+	}
+
+	if !record.Accessed.IsZero() {
+		message.Accessed = timestamppb.New(record.Accessed)
+	}
+
+	if !record.Expires.IsZero() {
+		message.Expires = timestamppb.New(record.Expires)
+	}
+
+	for idx := range record.Neighbors {
+		message.Neighbors = append(message.Neighbors, RecordToProto(&record.Neighbors[idx]))
+	}
+
+	return message
+}
+
+// RecordFromProto converts a protocol message to a record, a nil message is
+// an empty record.
+func RecordFromProto(message *MemoryRecord) Record {
+	record := Record{
+		ID:         message.GetId(),
+		Data:       message.GetData(),
+		Score:      message.GetScore(),
+		Metadata:   message.GetMetadata(),
+		Namespace:  message.GetNamespace(),
+		Vector:     message.GetVector(),
+		Model:      message.GetModel(),
+		Importance: message.GetImportance(),
+	}
+
+	if created := message.GetCreated(); created != nil {
+		record.Created = created.AsTime()
+	}
+
+	if accessed := message.GetAccessed(); accessed != nil {
+		record.Accessed = accessed.AsTime()
+	}
+
+	if expires := message.GetExpires(); expires != nil {
+		record.Expires = expires.AsTime()
+	}
+
+	for _, neighbor := range message.GetNeighbors() {
+		record.Neighbors = append(record.Neighbors, RecordFromProto(neighbor))
 	}
 
-	return resp.Data, nil
+	return record
 }
@@ -0,0 +1,193 @@
+//
+
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+)
+
+// Tokenizer is the interface that plugins must implement to provide
+// tokenization for the models they complete with.
+type Tokenizer interface {
+	// Count returns the number of tokens in the text for the model.
+	Count(ctx context.Context, model string, text string) (int, error)
+
+	// Encode returns the tokens of the text for the model.
+	Encode(ctx context.Context, model string, text string) ([]int, error)
+
+	// Decode returns the text of the tokens for the model.
+	Decode(ctx context.Context, model string, tokens []int) (string, error)
+}
+
+// NewTokenizerPlugin returns a new TokenizerPlugin.
+func NewTokenizerPlugin(tokenizer Tokenizer) *Plugin {
+	return NewPlugin(
+		func(srv *grpc.Server) {
+			RegisterTokenizerServer(srv, NewTokenizerGRPCServer(tokenizer))
+		},
+		func(client *grpc.ClientConn) (interface{}, error) {
+			return NewTokenizerGRPCClient(NewTokenizerClient(client)), nil
+		},
+	)
+}
+
+// TokenizerGRPCServer is the gRPC server implementation of the plugin.
+type TokenizerGRPCServer struct {
+	UnimplementedTokenizerServer
+
+	Impl Tokenizer
+}
+
+var _ TokenizerServer = (*TokenizerGRPCServer)(nil)
+
+// NewTokenizerGRPCServer returns a new TokenizerGRPCServer.
+func NewTokenizerGRPCServer(impl Tokenizer) *TokenizerGRPCServer {
+	return &TokenizerGRPCServer{
+		Impl: impl,
+	}
+}
+
+// Count implements the gRPC server for the tokenizer plugin count method.
+func (s *TokenizerGRPCServer) Count(
+	ctx context.Context,
+	req *TokenizeRequest,
+) (*CountResponse, error) {
+	ctx = InitLogging(ctx, "count")
+
+	count, err := s.Impl.Count(ctx, req.Model, req.Text)
+	if err != nil {
+		return nil, fmt.Errorf("count failed: %w", err)
+	}
+
+	return &CountResponse{
+		Count: int32(count),
+	}, nil
+}
+
+// Encode implements the gRPC server for the tokenizer plugin encode method.
+func (s *TokenizerGRPCServer) Encode(
+	ctx context.Context,
+	req *TokenizeRequest,
+) (*EncodeResponse, error) {
+	ctx = InitLogging(ctx, "encode")
+
+	tokens, err := s.Impl.Encode(ctx, req.Model, req.Text)
+	if err != nil {
+		return nil, fmt.Errorf("encode failed: %w", err)
+	}
+
+	resp := &EncodeResponse{
+		Tokens: make([]int32, len(tokens)),
+	}
+
+	for idx, token := range tokens {
+		resp.Tokens[idx] = int32(token)
+	}
+
+	return resp, nil
+}
+
+// Decode implements the gRPC server for the tokenizer plugin decode method.
+func (s *TokenizerGRPCServer) Decode(
+	ctx context.Context,
+	req *DecodeRequest,
+) (*DecodeResponse, error) {
+	ctx = InitLogging(ctx, "decode")
+
+	tokens := make([]int, len(req.Tokens))
+	for idx, token := range req.Tokens {
+		tokens[idx] = int(token)
+	}
+
+	text, err := s.Impl.Decode(ctx, req.Model, tokens)
+	if err != nil {
+		return nil, fmt.Errorf("decode failed: %w", err)
+	}
+
+	return &DecodeResponse{
+		Text: text,
+	}, nil
+}
+
+// TokenizerGRPCClient is the gRPC client implementation of the plugin.
+type TokenizerGRPCClient struct {
+	Client TokenizerClient
+}
+
+var _ Tokenizer = (*TokenizerGRPCClient)(nil)
+
+// NewTokenizerGRPCClient returns a new TokenizerGRPCClient.
+func NewTokenizerGRPCClient(client TokenizerClient) *TokenizerGRPCClient {
+	return &TokenizerGRPCClient{
+		Client: client,
+	}
+}
+
+// Count implements the gRPC client for the tokenizer plugin.
+func (c *TokenizerGRPCClient) Count(
+	ctx context.Context,
+	model string,
+	text string,
+) (int, error) {
+	req := &TokenizeRequest{
+		Model: model,
+		Text:  text,
+	}
+
+	resp, err := c.Client.Count(ctx, req)
+	if err != nil {
+		return 0, fmt.Errorf("count failed: %w", err)
+	}
+
+	return int(resp.Count), nil
+}
+
+// Encode implements the gRPC client for the tokenizer plugin.
+func (c *TokenizerGRPCClient) Encode(
+	ctx context.Context,
+	model string,
+	text string,
+) ([]int, error) {
+	req := &TokenizeRequest{
+		Model: model,
+		Text:  text,
+	}
+
+	resp, err := c.Client.Encode(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("encode failed: %w", err)
+	}
+
+	tokens := make([]int, len(resp.Tokens))
+	for idx, token := range resp.Tokens {
+		tokens[idx] = int(token)
+	}
+
+	return tokens, nil
+}
+
+// Decode implements the gRPC client for the tokenizer plugin.
+func (c *TokenizerGRPCClient) Decode(
+	ctx context.Context,
+	model string,
+	tokens []int,
+) (string, error) {
+	req := &DecodeRequest{
+		Model:  model,
+		Tokens: make([]int32, len(tokens)),
+	}
+
+	for idx, token := range tokens {
+		req.Tokens[idx] = int32(token)
+	}
+
+	resp, err := c.Client.Decode(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("decode failed: %w", err)
+	}
+
+	return resp.Text, nil
+}
@@ -0,0 +1,54 @@
+//
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/lazygpt/lazygpt/plugin/local/pkg/daemon"
+	"github.com/lazygpt/lazygpt/plugin/local/pkg/local"
+	"github.com/lazygpt/lazygpt/plugin/log"
+)
+
+// serveDaemon opens the local memory and serves it on the socket of the data
+// directory, until no client has been connected for
+// `LAZYGPT_LOCAL_DAEMON_IDLE` or the daemon is interrupted.
+func serveDaemon(localPlugin *local.Plugin, dataDir string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger := log.NewLogger("local-daemon")
+	ctx = log.NewContext(ctx, logger)
+
+	idle := daemon.DefaultIdle
+
+	if value := os.Getenv("LAZYGPT_LOCAL_DAEMON_IDLE"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("failed to parse daemon idle duration: %w", err)
+		}
+
+		idle = parsed
+	}
+
+	if err := localPlugin.Open(ctx); err != nil {
+		return err //nolint:wrapcheck // already wrapped
+	}
+
+	path := daemon.SocketPath(dataDir)
+
+	listener, err := daemon.Listen(path)
+	if err != nil {
+		return errors.Join(err, localPlugin.Close(ctx))
+	}
+
+	logger.Info("Serving memory", "socket", path, "idle", idle)
+
+	return errors.Join(daemon.Serve(ctx, localPlugin, listener, idle), localPlugin.Close(ctx))
+}
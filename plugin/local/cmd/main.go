@@ -5,10 +5,12 @@ package main
 import (
 	"os"
 	"path/filepath"
+	"strconv"
 
 	"github.com/hashicorp/go-plugin"
 
 	"github.com/lazygpt/lazygpt/plugin/api"
+	"github.com/lazygpt/lazygpt/plugin/local/pkg/daemon"
 	"github.com/lazygpt/lazygpt/plugin/local/pkg/local"
 )
 
@@ -31,13 +33,67 @@ func main() {
 
 	localPlugin := local.NewPlugin(dataDir)
 
+	if index := os.Getenv("LAZYGPT_LOCAL_INDEX"); index != "" {
+		localPlugin.Memory.Index = index
+	}
+
+	if metric := os.Getenv("LAZYGPT_LOCAL_METRIC"); metric != "" {
+		localPlugin.Memory.Metric = metric
+	}
+
+	if normalize, err := strconv.ParseBool(os.Getenv("LAZYGPT_LOCAL_NORMALIZE")); err == nil {
+		localPlugin.Memory.Normalize = normalize
+	}
+
+	if model := os.Getenv("LAZYGPT_LOCAL_EMBEDDING_MODEL"); model != "" {
+		localPlugin.Memory.EmbeddingModel = model
+	}
+
+	if reembed, err := strconv.ParseBool(os.Getenv("LAZYGPT_LOCAL_REEMBED")); err == nil {
+		localPlugin.Memory.Reembed = reembed
+	}
+
+	if cache, err := strconv.ParseBool(os.Getenv("LAZYGPT_LOCAL_EMBEDDING_CACHE")); err == nil {
+		localPlugin.Memory.Cache = cache
+	}
+
+	if quantization := os.Getenv("LAZYGPT_LOCAL_QUANTIZATION"); quantization != "" {
+		localPlugin.Memory.Quantization = quantization
+	}
+
+	if workers, err := strconv.Atoi(os.Getenv("LAZYGPT_LOCAL_SCAN_WORKERS")); err == nil {
+		localPlugin.Memory.ScanWorkers = workers
+	}
+
+	if weight, err := strconv.ParseFloat(os.Getenv("LAZYGPT_LOCAL_KEYWORD_WEIGHT"), 32); err == nil {
+		localPlugin.Memory.Fusion.Keyword = float32(weight)
+	}
+
+	if k, err := strconv.Atoi(os.Getenv("LAZYGPT_LOCAL_FUSION_K")); err == nil {
+		localPlugin.Memory.Fusion.K = k
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == daemon.Command {
+		if err := serveDaemon(localPlugin, dataDir); err != nil {
+			panic(err)
+		}
+
+		return
+	}
+
+	if shared, err := strconv.ParseBool(os.Getenv("LAZYGPT_LOCAL_SHARED")); err == nil && shared {
+		localPlugin.Shared = daemon.NewClient(dataDir)
+	}
+
 	config := &plugin.ServeConfig{
 		HandshakeConfig: api.HandshakeConfig(),
 		GRPCServer:      plugin.DefaultGRPCServer,
 
 		Plugins: plugin.PluginSet{
-			"memory":     api.NewMemoryPlugin(localPlugin),
-			"interfaces": api.NewInterfacesPlugin(localPlugin),
+			"embedding":   api.NewEmbeddingPlugin(localPlugin),
+			"memory":      api.NewMemoryPlugin(localPlugin),
+			"maintenance": api.NewMaintenancePlugin(localPlugin),
+			"interfaces":  api.NewInterfacesPlugin(localPlugin),
 		},
 	}
 
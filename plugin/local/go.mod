@@ -8,6 +8,7 @@ require (
 	github.com/dgraph-io/badger/v4 v4.1.0
 	github.com/hashicorp/go-plugin v1.4.9
 	github.com/lazygpt/lazygpt v0.0.0-00010101000000-000000000000
+	google.golang.org/grpc v1.55.0
 	gotest.tools/v3 v3.4.0
 )
 
@@ -36,6 +37,5 @@ require (
 	golang.org/x/sys v0.7.0 // indirect
 	golang.org/x/text v0.9.0 // indirect
 	google.golang.org/genproto v0.0.0-20230306155012-7f2fa6fef1f4 // indirect
-	google.golang.org/grpc v1.55.0 // indirect
 	google.golang.org/protobuf v1.30.0 // indirect
 )
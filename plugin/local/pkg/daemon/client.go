@@ -0,0 +1,326 @@
+//
+
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/lazygpt/lazygpt/plugin/api"
+)
+
+const (
+	// StartTimeout is how long a client waits for the daemon it started.
+	StartTimeout = time.Minute
+
+	// startPoll is how often a client checks if the daemon it started is
+	// listening.
+	startPoll = 50 * time.Millisecond
+)
+
+// Client is an `api.Memory` and `api.Maintenance` forwarding to the daemon
+// listening on the socket, starting the daemon when it is not running.
+type Client struct {
+	// Path of the socket of the daemon.
+	Path string
+
+	// Start starts the daemon, the channel is closed once it exits.
+	Start func() (<-chan struct{}, error)
+
+	mu          sync.Mutex
+	conn        *grpc.ClientConn
+	memory      api.Memory
+	maintenance api.Maintenance
+}
+
+var (
+	_ api.Memory      = (*Client)(nil)
+	_ api.Maintenance = (*Client)(nil)
+)
+
+// NewClient creates a new Client of the daemon of the data directory.
+func NewClient(dataDir string) *Client {
+	return &Client{
+		Path: SocketPath(dataDir),
+		Start: func() (<-chan struct{}, error) {
+			return Start(dataDir)
+		},
+	}
+}
+
+// connect returns the memory and maintenance of the daemon, connecting to it
+// first, and starting it, if needed.
+func (client *Client) connect(ctx context.Context) (api.Memory, api.Maintenance, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if client.memory != nil {
+		return client.memory, client.maintenance, nil
+	}
+
+	if !Running(client.Path) {
+		if err := client.start(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	conn, err := grpc.DialContext(
+		ctx,
+		"unix://"+client.Path,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to memory daemon: %w", err)
+	}
+
+	client.conn = conn
+	client.memory = api.NewMemoryGRPCClient(api.NewMemoryClient(conn))
+	client.maintenance = api.NewMaintenanceGRPCClient(api.NewMaintenanceClient(conn))
+
+	return client.memory, client.maintenance, nil
+}
+
+// start starts the daemon and waits for it to listen. Another client may
+// have started a daemon at the same time, so the one started here exiting
+// is only a failure if no daemon listens shortly after.
+func (client *Client) start(ctx context.Context) error {
+	exited, err := client.Start()
+	if err != nil {
+		return err
+	}
+
+	deadline := time.NewTimer(StartTimeout)
+	defer deadline.Stop()
+
+	ticker := time.NewTicker(startPoll)
+	defer ticker.Stop()
+
+	var exitedAt time.Time
+
+	for !Running(client.Path) {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to start memory daemon: %w", ctx.Err())
+
+		case <-deadline.C:
+			return fmt.Errorf("%w: timed out", ErrStart)
+
+		case <-exited:
+			exitedAt = time.Now()
+			exited = nil
+
+		case <-ticker.C:
+			if !exitedAt.IsZero() && time.Since(exitedAt) > exitGrace {
+				return fmt.Errorf("%w: it exited, see %s", ErrStart, LogName)
+			}
+		}
+	}
+
+	return nil
+}
+
+// disconnect closes the connection to the daemon, the next call connects
+// again.
+func (client *Client) disconnect() {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if client.conn != nil {
+		_ = client.conn.Close()
+	}
+
+	client.conn = nil
+	client.memory = nil
+	client.maintenance = nil
+}
+
+// call calls fn with the memory of the daemon. If the daemon is gone, it is
+// started again and fn is called once more, so fn must be safe to repeat.
+func (client *Client) call(ctx context.Context, fn func(memory api.Memory) error) error {
+	err := client.callOnce(ctx, fn)
+	if status.Code(err) != codes.Unavailable {
+		return err
+	}
+
+	memory, _, err := client.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	return fn(memory)
+}
+
+// callOnce calls fn with the memory of the daemon. Unlike `call` it is not
+// called again if the daemon is gone, the daemon may have been gone only
+// after fn took effect. The next call connects again.
+func (client *Client) callOnce(ctx context.Context, fn func(memory api.Memory) error) error {
+	memory, _, err := client.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = fn(memory)
+	if status.Code(err) == codes.Unavailable {
+		client.disconnect()
+	}
+
+	return err
+}
+
+// maintain calls fn with the maintenance of the daemon. Unlike `call` it is
+// not called again if the daemon is gone, the backup it streams may have been
+// partly written or read already. The next call connects again.
+func (client *Client) maintain(ctx context.Context, fn func(maintenance api.Maintenance) error) error {
+	_, maintenance, err := client.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = fn(maintenance)
+	if status.Code(err) == codes.Unavailable {
+		client.disconnect()
+	}
+
+	return err
+}
+
+// Close closes the connection to the daemon, leaving the daemon running.
+func (client *Client) Close() error {
+	client.disconnect()
+
+	return nil
+}
+
+// Memorize implements the `api.Memory` interface. It is not called again if
+// the daemon is gone, which would memorize the records twice.
+func (client *Client) Memorize(ctx context.Context, records []api.Record) ([]string, error) {
+	var ids []string
+
+	err := client.callOnce(ctx, func(memory api.Memory) error {
+		var err error
+
+		ids, err = memory.Memorize(ctx, records)
+
+		return err //nolint:wrapcheck // wrapped by the plugin
+	})
+
+	return ids, err
+}
+
+// Recall implements the `api.Memory` interface.
+func (client *Client) Recall(ctx context.Context, query api.Query) ([]api.Record, error) {
+	var records []api.Record
+
+	err := client.call(ctx, func(memory api.Memory) error {
+		var err error
+
+		records, err = memory.Recall(ctx, query)
+
+		return err //nolint:wrapcheck // wrapped by the plugin
+	})
+
+	return records, err
+}
+
+// RecallBatch implements the `api.Memory` interface.
+func (client *Client) RecallBatch(ctx context.Context, queries []api.Query) ([][]api.Record, error) {
+	var results [][]api.Record
+
+	err := client.call(ctx, func(memory api.Memory) error {
+		var err error
+
+		results, err = memory.RecallBatch(ctx, queries)
+
+		return err //nolint:wrapcheck // wrapped by the plugin
+	})
+
+	return results, err
+}
+
+// List implements the `api.Memory` interface.
+func (client *Client) List(ctx context.Context, options api.ListOptions) (*api.Page, error) {
+	var page *api.Page
+
+	err := client.call(ctx, func(memory api.Memory) error {
+		var err error
+
+		page, err = memory.List(ctx, options)
+
+		return err //nolint:wrapcheck // wrapped by the plugin
+	})
+
+	return page, err
+}
+
+// Get implements the `api.Memory` interface.
+func (client *Client) Get(ctx context.Context, id string) (*api.Record, error) {
+	var record *api.Record
+
+	err := client.call(ctx, func(memory api.Memory) error {
+		var err error
+
+		record, err = memory.Get(ctx, id)
+
+		return err //nolint:wrapcheck // wrapped by the plugin
+	})
+
+	return record, err
+}
+
+// Update implements the `api.Memory` interface.
+func (client *Client) Update(ctx context.Context, record api.Record) error {
+	return client.call(ctx, func(memory api.Memory) error {
+		return memory.Update(ctx, record) //nolint:wrapcheck // wrapped by the plugin
+	})
+}
+
+// Delete implements the `api.Memory` interface.
+func (client *Client) Delete(ctx context.Context, ids []string) error {
+	return client.call(ctx, func(memory api.Memory) error {
+		return memory.Delete(ctx, ids) //nolint:wrapcheck // wrapped by the plugin
+	})
+}
+
+// Clear implements the `api.Memory` interface.
+func (client *Client) Clear(ctx context.Context, namespace string) error {
+	return client.call(ctx, func(memory api.Memory) error {
+		return memory.Clear(ctx, namespace) //nolint:wrapcheck // wrapped by the plugin
+	})
+}
+
+// Backup implements the `api.Maintenance` interface.
+func (client *Client) Backup(ctx context.Context, writer io.Writer) error {
+	return client.maintain(ctx, func(maintenance api.Maintenance) error {
+		return maintenance.Backup(ctx, writer) //nolint:wrapcheck // wrapped by the plugin
+	})
+}
+
+// Restore implements the `api.Maintenance` interface.
+func (client *Client) Restore(ctx context.Context, reader io.Reader) error {
+	return client.maintain(ctx, func(maintenance api.Maintenance) error {
+		return maintenance.Restore(ctx, reader) //nolint:wrapcheck // wrapped by the plugin
+	})
+}
+
+// Compact implements the `api.Maintenance` interface.
+func (client *Client) Compact(ctx context.Context) (*api.Compaction, error) {
+	var compaction *api.Compaction
+
+	err := client.maintain(ctx, func(maintenance api.Maintenance) error {
+		var err error
+
+		compaction, err = maintenance.Compact(ctx)
+
+		return err //nolint:wrapcheck // wrapped by the plugin
+	})
+
+	return compaction, err
+}
@@ -0,0 +1,257 @@
+//
+
+// Package daemon shares one local memory between processes. Badger only lets
+// one process open the database, so a daemon owns it and serves the memory
+// over a unix socket in the data directory, and the local plugins of every
+// lazygpt process forward their memory calls to it.
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/lazygpt/lazygpt/plugin/api"
+)
+
+const (
+	// Command is the argument starting the local plugin as the daemon.
+	Command = "daemon"
+
+	// SocketName is the name of the socket in the data directory.
+	SocketName = "memory.sock"
+
+	// LogName is the name of the log of the daemon in the data directory.
+	LogName = "daemon.log"
+
+	// SocketMode is the mode of the socket, only the user running the daemon
+	// can connect to it.
+	SocketMode = 0o600
+
+	// DefaultIdle is how long the daemon keeps running without clients.
+	DefaultIdle = 10 * time.Minute
+
+	// exitGrace is how long a client waits for the socket after the daemon
+	// it started exited, another daemon may be starting.
+	exitGrace = time.Second
+)
+
+// ErrStart is returned when the daemon does not start listening.
+var ErrStart = errors.New("memory daemon did not start")
+
+// SocketPath returns the path of the socket of the daemon of the data
+// directory.
+func SocketPath(dataDir string) string {
+	return filepath.Join(dataDir, SocketName)
+}
+
+// Running returns true if a daemon is listening on the socket.
+func Running(path string) bool {
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return false
+	}
+
+	_ = conn.Close()
+
+	return true
+}
+
+// Listen listens on the socket, removing the socket of a daemon that is
+// gone. The daemon must own the database first, so no other daemon is using
+// the socket. Only the user can connect to the socket, whatever the umask.
+func Listen(path string) (net.Listener, error) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on socket: %w", err)
+	}
+
+	if err := os.Chmod(path, SocketMode); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to restrict socket: %w", err), listener.Close())
+	}
+
+	return listener, nil
+}
+
+// Serve serves the memory on the listener until the context is done, or no
+// client has been connected for the idle duration if it is positive. The
+// maintenance of the memory is served too if it implements `api.Maintenance`.
+func Serve(ctx context.Context, memory api.Memory, listener net.Listener, idle time.Duration) error {
+	tracked := newTrackingListener(listener)
+	server := grpc.NewServer()
+	api.RegisterMemoryServer(server, api.NewMemoryGRPCServer(memory))
+
+	if maintenance, ok := memory.(api.Maintenance); ok {
+		api.RegisterMaintenanceServer(server, api.NewMaintenanceGRPCServer(maintenance))
+	}
+
+	served := make(chan error, 1)
+
+	go func() {
+		served <- server.Serve(tracked)
+	}()
+
+	// NOTE(jkoelker) A nil channel never fires, so without an idle
+	//                duration the daemon only stops with the context.
+	var (
+		timer   *time.Timer
+		expired <-chan time.Time
+	)
+
+	if idle > 0 {
+		timer = time.NewTimer(idle)
+		defer timer.Stop()
+
+		expired = timer.C
+	}
+
+	for {
+		select {
+		case err := <-served:
+			return fmt.Errorf("failed to serve memory: %w", err)
+
+		case <-ctx.Done():
+			server.Stop()
+
+			return nil
+
+		case <-tracked.changed:
+			if timer == nil {
+				continue
+			}
+
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+
+			if tracked.count() == 0 {
+				timer.Reset(idle)
+			}
+
+		case <-expired:
+			if tracked.count() == 0 {
+				server.GracefulStop()
+
+				return nil
+			}
+		}
+	}
+}
+
+// Start starts the local plugin as a daemon of the data directory, in a
+// session of its own so it outlives the process starting it and is not
+// interrupted along with its terminal. The daemon logs to `LogName` in the
+// data directory. The channel is closed once the daemon exits.
+func Start(dataDir string) (<-chan struct{}, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the local plugin: %w", err)
+	}
+
+	logFile, err := os.OpenFile(filepath.Join(dataDir, LogName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open daemon log: %w", err)
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(executable, Command)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{}
+
+	detach(cmd.SysProcAttr)
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start daemon: %w", err)
+	}
+
+	exited := make(chan struct{})
+
+	go func() {
+		defer close(exited)
+
+		_ = cmd.Wait()
+	}()
+
+	return exited, nil
+}
+
+// trackingListener counts the open connections it accepted, signaling each
+// change of the count.
+type trackingListener struct {
+	net.Listener
+
+	changed chan struct{}
+	mu      sync.Mutex
+	open    int
+}
+
+func newTrackingListener(listener net.Listener) *trackingListener {
+	return &trackingListener{
+		Listener: listener,
+		changed:  make(chan struct{}, 1),
+	}
+}
+
+// Accept implements `net.Listener`.
+func (listener *trackingListener) Accept() (net.Conn, error) {
+	conn, err := listener.Listener.Accept()
+	if err != nil {
+		return nil, err //nolint:wrapcheck // returned to the gRPC server as is
+	}
+
+	listener.add(1)
+
+	return &trackedConn{Conn: conn, listener: listener}, nil
+}
+
+func (listener *trackingListener) add(delta int) {
+	listener.mu.Lock()
+	listener.open += delta
+	listener.mu.Unlock()
+
+	select {
+	case listener.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (listener *trackingListener) count() int {
+	listener.mu.Lock()
+	defer listener.mu.Unlock()
+
+	return listener.open
+}
+
+// trackedConn is a connection of a trackingListener, uncounted once closed.
+type trackedConn struct {
+	net.Conn
+
+	listener *trackingListener
+	closed   sync.Once
+}
+
+// Close implements `net.Conn`.
+func (conn *trackedConn) Close() error {
+	conn.closed.Do(func() {
+		conn.listener.add(-1)
+	})
+
+	return conn.Conn.Close() //nolint:wrapcheck // returned to the gRPC server as is
+}
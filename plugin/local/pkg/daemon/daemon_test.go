@@ -0,0 +1,252 @@
+//
+
+package daemon_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/poll"
+
+	"github.com/lazygpt/lazygpt/plugin/api"
+	"github.com/lazygpt/lazygpt/plugin/local/pkg/daemon"
+	"github.com/lazygpt/lazygpt/plugin/local/pkg/memory"
+	"github.com/lazygpt/lazygpt/plugin/log"
+)
+
+// server runs daemons of a local memory in the test process.
+type server struct {
+	t      *testing.T
+	ctx    context.Context
+	dir    string
+	idle   time.Duration
+	starts atomic.Int32
+	stop   context.CancelFunc
+}
+
+// start starts a daemon as `daemon.Start` does.
+func (server *server) start() (<-chan struct{}, error) {
+	server.starts.Add(1)
+
+	local := memory.NewLocal(server.dir)
+	local.Index = memory.IndexExact
+	local.EmbeddingModel = memory.BuiltinEmbeddingPlugin + "/hashed-32"
+
+	if err := local.Open(server.ctx); err != nil {
+		return nil, err //nolint:wrapcheck // test helper
+	}
+
+	listener, err := daemon.Listen(daemon.SocketPath(server.dir))
+	if err != nil {
+		return nil, errors.Join(err, local.Close(server.ctx))
+	}
+
+	ctx, stop := context.WithCancel(server.ctx)
+	server.stop = stop
+
+	exited := make(chan struct{})
+
+	go func() {
+		defer close(exited)
+
+		assert.Check(server.t, daemon.Serve(ctx, local, listener, server.idle))
+		assert.Check(server.t, local.Close(server.ctx))
+	}()
+
+	return exited, nil
+}
+
+func newServer(t *testing.T, idle time.Duration) *server {
+	t.Helper()
+
+	// NOTE(jkoelker) Unix socket paths are short, the test name in the
+	//                temporary directory may not fit.
+	dir, err := os.MkdirTemp("", "daemon")
+	assert.NilError(t, err)
+
+	t.Cleanup(func() {
+		_ = os.RemoveAll(dir)
+	})
+
+	return &server{
+		t:    t,
+		ctx:  log.NewContext(context.Background(), log.NewLogger("test")),
+		dir:  dir,
+		idle: idle,
+	}
+}
+
+// waitStopped waits for the daemon to stop listening.
+func (server *server) waitStopped() {
+	server.t.Helper()
+
+	poll.WaitOn(server.t, func(poll.LogT) poll.Result {
+		if daemon.Running(daemon.SocketPath(server.dir)) {
+			return poll.Continue("daemon still running")
+		}
+
+		return poll.Success()
+	})
+}
+
+func (server *server) client() *daemon.Client {
+	client := daemon.NewClient(server.dir)
+	client.Start = server.start
+
+	return client
+}
+
+func TestShared(t *testing.T) {
+	t.Parallel()
+
+	server := newServer(t, 0)
+	ctx := server.ctx
+
+	first := server.client()
+	second := server.client()
+
+	ids, err := first.Memorize(ctx, []api.Record{{Data: "The staging cluster is in us-east-2."}})
+	assert.NilError(t, err)
+	assert.Equal(t, len(ids), 1)
+	assert.Assert(t, daemon.Running(daemon.SocketPath(server.dir)))
+
+	records, err := second.Recall(ctx, api.Query{Data: "where is the staging cluster"})
+	assert.NilError(t, err)
+	assert.Equal(t, len(records), 1)
+	assert.Equal(t, records[0].ID, ids[0])
+	assert.Equal(t, server.starts.Load(), int32(1))
+
+	_, err = second.Get(ctx, "missing")
+	assert.ErrorIs(t, err, api.ErrNotFound)
+
+	// NOTE(jkoelker) A client whose daemon is gone starts another one.
+	server.stop()
+	server.waitStopped()
+
+	record, err := first.Get(ctx, ids[0])
+	assert.NilError(t, err)
+	assert.Equal(t, record.Data, "The staging cluster is in us-east-2.")
+	assert.Equal(t, server.starts.Load(), int32(2))
+
+	// NOTE(jkoelker) Memorizing is not repeated when the daemon is gone, it
+	//                may have memorized the records already.
+	server.stop()
+	server.waitStopped()
+
+	_, err = first.Memorize(ctx, []api.Record{{Data: "The production cluster is in us-west-2."}})
+	assert.Assert(t, err != nil)
+	assert.Equal(t, server.starts.Load(), int32(2))
+
+	_, err = first.Memorize(ctx, []api.Record{{Data: "The production cluster is in us-west-2."}})
+	assert.NilError(t, err)
+	assert.Equal(t, server.starts.Load(), int32(3))
+
+	assert.NilError(t, first.Close())
+	assert.NilError(t, second.Close())
+	server.stop()
+}
+
+func TestMaintenance(t *testing.T) {
+	t.Parallel()
+
+	server := newServer(t, 0)
+	ctx := server.ctx
+	client := server.client()
+
+	// NOTE(jkoelker) A memory larger than a chunk is streamed in pieces.
+	large := strings.Repeat("backup ", api.ChunkSize/4)
+
+	ids, err := client.Memorize(ctx, []api.Record{{Data: large}})
+	assert.NilError(t, err)
+
+	var backup bytes.Buffer
+
+	assert.NilError(t, client.Backup(ctx, &backup))
+	assert.Assert(t, backup.Len() > api.ChunkSize)
+
+	assert.NilError(t, client.Clear(ctx, api.AllNamespaces))
+
+	compaction, err := client.Compact(ctx)
+	assert.NilError(t, err)
+	assert.Assert(t, compaction.Before > 0)
+
+	assert.NilError(t, client.Restore(ctx, &backup))
+
+	record, err := client.Get(ctx, ids[0])
+	assert.NilError(t, err)
+	assert.Equal(t, record.Data, large)
+
+	assert.NilError(t, client.Close())
+	server.stop()
+}
+
+func TestIdle(t *testing.T) {
+	t.Parallel()
+
+	server := newServer(t, 100*time.Millisecond)
+	client := server.client()
+
+	_, err := client.Memorize(server.ctx, []api.Record{{Data: "idle"}})
+	assert.NilError(t, err)
+
+	// NOTE(jkoelker) The daemon keeps running while a client is connected.
+	time.Sleep(300 * time.Millisecond)
+	assert.Assert(t, daemon.Running(daemon.SocketPath(server.dir)))
+
+	assert.NilError(t, client.Close())
+	server.waitStopped()
+}
+
+func TestListen(t *testing.T) {
+	t.Parallel()
+
+	dir, err := os.MkdirTemp("", "daemon")
+	assert.NilError(t, err)
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, daemon.SocketName)
+
+	// NOTE(jkoelker) A daemon that died leaves its socket behind.
+	stale, err := net.Listen("unix", path)
+	assert.NilError(t, err)
+
+	stale.(*net.UnixListener).SetUnlinkOnClose(false) //nolint:forcetypeassert // unix listener
+	assert.NilError(t, stale.Close())
+	assert.Assert(t, !daemon.Running(path))
+
+	listener, err := daemon.Listen(path)
+	assert.NilError(t, err)
+	assert.Assert(t, daemon.Running(path))
+
+	info, err := os.Stat(path)
+	assert.NilError(t, err)
+	assert.Equal(t, info.Mode().Perm(), os.FileMode(daemon.SocketMode))
+
+	assert.NilError(t, listener.Close())
+}
+
+func TestStartFailure(t *testing.T) {
+	t.Parallel()
+
+	server := newServer(t, 0)
+	client := server.client()
+	client.Start = func() (<-chan struct{}, error) {
+		exited := make(chan struct{})
+		close(exited)
+
+		return exited, nil
+	}
+
+	_, err := client.Recall(server.ctx, api.Query{Data: "anything"})
+	assert.ErrorIs(t, err, daemon.ErrStart)
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package daemon
+
+import "syscall"
+
+// detach leaves the process as it is, only unix has sessions.
+func detach(_ *syscall.SysProcAttr) {}
@@ -0,0 +1,10 @@
+//go:build unix
+
+package daemon
+
+import "syscall"
+
+// detach starts the process in a session of its own.
+func detach(attr *syscall.SysProcAttr) {
+	attr.Setsid = true
+}
@@ -0,0 +1,205 @@
+//
+
+// Package embedding embeds text without a network or a trained model, by
+// hashing its words, pairs of words and character trigrams into a vector of
+// a fixed number of dimensions. The vectors only capture shared wording, not
+// meaning, but it is enough to recall memories offline and in tests.
+package embedding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/lazygpt/lazygpt/plugin/api"
+)
+
+const (
+	// DefaultModel is the model used when none is named. Other models are
+	// named `hashed-<dimensions>`.
+	DefaultModel = "hashed"
+
+	// DefaultDimensions is the number of dimensions of `DefaultModel`.
+	DefaultDimensions = 512
+
+	// MaxDimensions is the largest number of dimensions of a model.
+	MaxDimensions = 8192
+
+	// wordWeight, pairWeight and trigramWeight weigh each word, each pair of
+	// consecutive words, and the trigrams of each word split between them.
+	wordWeight    = 1.0
+	pairWeight    = 0.5
+	trigramWeight = 0.5
+
+	// trigramLength is the number of characters of a trigram.
+	trigramLength = 3
+)
+
+// ErrUnknownModel is returned when the model is not a hashed model.
+var ErrUnknownModel = errors.New("unknown embedding model")
+
+// stopWords are common English words that say little about the text, they
+// are left out unless the text has no other words.
+var stopWords = map[string]bool{
+	"a": true, "about": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "been": true, "but": true, "by": true, "can": true, "do": true, "does": true,
+	"for": true, "from": true, "had": true, "has": true, "have": true, "he": true, "her": true,
+	"his": true, "i": true, "if": true, "in": true, "is": true, "it": true, "its": true,
+	"me": true, "my": true, "no": true, "not": true, "of": true, "on": true, "or": true,
+	"our": true, "she": true, "so": true, "that": true, "the": true, "their": true, "them": true,
+	"then": true, "there": true, "they": true, "this": true, "to": true, "was": true, "we": true,
+	"were": true, "what": true, "when": true, "which": true, "who": true, "will": true,
+	"with": true, "would": true, "you": true, "your": true,
+}
+
+// Hashed is an `api.Embedding` hashing the text, see the package.
+type Hashed struct{}
+
+var _ api.Embedding = (*Hashed)(nil)
+
+// NewHashed creates a new Hashed embedding.
+func NewHashed() *Hashed {
+	return &Hashed{}
+}
+
+// Dimensions returns the number of dimensions of the hashed model with the
+// name, `DefaultDimensions` if it is empty.
+func Dimensions(model string) (int, error) {
+	if model == "" || model == DefaultModel {
+		return DefaultDimensions, nil
+	}
+
+	value, ok := strings.CutPrefix(model, DefaultModel+"-")
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownModel, model)
+	}
+
+	dimensions, err := strconv.Atoi(value)
+	if err != nil || dimensions <= 0 || dimensions > MaxDimensions {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownModel, model)
+	}
+
+	return dimensions, nil
+}
+
+// Embedding implements the `api.Embedding` interface.
+func (hashed *Hashed) Embedding(_ context.Context, model string, input string) ([]float32, error) {
+	dimensions, err := Dimensions(model)
+	if err != nil {
+		return nil, err
+	}
+
+	return Embed(input, dimensions), nil
+}
+
+// EmbeddingBatch implements the `api.Embedding` interface.
+func (hashed *Hashed) EmbeddingBatch(_ context.Context, model string, inputs []string) ([][]float32, error) {
+	dimensions, err := Dimensions(model)
+	if err != nil {
+		return nil, err
+	}
+
+	embeddings := make([][]float32, len(inputs))
+	for idx := range inputs {
+		embeddings[idx] = Embed(inputs[idx], dimensions)
+	}
+
+	return embeddings, nil
+}
+
+// Embed returns the embedding of the text in the dimensions, of unit length,
+// or the zero vector if the text has no words. Each feature of the text is
+// hashed to a dimension and a sign, repeated features count less and less.
+func Embed(text string, dimensions int) []float32 {
+	weights := make(map[string]float64)
+	words := Words(text)
+
+	for idx, word := range words {
+		weights[word] += wordWeight
+
+		if idx > 0 {
+			weights[words[idx-1]+" "+word] += pairWeight
+		}
+
+		trigrams := Trigrams(word)
+		for _, trigram := range trigrams {
+			weights["#"+trigram] += trigramWeight / float64(len(trigrams))
+		}
+	}
+
+	vector := make([]float64, dimensions)
+	hasher := fnv.New64a()
+
+	for feature, weight := range weights {
+		hasher.Reset()
+		_, _ = hasher.Write([]byte(feature))
+		sum := hasher.Sum64()
+
+		value := math.Log1p(weight)
+		if sum>>63 == 1 {
+			value = -value
+		}
+
+		vector[sum%uint64(dimensions)] += value
+	}
+
+	var norm float64
+	for _, value := range vector {
+		norm += value * value
+	}
+
+	embedding := make([]float32, dimensions)
+	if norm == 0 {
+		return embedding
+	}
+
+	norm = math.Sqrt(norm)
+	for idx, value := range vector {
+		embedding[idx] = float32(value / norm)
+	}
+
+	return embedding
+}
+
+// Words returns the lowercased runs of letters and digits of the text in
+// order, without stop words unless it only has stop words.
+func Words(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(char rune) bool {
+		return !unicode.IsLetter(char) && !unicode.IsDigit(char)
+	})
+
+	kept := make([]string, 0, len(words))
+
+	for _, word := range words {
+		if !stopWords[word] {
+			kept = append(kept, word)
+		}
+	}
+
+	if len(kept) == 0 {
+		return words
+	}
+
+	return kept
+}
+
+// Trigrams returns the trigrams of the characters of the word, marked at its
+// start and end so `cat` and `concatenate` only share `cat`.
+func Trigrams(word string) []string {
+	runes := []rune("<" + word + ">")
+	if len(runes) <= trigramLength {
+		return []string{string(runes)}
+	}
+
+	trigrams := make([]string, 0, len(runes)-trigramLength+1)
+	for idx := 0; idx+trigramLength <= len(runes); idx++ {
+		trigrams = append(trigrams, string(runes[idx:idx+trigramLength]))
+	}
+
+	return trigrams
+}
@@ -0,0 +1,87 @@
+//
+
+package embedding_test
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/lazygpt/lazygpt/plugin/local/pkg/embedding"
+)
+
+func similarity(a []float32, b []float32) float64 {
+	var sum float64
+	for idx := range a {
+		sum += float64(a[idx]) * float64(b[idx])
+	}
+
+	return sum
+}
+
+func TestDimensions(t *testing.T) {
+	t.Parallel()
+
+	for model, dimensions := range map[string]int{
+		"":            embedding.DefaultDimensions,
+		"hashed":      embedding.DefaultDimensions,
+		"hashed-64":   64,
+		"hashed-8192": embedding.MaxDimensions,
+	} {
+		got, err := embedding.Dimensions(model)
+		assert.NilError(t, err, model)
+		assert.Equal(t, got, dimensions, model)
+	}
+
+	for _, model := range []string{"ada", "hashed-", "hashed-0", "hashed-x", "hashed-8193"} {
+		_, err := embedding.Dimensions(model)
+		assert.ErrorIs(t, err, embedding.ErrUnknownModel, model)
+	}
+}
+
+func TestEmbed(t *testing.T) {
+	t.Parallel()
+
+	query := embedding.Embed("How do I restart the payment service?", 256)
+	assert.Equal(t, len(query), 256)
+	assert.DeepEqual(t, query, embedding.Embed("how do i RESTART the payment service", 256))
+
+	norm := similarity(query, query)
+	assert.Assert(t, math.Abs(norm-1) < 1e-5, norm)
+
+	related := similarity(query, embedding.Embed("Restarting the payment service takes a minute.", 256))
+	unrelated := similarity(query, embedding.Embed("The quarterly budget was approved by finance.", 256))
+	assert.Assert(t, related > unrelated, "%f <= %f", related, unrelated)
+	assert.Assert(t, related > 0.3, related)
+
+	assert.DeepEqual(t, embedding.Embed("  ... ", 4), []float32{0, 0, 0, 0})
+}
+
+func TestWords(t *testing.T) {
+	t.Parallel()
+
+	assert.DeepEqual(t, embedding.Words("The cat, and THE hat!"), []string{"cat", "hat"})
+	assert.DeepEqual(t, embedding.Words("to be or not to be"), []string{"to", "be", "or", "not", "to", "be"})
+	assert.DeepEqual(t, embedding.Trigrams("cat"), []string{"<ca", "cat", "at>"})
+	assert.DeepEqual(t, embedding.Trigrams("a"), []string{"<a>"})
+}
+
+func TestEmbeddingBatch(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	hashed := embedding.NewHashed()
+
+	embeddings, err := hashed.EmbeddingBatch(ctx, "hashed-32", []string{"one", "two"})
+	assert.NilError(t, err)
+	assert.Equal(t, len(embeddings), 2)
+
+	single, err := hashed.Embedding(ctx, "hashed-32", "two")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, embeddings[1], single)
+
+	_, err = hashed.Embedding(ctx, "ada", "two")
+	assert.ErrorIs(t, err, embedding.ErrUnknownModel)
+}
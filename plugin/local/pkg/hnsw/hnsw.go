@@ -0,0 +1,535 @@
+//
+
+// Package hnsw implements a Hierarchical Navigable Small World graph for
+// approximate nearest neighbour search over vectors.
+package hnsw
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+const (
+	// DefaultM is the number of neighbours of a node on the upper layers.
+	DefaultM = 16
+
+	// DefaultEfConstruction is the size of the candidate list when inserting.
+	DefaultEfConstruction = 200
+
+	// DefaultEfSearch is the minimum size of the candidate list when searching.
+	DefaultEfSearch = 64
+
+	// DefaultMaxDeleted is the share of the nodes that may be deleted before
+	// the graph is rebuilt from the searchable ones.
+	DefaultMaxDeleted = 0.5
+
+	// formatVersion is the version of the persisted graph format.
+	formatVersion = 1
+)
+
+// ErrFormat is returned when loading a graph in an unknown format.
+var ErrFormat = errors.New("unknown index format")
+
+// DistanceFunc returns the distance between two vectors, smaller is closer.
+type DistanceFunc func(a []float32, b []float32) float32
+
+// Result is a node found by a search.
+type Result struct {
+	ID       string
+	Distance float32
+}
+
+// Node is a vector in the graph.
+type Node struct {
+	ID      string
+	Vector  []float32
+	Deleted bool
+
+	// Neighbors are the indexes of the neighbouring nodes on each layer the
+	// node is in.
+	Neighbors [][]int
+}
+
+// Graph is a Hierarchical Navigable Small World graph. It is safe for
+// concurrent use.
+type Graph struct {
+	// M is the number of neighbours of a node on the upper layers, the
+	// bottom layer has twice as many.
+	M int
+
+	// EfConstruction is the size of the candidate list when inserting.
+	EfConstruction int
+
+	// EfSearch is the minimum size of the candidate list when searching.
+	EfSearch int
+
+	// MaxDeleted is the share of the nodes that may be deleted before the
+	// graph is rebuilt from the searchable ones.
+	MaxDeleted float64
+
+	distance DistanceFunc
+	entry    int
+	ids      map[string]int
+	levels   float64
+	mu       sync.RWMutex
+	nodes    []Node
+	rng      *rand.Rand
+}
+
+// NewGraph creates a new empty graph using the distance function.
+func NewGraph(distance DistanceFunc) *Graph {
+	return &Graph{
+		M:              DefaultM,
+		EfConstruction: DefaultEfConstruction,
+		EfSearch:       DefaultEfSearch,
+		MaxDeleted:     DefaultMaxDeleted,
+
+		distance: distance,
+		entry:    -1,
+		ids:      make(map[string]int),
+		levels:   1 / math.Log(DefaultM),
+		rng:      rand.New(rand.NewSource(1)), //nolint:gosec // level selection is not security sensitive
+	}
+}
+
+// Len returns the number of searchable nodes in the graph.
+func (graph *Graph) Len() int {
+	graph.mu.RLock()
+	defer graph.mu.RUnlock()
+
+	return len(graph.ids)
+}
+
+// Checksum returns the checksum of the ids of the searchable nodes, the sum
+// of their `IDChecksum`. It does not depend on the order the nodes were
+// inserted in.
+func (graph *Graph) Checksum() uint64 {
+	graph.mu.RLock()
+	defer graph.mu.RUnlock()
+
+	var sum uint64
+	for id := range graph.ids {
+		sum += IDChecksum(id)
+	}
+
+	return sum
+}
+
+// IDChecksum returns the checksum of the id, summed by `Graph.Checksum`.
+func IDChecksum(id string) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(id))
+
+	return hash.Sum64()
+}
+
+// Contains returns true if the graph contains a searchable node with the id.
+func (graph *Graph) Contains(id string) bool {
+	graph.mu.RLock()
+	defer graph.mu.RUnlock()
+
+	_, ok := graph.ids[id]
+
+	return ok
+}
+
+// Insert adds the vector to the graph under the id. If the id is already in
+// the graph, the previous node is replaced.
+func (graph *Graph) Insert(id string, vector []float32) {
+	graph.mu.Lock()
+	defer graph.mu.Unlock()
+
+	graph.insert(id, vector)
+	graph.compact()
+}
+
+// insert adds the vector to the graph under the id, the lock must be held.
+func (graph *Graph) insert(id string, vector []float32) {
+	if idx, ok := graph.ids[id]; ok {
+		graph.nodes[idx].Deleted = true
+	}
+
+	level := int(math.Floor(-math.Log(1-graph.rng.Float64()) * graph.levels))
+	node := Node{
+		ID:        id,
+		Vector:    vector,
+		Neighbors: make([][]int, level+1),
+	}
+
+	idx := len(graph.nodes)
+	graph.nodes = append(graph.nodes, node)
+	graph.ids[id] = idx
+
+	if graph.entry < 0 {
+		graph.entry = idx
+
+		return
+	}
+
+	entry := graph.entry
+	top := graph.level(entry)
+
+	for layer := top; layer > level; layer-- {
+		entry = graph.greedy(vector, entry, layer)
+	}
+
+	for layer := minInt(top, level); layer >= 0; layer-- {
+		candidates := graph.searchLayer(vector, entry, graph.EfConstruction, layer)
+		neighbors := graph.closest(candidates, graph.maxNeighbors(layer))
+
+		graph.nodes[idx].Neighbors[layer] = neighbors
+
+		for _, neighbor := range neighbors {
+			graph.connect(neighbor, idx, layer)
+		}
+
+		entry = candidates[0].node
+	}
+
+	if level > top {
+		graph.entry = idx
+	}
+}
+
+// Delete removes the node with the id from the search results. The node stays
+// in the graph to keep it navigable until more than `MaxDeleted` of the nodes
+// are deleted and the graph is rebuilt.
+func (graph *Graph) Delete(id string) {
+	graph.mu.Lock()
+	defer graph.mu.Unlock()
+
+	if idx, ok := graph.ids[id]; ok {
+		graph.nodes[idx].Deleted = true
+		delete(graph.ids, id)
+		graph.compact()
+	}
+}
+
+// compact rebuilds the graph from the searchable nodes once more than
+// `MaxDeleted` of the nodes are deleted, the lock must be held.
+func (graph *Graph) compact() {
+	deleted := len(graph.nodes) - len(graph.ids)
+	if deleted == 0 || float64(deleted) <= graph.MaxDeleted*float64(len(graph.nodes)) {
+		return
+	}
+
+	nodes := graph.nodes
+
+	graph.entry = -1
+	graph.ids = make(map[string]int, len(graph.ids))
+	graph.nodes = make([]Node, 0, len(graph.ids))
+
+	for idx := range nodes {
+		if !nodes[idx].Deleted {
+			graph.insert(nodes[idx].ID, nodes[idx].Vector)
+		}
+	}
+}
+
+// Clear removes all the nodes from the graph.
+func (graph *Graph) Clear() {
+	graph.mu.Lock()
+	defer graph.mu.Unlock()
+
+	graph.entry = -1
+	graph.ids = make(map[string]int)
+	graph.nodes = nil
+}
+
+// Search returns the count nodes closest to the vector, closest first.
+func (graph *Graph) Search(vector []float32, count int) []Result {
+	graph.mu.RLock()
+	defer graph.mu.RUnlock()
+
+	if graph.entry < 0 || count <= 0 {
+		return []Result{}
+	}
+
+	entry := graph.entry
+	for layer := graph.level(entry); layer > 0; layer-- {
+		entry = graph.greedy(vector, entry, layer)
+	}
+
+	// NOTE(jkoelker) Deleted nodes take up room in the candidate list,
+	//                widen it by the number of deleted nodes (bounded) so
+	//                they do not crowd out live results, and keep
+	//                doubling it while they still do.
+	ef := maxInt(graph.EfSearch, count) + minInt(len(graph.nodes)-len(graph.ids), count)
+	want := minInt(count, len(graph.ids))
+
+	for {
+		results := graph.results(graph.searchLayer(vector, entry, ef, 0), count)
+		if len(results) >= want || ef >= len(graph.nodes) {
+			return results
+		}
+
+		ef *= 2
+	}
+}
+
+// results returns the searchable nodes of the candidates, up to count.
+func (graph *Graph) results(candidates []item, count int) []Result {
+	results := make([]Result, 0, count)
+
+	for _, candidate := range candidates {
+		if graph.nodes[candidate.node].Deleted {
+			continue
+		}
+
+		results = append(results, Result{
+			ID:       graph.nodes[candidate.node].ID,
+			Distance: candidate.distance,
+		})
+
+		if len(results) == count {
+			break
+		}
+	}
+
+	return results
+}
+
+// level returns the top layer of the node.
+func (graph *Graph) level(node int) int {
+	return len(graph.nodes[node].Neighbors) - 1
+}
+
+// maxNeighbors returns the maximum number of neighbours on the layer.
+func (graph *Graph) maxNeighbors(layer int) int {
+	if layer == 0 {
+		return graph.M * 2 //nolint:gomnd // the bottom layer is twice as dense
+	}
+
+	return graph.M
+}
+
+// greedy walks the layer from the entry to the node closest to the vector.
+func (graph *Graph) greedy(vector []float32, entry int, layer int) int {
+	best := entry
+	bestDistance := graph.distance(vector, graph.nodes[entry].Vector)
+
+	for changed := true; changed; {
+		changed = false
+
+		for _, neighbor := range graph.nodes[best].Neighbors[layer] {
+			distance := graph.distance(vector, graph.nodes[neighbor].Vector)
+			if distance < bestDistance {
+				best = neighbor
+				bestDistance = distance
+				changed = true
+			}
+		}
+	}
+
+	return best
+}
+
+// searchLayer returns up to ef nodes of the layer closest to the vector,
+// closest first.
+func (graph *Graph) searchLayer(vector []float32, entry int, ef int, layer int) []item {
+	visited := map[int]struct{}{entry: {}}
+	distance := graph.distance(vector, graph.nodes[entry].Vector)
+
+	candidates := newQueue(false, ef)
+	candidates.push(entry, distance)
+
+	found := newQueue(true, ef+1)
+	found.push(entry, distance)
+
+	for candidates.Len() > 0 {
+		current := candidates.pop()
+		if current.distance > found.top().distance && found.Len() >= ef {
+			break
+		}
+
+		for _, neighbor := range graph.nodes[current.node].Neighbors[layer] {
+			if _, ok := visited[neighbor]; ok {
+				continue
+			}
+
+			visited[neighbor] = struct{}{}
+			distance := graph.distance(vector, graph.nodes[neighbor].Vector)
+
+			if found.Len() < ef || distance < found.top().distance {
+				candidates.push(neighbor, distance)
+				found.push(neighbor, distance)
+
+				if found.Len() > ef {
+					found.pop()
+				}
+			}
+		}
+	}
+
+	items := make([]item, found.Len())
+	for idx := len(items) - 1; idx >= 0; idx-- {
+		items[idx] = found.pop()
+	}
+
+	return items
+}
+
+// closest returns the nodes of the count closest items.
+func (graph *Graph) closest(items []item, count int) []int {
+	nodes := make([]int, 0, count)
+
+	for _, candidate := range items {
+		if len(nodes) == count {
+			break
+		}
+
+		nodes = append(nodes, candidate.node)
+	}
+
+	return nodes
+}
+
+// connect adds the node as a neighbour of the neighbour on the layer, pruning
+// the farthest neighbours when it has too many.
+func (graph *Graph) connect(neighbor int, node int, layer int) {
+	neighbors := append(graph.nodes[neighbor].Neighbors[layer], node)
+
+	limit := graph.maxNeighbors(layer)
+	if len(neighbors) > limit {
+		vector := graph.nodes[neighbor].Vector
+		items := make([]item, len(neighbors))
+
+		for idx, other := range neighbors {
+			items[idx] = item{
+				node:     other,
+				distance: graph.distance(vector, graph.nodes[other].Vector),
+			}
+		}
+
+		sort.Slice(items, func(i, j int) bool {
+			if items[i].distance == items[j].distance {
+				return items[i].node < items[j].node
+			}
+
+			return items[i].distance < items[j].distance
+		})
+
+		neighbors = graph.closest(items, limit)
+	}
+
+	graph.nodes[neighbor].Neighbors[layer] = neighbors
+}
+
+// persisted is the on disk representation of the graph.
+type persisted struct {
+	Version        int
+	M              int
+	EfConstruction int
+	EfSearch       int
+	Entry          int
+	Nodes          []Node
+}
+
+// Save writes the graph to the writer.
+func (graph *Graph) Save(writer io.Writer) error {
+	graph.mu.RLock()
+	defer graph.mu.RUnlock()
+
+	state := persisted{
+		Version:        formatVersion,
+		M:              graph.M,
+		EfConstruction: graph.EfConstruction,
+		EfSearch:       graph.EfSearch,
+		Entry:          graph.entry,
+		Nodes:          graph.nodes,
+	}
+
+	if err := gob.NewEncoder(writer).Encode(&state); err != nil {
+		return fmt.Errorf("failed to encode graph: %w", err)
+	}
+
+	return nil
+}
+
+// Load reads a graph saved with `Save` from the reader.
+func Load(reader io.Reader, distance DistanceFunc) (*Graph, error) {
+	var state persisted
+
+	if err := gob.NewDecoder(reader).Decode(&state); err != nil {
+		return nil, fmt.Errorf("failed to decode graph: %w", err)
+	}
+
+	if state.Version != formatVersion {
+		return nil, fmt.Errorf("%w: version %d", ErrFormat, state.Version)
+	}
+
+	if err := state.validate(); err != nil {
+		return nil, err
+	}
+
+	graph := NewGraph(distance)
+	graph.M = state.M
+	graph.EfConstruction = state.EfConstruction
+	graph.EfSearch = state.EfSearch
+	graph.entry = state.Entry
+	graph.nodes = state.Nodes
+	graph.levels = 1 / math.Log(float64(state.M))
+
+	for idx := range graph.nodes {
+		if !graph.nodes[idx].Deleted {
+			graph.ids[graph.nodes[idx].ID] = idx
+		}
+	}
+
+	// NOTE(jkoelker) Graphs saved before they were compacted on delete may
+	//                still be mostly deleted nodes.
+	graph.compact()
+
+	return graph, nil
+}
+
+// validate checks that the entry and the neighbours of the nodes are nodes of
+// the graph, so a corrupt graph is rebuilt rather than searched.
+func (state *persisted) validate() error {
+	if state.M <= 0 {
+		return fmt.Errorf("%w: %d neighbours", ErrFormat, state.M)
+	}
+
+	if state.Entry < -1 || state.Entry >= len(state.Nodes) || (state.Entry < 0) != (len(state.Nodes) == 0) {
+		return fmt.Errorf("%w: entry %d of %d nodes", ErrFormat, state.Entry, len(state.Nodes))
+	}
+
+	for idx := range state.Nodes {
+		if len(state.Nodes[idx].Neighbors) == 0 {
+			return fmt.Errorf("%w: node %d has no layers", ErrFormat, idx)
+		}
+
+		for layer, neighbors := range state.Nodes[idx].Neighbors {
+			for _, neighbor := range neighbors {
+				if neighbor < 0 || neighbor >= len(state.Nodes) || len(state.Nodes[neighbor].Neighbors) <= layer {
+					return fmt.Errorf("%w: node %d has neighbour %d on layer %d", ErrFormat, idx, neighbor, layer)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,259 @@
+//
+
+package hnsw_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/lazygpt/lazygpt/plugin/local/pkg/hnsw"
+)
+
+func distance(a []float32, b []float32) float32 {
+	var sum float32
+
+	for i := range a {
+		sum += (a[i] - b[i]) * (a[i] - b[i])
+	}
+
+	return sum
+}
+
+func vectors(rng *rand.Rand, count int, dimensions int) [][]float32 {
+	vectors := make([][]float32, count)
+
+	for idx := range vectors {
+		vectors[idx] = make([]float32, dimensions)
+		for dim := range vectors[idx] {
+			vectors[idx][dim] = rng.Float32()
+		}
+	}
+
+	return vectors
+}
+
+// exact returns the ids of the count vectors nearest the query.
+func exact(vectors [][]float32, query []float32, count int) []string {
+	ids := make([]int, len(vectors))
+	for idx := range ids {
+		ids[idx] = idx
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return distance(query, vectors[ids[i]]) < distance(query, vectors[ids[j]])
+	})
+
+	nearest := make([]string, count)
+	for idx := range nearest {
+		nearest[idx] = fmt.Sprint(ids[idx])
+	}
+
+	return nearest
+}
+
+func build(vectors [][]float32) *hnsw.Graph {
+	graph := hnsw.NewGraph(distance)
+
+	for idx, vector := range vectors {
+		graph.Insert(fmt.Sprint(idx), vector)
+	}
+
+	return graph
+}
+
+func TestGraphRecall(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(42)) //nolint:gosec // test data
+	stored := vectors(rng, 1000, 16)
+	queries := vectors(rng, 50, 16)
+	graph := build(stored)
+
+	assert.Equal(t, graph.Len(), len(stored))
+
+	found := 0
+
+	for _, query := range queries {
+		expected := map[string]bool{}
+		for _, id := range exact(stored, query, 10) {
+			expected[id] = true
+		}
+
+		results := graph.Search(query, 10)
+		assert.Equal(t, len(results), 10)
+
+		for idx, result := range results {
+			if idx > 0 {
+				assert.Assert(t, results[idx-1].Distance <= result.Distance)
+			}
+
+			if expected[result.ID] {
+				found++
+			}
+		}
+	}
+
+	recall := float64(found) / float64(len(queries)*10)
+	assert.Assert(t, recall >= 0.95, "recall %f", recall)
+}
+
+func TestGraphDelete(t *testing.T) {
+	t.Parallel()
+
+	graph := build([][]float32{{0, 0}, {1, 1}, {2, 2}})
+	graph.Delete("0")
+
+	results := graph.Search([]float32{0, 0}, 1)
+	assert.Equal(t, len(results), 1)
+	assert.Equal(t, results[0].ID, "1")
+	assert.Assert(t, !graph.Contains("0"))
+	assert.Equal(t, graph.Len(), 2)
+
+	graph.Insert("1", []float32{5, 5})
+
+	results = graph.Search([]float32{0, 0}, 3)
+	assert.Equal(t, len(results), 2)
+	assert.Equal(t, results[0].ID, "2")
+	assert.Equal(t, results[1].ID, "1")
+}
+
+func TestGraphSaveLoad(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(7)) //nolint:gosec // test data
+	graph := build(vectors(rng, 200, 8))
+	query := vectors(rng, 1, 8)[0]
+
+	var buf bytes.Buffer
+	assert.NilError(t, graph.Save(&buf))
+
+	loaded, err := hnsw.Load(&buf, distance)
+	assert.NilError(t, err)
+	assert.Equal(t, loaded.Len(), graph.Len())
+	assert.DeepEqual(t, loaded.Search(query, 5), graph.Search(query, 5))
+}
+
+func TestGraphLoadCorrupt(t *testing.T) {
+	t.Parallel()
+
+	// NOTE(jkoelker) Gob matches the fields by name, the graph is written as
+	//                `Save` writes it.
+	type persisted struct {
+		Version        int
+		M              int
+		EfConstruction int
+		EfSearch       int
+		Entry          int
+		Nodes          []hnsw.Node
+	}
+
+	nodes := func() []hnsw.Node {
+		return []hnsw.Node{
+			{ID: "0", Vector: []float32{0, 1}, Neighbors: [][]int{{1}}},
+			{ID: "1", Vector: []float32{1, 0}, Neighbors: [][]int{{0}}},
+		}
+	}
+
+	outOfRange := nodes()
+	outOfRange[1].Neighbors[0] = []int{2}
+
+	upperLayer := nodes()
+	upperLayer[0].Neighbors = [][]int{{1}, {1}}
+
+	for name, state := range map[string]persisted{
+		"valid":       {Version: 1, M: 16, Entry: 0, Nodes: nodes()},
+		"entry":       {Version: 1, M: 16, Entry: 2, Nodes: nodes()},
+		"no entry":    {Version: 1, M: 16, Entry: -1, Nodes: nodes()},
+		"neighbour":   {Version: 1, M: 16, Entry: 0, Nodes: outOfRange},
+		"upper layer": {Version: 1, M: 16, Entry: 0, Nodes: upperLayer},
+	} {
+		var buf bytes.Buffer
+		assert.NilError(t, gob.NewEncoder(&buf).Encode(&state))
+
+		_, err := hnsw.Load(&buf, distance)
+		if name == "valid" {
+			assert.NilError(t, err)
+
+			continue
+		}
+
+		assert.ErrorIs(t, err, hnsw.ErrFormat, name)
+	}
+}
+
+func TestGraphEmpty(t *testing.T) {
+	t.Parallel()
+
+	graph := hnsw.NewGraph(distance)
+	assert.Equal(t, len(graph.Search([]float32{1}, 3)), 0)
+}
+
+func TestChecksum(t *testing.T) {
+	t.Parallel()
+
+	first := hnsw.NewGraph(distance)
+	first.Insert("a", []float32{0, 1})
+	first.Insert("b", []float32{1, 0})
+
+	second := hnsw.NewGraph(distance)
+	second.Insert("b", []float32{1, 0})
+	second.Insert("a", []float32{0, 1})
+
+	assert.Equal(t, first.Checksum(), second.Checksum())
+	assert.Equal(t, first.Checksum(), hnsw.IDChecksum("a")+hnsw.IDChecksum("b"))
+
+	// NOTE(jkoelker) Replacing a node keeps the count but not the checksum.
+	second.Delete("a")
+	second.Insert("c", []float32{1, 1})
+
+	assert.Equal(t, first.Len(), second.Len())
+	assert.Assert(t, first.Checksum() != second.Checksum())
+}
+
+func TestGraphCompact(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(11)) //nolint:gosec // test data
+	graph := build(vectors(rng, 100, 8))
+
+	var before bytes.Buffer
+	assert.NilError(t, graph.Save(&before))
+
+	// NOTE(jkoelker) Replacing every node many times must not grow the
+	//                graph past the deleted nodes it keeps.
+	for round := 0; round < 10; round++ {
+		for idx, vector := range vectors(rng, 100, 8) {
+			graph.Insert(fmt.Sprint(idx), vector)
+		}
+	}
+
+	var after bytes.Buffer
+	assert.NilError(t, graph.Save(&after))
+	assert.Equal(t, graph.Len(), 100)
+	assert.Assert(t, after.Len() < 3*before.Len(), "before %d after %d", before.Len(), after.Len())
+}
+
+func TestGraphSearchDeleted(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(13)) //nolint:gosec // test data
+	data := vectors(rng, 400, 8)
+	graph := build(data)
+	graph.MaxDeleted = 1
+
+	// NOTE(jkoelker) Delete the nodes nearest the query so the candidate
+	//                list is crowded with deleted nodes.
+	query := data[0]
+	for _, id := range exact(data, query, 150) {
+		graph.Delete(id)
+	}
+
+	assert.Equal(t, graph.Len(), 250)
+	assert.Equal(t, len(graph.Search(query, 10)), 10)
+}
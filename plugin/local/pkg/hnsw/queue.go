@@ -0,0 +1,81 @@
+//
+
+package hnsw
+
+import "container/heap"
+
+// item is a node and its distance to the query.
+type item struct {
+	node     int
+	distance float32
+}
+
+// queue is a priority queue of items. When `farthest` is set the farthest
+// item is on top, otherwise the closest is.
+type queue struct {
+	items    []item
+	farthest bool
+}
+
+var _ heap.Interface = (*queue)(nil)
+
+func newQueue(farthest bool, capacity int) *queue {
+	return &queue{
+		items:    make([]item, 0, capacity),
+		farthest: farthest,
+	}
+}
+
+// Len implements `heap.Interface`.
+func (q *queue) Len() int {
+	return len(q.items)
+}
+
+// Less implements `heap.Interface`.
+func (q *queue) Less(i, j int) bool {
+	if q.items[i].distance == q.items[j].distance {
+		// NOTE(jkoelker) Break ties on the node so results are
+		//                deterministic.
+		if q.farthest {
+			return q.items[i].node > q.items[j].node
+		}
+
+		return q.items[i].node < q.items[j].node
+	}
+
+	if q.farthest {
+		return q.items[i].distance > q.items[j].distance
+	}
+
+	return q.items[i].distance < q.items[j].distance
+}
+
+// Swap implements `heap.Interface`.
+func (q *queue) Swap(i, j int) {
+	q.items[i], q.items[j] = q.items[j], q.items[i]
+}
+
+// Push implements `heap.Interface`.
+func (q *queue) Push(x any) {
+	q.items = append(q.items, x.(item)) //nolint:forcetypeassert // only items are pushed
+}
+
+// Pop implements `heap.Interface`.
+func (q *queue) Pop() any {
+	last := q.items[len(q.items)-1]
+	q.items = q.items[:len(q.items)-1]
+
+	return last
+}
+
+func (q *queue) push(node int, distance float32) {
+	heap.Push(q, item{node: node, distance: distance})
+}
+
+func (q *queue) pop() item {
+	return heap.Pop(q).(item) //nolint:forcetypeassert // only items are pushed
+}
+
+func (q *queue) top() item {
+	return q.items[0]
+}
@@ -5,29 +5,62 @@ package local
 import (
 	"context"
 	"fmt"
+	"io"
 
 	"github.com/lazygpt/lazygpt/plugin/api"
+	"github.com/lazygpt/lazygpt/plugin/local/pkg/daemon"
+	"github.com/lazygpt/lazygpt/plugin/local/pkg/embedding"
 	"github.com/lazygpt/lazygpt/plugin/local/pkg/memory"
 )
 
 type Plugin struct {
 	Memory *memory.Local
+	Hashed *embedding.Hashed
+
+	// Shared is the memory daemon the memory calls are forwarded to instead
+	// of the local memory, if set.
+	Shared *daemon.Client
 }
 
 var (
-	_ api.Memory     = (*Plugin)(nil)
-	_ api.Interfaces = (*Plugin)(nil)
+	_ api.Embedding   = (*Plugin)(nil)
+	_ api.Memory      = (*Plugin)(nil)
+	_ api.Maintenance = (*Plugin)(nil)
+	_ api.Interfaces  = (*Plugin)(nil)
 )
 
 // NewPlugin creates a new Plugin instance.
 func NewPlugin(datadir string) *Plugin {
 	return &Plugin{
 		Memory: memory.NewLocal(datadir),
+		Hashed: embedding.NewHashed(),
 	}
 }
 
-// Open opens the local memory database.
+// memory returns the memory the memory calls are made to.
+func (plugin *Plugin) memory() api.Memory {
+	if plugin.Shared != nil {
+		return plugin.Shared
+	}
+
+	return plugin.Memory
+}
+
+// maintenance returns the maintenance the maintenance calls are made to.
+func (plugin *Plugin) maintenance() api.Maintenance {
+	if plugin.Shared != nil {
+		return plugin.Shared
+	}
+
+	return plugin.Memory
+}
+
+// Open opens the local memory database, unless the memory is shared.
 func (plugin *Plugin) Open(ctx context.Context) error {
+	if plugin.Shared != nil {
+		return nil
+	}
+
 	if err := plugin.Memory.Open(ctx); err != nil {
 		return fmt.Errorf("failed to open local memory: %w", err)
 	}
@@ -35,8 +68,17 @@ func (plugin *Plugin) Open(ctx context.Context) error {
 	return nil
 }
 
-// Close closes the local memory database.
+// Close closes the local memory database, or the connection to the memory
+// daemon.
 func (plugin *Plugin) Close(ctx context.Context) error {
+	if plugin.Shared != nil {
+		if err := plugin.Shared.Close(); err != nil {
+			return fmt.Errorf("failed to close shared memory: %w", err)
+		}
+
+		return nil
+	}
+
 	if err := plugin.Memory.Close(ctx); err != nil {
 		return fmt.Errorf("failed to close local memory: %w", err)
 	}
@@ -45,17 +87,18 @@ func (plugin *Plugin) Close(ctx context.Context) error {
 }
 
 // Memorize implements the `api.Memory` interface.
-func (plugin *Plugin) Memorize(ctx context.Context, data []string) error {
-	if err := plugin.Memory.Memorize(ctx, data); err != nil {
-		return fmt.Errorf("failed to memorize data: %w", err)
+func (plugin *Plugin) Memorize(ctx context.Context, records []api.Record) ([]string, error) {
+	ids, err := plugin.memory().Memorize(ctx, records)
+	if err != nil {
+		return nil, fmt.Errorf("failed to memorize data: %w", err)
 	}
 
-	return nil
+	return ids, nil
 }
 
 // Recall implements the `api.Memory` interface.
-func (plugin *Plugin) Recall(ctx context.Context, data string, count ...int) ([]string, error) {
-	memories, err := plugin.Memory.Recall(ctx, data, count...)
+func (plugin *Plugin) Recall(ctx context.Context, query api.Query) ([]api.Record, error) {
+	memories, err := plugin.memory().Recall(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to recall data: %w", err)
 	}
@@ -63,10 +106,119 @@ func (plugin *Plugin) Recall(ctx context.Context, data string, count ...int) ([]
 	return memories, nil
 }
 
+// RecallBatch implements the `api.Memory` interface.
+func (plugin *Plugin) RecallBatch(ctx context.Context, queries []api.Query) ([][]api.Record, error) {
+	results, err := plugin.memory().RecallBatch(ctx, queries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to recall data: %w", err)
+	}
+
+	return results, nil
+}
+
+// Embedding implements the `api.Embedding` interface with the offline hashed
+// models.
+func (plugin *Plugin) Embedding(ctx context.Context, model string, input string) ([]float32, error) {
+	vector, err := plugin.Hashed.Embedding(ctx, model, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed data: %w", err)
+	}
+
+	return vector, nil
+}
+
+// EmbeddingBatch implements the `api.Embedding` interface with the offline
+// hashed models.
+func (plugin *Plugin) EmbeddingBatch(ctx context.Context, model string, inputs []string) ([][]float32, error) {
+	vectors, err := plugin.Hashed.EmbeddingBatch(ctx, model, inputs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed data: %w", err)
+	}
+
+	return vectors, nil
+}
+
 // Interfaces implements the `api.Interfaces` interface.
 func (plugin *Plugin) Interfaces(_ context.Context) ([]string, error) {
 	return []string{
+		"embedding",
 		"interfaces",
+		"maintenance",
 		"memory",
 	}, nil
 }
+
+// List implements the `api.Memory` interface.
+func (plugin *Plugin) List(ctx context.Context, options api.ListOptions) (*api.Page, error) {
+	page, err := plugin.memory().List(ctx, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list memories: %w", err)
+	}
+
+	return page, nil
+}
+
+// Get implements the `api.Memory` interface.
+func (plugin *Plugin) Get(ctx context.Context, id string) (*api.Record, error) {
+	record, err := plugin.memory().Get(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get memory: %w", err)
+	}
+
+	return record, nil
+}
+
+// Update implements the `api.Memory` interface.
+func (plugin *Plugin) Update(ctx context.Context, record api.Record) error {
+	if err := plugin.memory().Update(ctx, record); err != nil {
+		return fmt.Errorf("failed to update memory: %w", err)
+	}
+
+	return nil
+}
+
+// Delete implements the `api.Memory` interface.
+func (plugin *Plugin) Delete(ctx context.Context, ids []string) error {
+	if err := plugin.memory().Delete(ctx, ids); err != nil {
+		return fmt.Errorf("failed to delete memories: %w", err)
+	}
+
+	return nil
+}
+
+// Clear implements the `api.Memory` interface.
+func (plugin *Plugin) Clear(ctx context.Context, namespace string) error {
+	if err := plugin.memory().Clear(ctx, namespace); err != nil {
+		return fmt.Errorf("failed to clear memories: %w", err)
+	}
+
+	return nil
+}
+
+// Backup implements the `api.Maintenance` interface.
+func (plugin *Plugin) Backup(ctx context.Context, writer io.Writer) error {
+	if err := plugin.maintenance().Backup(ctx, writer); err != nil {
+		return fmt.Errorf("failed to back up memories: %w", err)
+	}
+
+	return nil
+}
+
+// Restore implements the `api.Maintenance` interface.
+func (plugin *Plugin) Restore(ctx context.Context, reader io.Reader) error {
+	if err := plugin.maintenance().Restore(ctx, reader); err != nil {
+		return fmt.Errorf("failed to restore memories: %w", err)
+	}
+
+	return nil
+}
+
+// Compact implements the `api.Maintenance` interface.
+func (plugin *Plugin) Compact(ctx context.Context) (*api.Compaction, error) {
+	compaction, err := plugin.maintenance().Compact(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compact memories: %w", err)
+	}
+
+	return compaction, nil
+}
@@ -0,0 +1,144 @@
+//
+
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	// AccessFlushInterval is how often the access times of the recalled
+	// memories are written to the database.
+	AccessFlushInterval = time.Minute
+
+	// AccessFlushBatch is the number of access times written per
+	// transaction.
+	AccessFlushBatch = 256
+)
+
+// accessLog keeps when the recalled memories were last accessed until the
+// times are written to the database, so recalling does not write.
+type accessLog struct {
+	mutex sync.Mutex
+	times map[string]time.Time
+}
+
+// add records that the memory with the id was accessed at the time.
+func (accesses *accessLog) add(id string, accessed time.Time) {
+	accesses.mutex.Lock()
+	defer accesses.mutex.Unlock()
+
+	if accesses.times == nil {
+		accesses.times = make(map[string]time.Time)
+	}
+
+	if accessed.After(accesses.times[id]) {
+		accesses.times[id] = accessed
+	}
+}
+
+// apply sets when the entry was accessed if it was accessed since it was
+// stored.
+func (accesses *accessLog) apply(entry *Entry) {
+	accesses.mutex.Lock()
+	defer accesses.mutex.Unlock()
+
+	if accessed, ok := accesses.times[entry.ID]; ok && accessed.After(entry.Accessed) {
+		entry.Accessed = accessed
+	}
+}
+
+// take returns the access times recorded and forgets them.
+func (accesses *accessLog) take() map[string]time.Time {
+	accesses.mutex.Lock()
+	defer accesses.mutex.Unlock()
+
+	times := accesses.times
+	accesses.times = nil
+
+	return times
+}
+
+// reset forgets the access times recorded.
+func (accesses *accessLog) reset() {
+	accesses.take()
+}
+
+// flushAccesses writes the access times of the recalled memories, waiting for
+// a restore to finish first. Failing to do so is logged, the times are kept
+// for the next flush.
+func (local *Local) flushAccesses() {
+	local.restoring.RLock()
+	defer local.restoring.RUnlock()
+
+	if err := local.writeAccesses(); err != nil {
+		local.logger.Warn("Failed to record access of recalled memories", "error", err)
+	}
+}
+
+// writeAccesses writes the access times of the recalled memories to their
+// entries, `AccessFlushBatch` per transaction. Memories forgotten since they
+// were recalled are skipped, the times of a failed transaction are recorded
+// again.
+func (local *Local) writeAccesses() error {
+	times := local.accesses.take()
+	if len(times) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(times))
+	for id := range times {
+		ids = append(ids, id)
+	}
+
+	var errs []error
+
+	for start := 0; start < len(ids); start += AccessFlushBatch {
+		end := start + AccessFlushBatch
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		if err := local.DB.Update(func(txn *badger.Txn) error {
+			for _, id := range ids[start:end] {
+				entry, err := getEntry(txn, id)
+				if errors.Is(err, badger.ErrKeyNotFound) {
+					continue
+				}
+
+				if err != nil {
+					return err
+				}
+
+				if !times[id].After(entry.Accessed) {
+					continue
+				}
+
+				entry.Accessed = times[id]
+
+				if err := putEntry(txn, entry); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}); err != nil {
+			for _, id := range ids[start:end] {
+				local.accesses.add(id, times[id])
+			}
+
+			errs = append(errs, err)
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("failed to write access times: %w", err)
+	}
+
+	return nil
+}
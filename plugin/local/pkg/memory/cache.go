@@ -0,0 +1,86 @@
+//
+
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"github.com/lazygpt/lazygpt/plugin/api"
+)
+
+// EmbeddingCacheTTL is how long a cached embedding is kept once stored.
+const EmbeddingCacheTTL = 30 * 24 * time.Hour
+
+// embeddingCache is an `api.EmbeddingStore` keeping the embeddings of an
+// embedding plugin in the database.
+type embeddingCache struct {
+	db     *badger.DB
+	prefix string
+}
+
+var _ api.EmbeddingStore = (*embeddingCache)(nil)
+
+// embeddingCache returns the cache of the embeddings of the plugin.
+func (local *Local) embeddingCache(plugin string) *embeddingCache {
+	return &embeddingCache{
+		db:     local.DB,
+		prefix: string(cachePrefix) + plugin + "/",
+	}
+}
+
+// GetEmbedding implements the `api.EmbeddingStore` interface.
+func (cache *embeddingCache) GetEmbedding(key string) ([]float32, error) {
+	var embedding []float32
+
+	err := cache.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(cache.prefix + key))
+		if err != nil {
+			return err //nolint:wrapcheck // wrapped below
+		}
+
+		return item.Value(func(value []byte) error {
+			embedding, err = Decode(value)
+
+			return err
+		})
+	})
+
+	switch {
+	case errors.Is(err, badger.ErrKeyNotFound):
+		return nil, nil
+
+	case err != nil:
+		return nil, fmt.Errorf("failed to get cached embedding: %w", err)
+	}
+
+	return embedding, nil
+}
+
+// SetEmbeddings implements the `api.EmbeddingStore` interface. The
+// embeddings are written in a single batch.
+func (cache *embeddingCache) SetEmbeddings(embeddings map[string][]float32) error {
+	batch := cache.db.NewWriteBatch()
+	defer batch.Cancel()
+
+	for key, embedding := range embeddings {
+		value, err := Encode(embedding)
+		if err != nil {
+			return err
+		}
+
+		entry := badger.NewEntry([]byte(cache.prefix+key), value).WithTTL(EmbeddingCacheTTL)
+		if err := batch.SetEntry(entry); err != nil {
+			return fmt.Errorf("failed to cache embedding: %w", err)
+		}
+	}
+
+	if err := batch.Flush(); err != nil {
+		return fmt.Errorf("failed to cache embeddings: %w", err)
+	}
+
+	return nil
+}
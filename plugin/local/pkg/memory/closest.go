@@ -3,6 +3,8 @@
 package memory
 
 import (
+	"bytes"
+	"container/heap"
 	"math"
 	"sort"
 )
@@ -24,70 +26,141 @@ func Distance(base []float32, other []float32) float32 {
 	return sum
 }
 
-// Closest is a struct that keeps track of the closest values.
+// Similarity converts a distance into a similarity score in `(0, 1]`, where
+// `1` is identical.
+func Similarity(distance float32) float32 {
+	return 1 / (1 + distance)
+}
+
+// Value is a value added to a Closest and the distance of its key to the
+// base.
+type Value struct {
+	Distance float32
+	Key      []float32
+	Value    []byte
+}
+
+// Closest keeps the count values whose keys are closest to the base
+// according to the metric. Values at the same distance are kept in the order
+// of their bytes, and a value added again keeps its closest key, so the
+// result does not depend on the order the values are added in.
 type Closest struct {
 	Base   []float32
 	Count  int
-	Values []struct {
-		Distance float32
-		Key      []float32
-		Value    []byte
-	}
+	Metric Metric
+
+	// Values are the closest values, in no particular order until sorted.
+	Values []Value
+
+	// index is the position of each value in `Values`.
+	index map[string]int
+
+	// sorted is set while `Values` is sorted closest first, rather than a
+	// heap with the farthest value on top.
+	sorted bool
 }
 
-// NewClosest creates a new Closest instance.
+// NewClosest creates a new Closest instance using the euclidean metric.
 func NewClosest(base []float32, count int) *Closest {
-	return &Closest{
-		Base:  base,
-		Count: count,
+	if count < 0 {
+		count = 0
+	}
 
-		Values: make([]struct {
-			Distance float32
-			Key      []float32
-			Value    []byte
-		}, 0, count),
+	return &Closest{
+		Base:   base,
+		Count:  count,
+		Metric: Euclidean(),
+		Values: make([]Value, 0, count),
+		index:  make(map[string]int, count),
 	}
 }
 
-// Add adds a new value to the Closest instance.
+// Add adds a new value to the Closest instance, if its key is closer to the
+// base than the farthest value kept.
 func (closest *Closest) Add(key []float32, value []byte) {
-	entry := struct {
-		Distance float32
-		Key      []float32
-		Value    []byte
-	}{
-		Distance: Distance(closest.Base, key),
-		Key:      key,
-		Value:    value,
+	closest.AddDistance(closest.Metric.Distance(closest.Base, key), key, value)
+}
+
+// Accepts returns if a value at the distance may be kept, so its key and
+// value need not be made for values that will not be. Values as far as the
+// farthest value kept are accepted, `AddDistance` breaks the tie.
+func (closest *Closest) Accepts(distance float32) bool {
+	if closest.Count <= 0 {
+		return false
 	}
 
 	if len(closest.Values) < closest.Count {
-		closest.Values = append(closest.Values, entry)
+		return true
+	}
+
+	farthest := closest.Values[0]
+	if closest.sorted {
+		farthest = closest.Values[len(closest.Values)-1]
+	}
 
+	return !farther(&Value{Distance: distance}, &Value{Distance: farthest.Distance})
+}
+
+// AddDistance adds a new value whose key is at the distance from the base,
+// as `Add` does.
+func (closest *Closest) AddDistance(distance float32, key []float32, value []byte) {
+	if closest.Count <= 0 {
 		return
 	}
 
-	worst := -1
+	queue := (*closestQueue)(closest)
 
-	for i := range closest.Values {
-		if closest.Values[i].Distance > entry.Distance {
-			worst = i
+	if closest.index == nil || closest.sorted {
+		closest.reindex()
+		heap.Init(queue)
+	}
+
+	entry := Value{
+		Distance: distance,
+		Key:      key,
+		Value:    value,
+	}
+
+	if idx, ok := closest.index[string(value)]; ok {
+		if farther(&closest.Values[idx], &entry) {
+			closest.Values[idx] = entry
+			heap.Fix(queue, idx)
 		}
+
+		return
 	}
 
-	if worst > -1 {
-		closest.Values[worst] = entry
+	if len(closest.Values) < closest.Count {
+		heap.Push(queue, entry)
+
+		return
+	}
+
+	if farther(&closest.Values[0], &entry) {
+		delete(closest.index, string(closest.Values[0].Value))
+		closest.Values[0] = entry
+		closest.index[string(value)] = 0
+		heap.Fix(queue, 0)
+	}
+}
+
+// Sort sorts the closest values by distance, closest first. Adding a value
+// afterwards keeps them unsorted again.
+func (closest *Closest) Sort() {
+	if closest.sorted {
+		return
 	}
+
+	sort.Slice(closest.Values, func(i, j int) bool {
+		return farther(&closest.Values[j], &closest.Values[i])
+	})
+
+	closest.sorted = true
 }
 
-// Strings returns the closest values as strings.
+// Strings returns the closest values as strings, closest first.
 func (closest *Closest) Strings() []string {
-	sort.Slice(
-		closest.Values,
-		func(i, j int) bool {
-			return closest.Values[i].Distance < closest.Values[j].Distance
-		},
-	)
+	closest.Sort()
 
 	values := make([]string, 0, len(closest.Values))
 	for _, value := range closest.Values {
@@ -96,3 +169,85 @@ func (closest *Closest) Strings() []string {
 
 	return values
 }
+
+// Distances returns the distances of the closest values, closest first.
+func (closest *Closest) Distances() []float32 {
+	closest.Sort()
+
+	distances := make([]float32, 0, len(closest.Values))
+	for _, value := range closest.Values {
+		distances = append(distances, value.Distance)
+	}
+
+	return distances
+}
+
+// reindex records the position of each value.
+func (closest *Closest) reindex() {
+	closest.index = make(map[string]int, closest.Count)
+
+	for idx := range closest.Values {
+		closest.index[string(closest.Values[idx].Value)] = idx
+	}
+
+	closest.sorted = false
+}
+
+// farther returns if the value is farther from the base than the other, or
+// as far and after it in the order of their bytes. Values without a
+// comparable distance are the farthest.
+func farther(value *Value, other *Value) bool {
+	distance, otherDistance := value.Distance, other.Distance
+
+	if math.IsNaN(float64(distance)) {
+		distance = float32(math.Inf(1))
+	}
+
+	if math.IsNaN(float64(otherDistance)) {
+		otherDistance = float32(math.Inf(1))
+	}
+
+	if distance == otherDistance {
+		return bytes.Compare(value.Value, other.Value) > 0
+	}
+
+	return distance > otherDistance
+}
+
+// closestQueue is the heap of the values of a Closest, the farthest on top.
+type closestQueue Closest
+
+var _ heap.Interface = (*closestQueue)(nil)
+
+// Len implements `heap.Interface`.
+func (queue *closestQueue) Len() int {
+	return len(queue.Values)
+}
+
+// Less implements `heap.Interface`.
+func (queue *closestQueue) Less(i, j int) bool {
+	return farther(&queue.Values[i], &queue.Values[j])
+}
+
+// Swap implements `heap.Interface`.
+func (queue *closestQueue) Swap(i, j int) {
+	queue.Values[i], queue.Values[j] = queue.Values[j], queue.Values[i]
+	queue.index[string(queue.Values[i].Value)] = i
+	queue.index[string(queue.Values[j].Value)] = j
+}
+
+// Push implements `heap.Interface`.
+func (queue *closestQueue) Push(x any) {
+	value := x.(Value) //nolint:forcetypeassert // only values are pushed
+	queue.index[string(value.Value)] = len(queue.Values)
+	queue.Values = append(queue.Values, value)
+}
+
+// Pop implements `heap.Interface`.
+func (queue *closestQueue) Pop() any {
+	last := queue.Values[len(queue.Values)-1]
+	queue.Values = queue.Values[:len(queue.Values)-1]
+	delete(queue.index, string(last.Value))
+
+	return last
+}
@@ -3,8 +3,13 @@
 package memory_test
 
 import (
+	"fmt"
 	"math"
+	"math/rand"
+	"reflect"
+	"sort"
 	"testing"
+	"testing/quick"
 
 	"gotest.tools/v3/assert"
 
@@ -37,3 +42,173 @@ func TestClosest(t *testing.T) {
 	values := closest.Strings()
 	assert.DeepEqual(t, values, []string{"b", "a"})
 }
+
+// bruteClosest returns the count values closest to the base by sorting all of
+// them, each value at its closest key, ties in the order of the values.
+func bruteClosest(base []float32, keys [][]float32, values []string, count int) ([]string, []float32) {
+	distances := make(map[string]float32, len(values))
+
+	for idx, value := range values {
+		distance := memory.Distance(base, keys[idx])
+		if current, ok := distances[value]; !ok || distance < current {
+			distances[value] = distance
+		}
+	}
+
+	sorted := make([]string, 0, len(distances))
+	for value := range distances {
+		sorted = append(sorted, value)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		if distances[sorted[i]] == distances[sorted[j]] {
+			return sorted[i] < sorted[j]
+		}
+
+		return distances[sorted[i]] < distances[sorted[j]]
+	})
+
+	if len(sorted) > count {
+		sorted = sorted[:count]
+	}
+
+	closest := make([]float32, len(sorted))
+	for idx, value := range sorted {
+		closest[idx] = distances[value]
+	}
+
+	return sorted, closest
+}
+
+func TestClosestProperties(t *testing.T) {
+	t.Parallel()
+
+	// NOTE(jkoelker) Small integer coordinates and a few values make ties
+	//                and values added again common.
+	property := func(seed int64) bool {
+		random := rand.New(rand.NewSource(seed)) //nolint:gosec // deterministic test data
+		dimensions := 1 + random.Intn(3)
+		count := random.Intn(8)
+
+		vector := func() []float32 {
+			vector := make([]float32, dimensions)
+			for idx := range vector {
+				vector[idx] = float32(random.Intn(5))
+			}
+
+			return vector
+		}
+
+		base := vector()
+		keys := make([][]float32, random.Intn(40))
+		values := make([]string, len(keys))
+
+		for idx := range keys {
+			keys[idx] = vector()
+			values[idx] = fmt.Sprintf("v%d", random.Intn(16))
+		}
+
+		expected, distances := bruteClosest(base, keys, values, count)
+
+		// NOTE(jkoelker) Any order of adding, and sorting half way, finds
+		//                the same values.
+		for _, order := range [][]int{random.Perm(len(keys)), random.Perm(len(keys))} {
+			closest := memory.NewClosest(base, count)
+
+			for step, idx := range order {
+				if step == len(order)/2 {
+					closest.Sort()
+				}
+
+				closest.Add(keys[idx], []byte(values[idx]))
+			}
+
+			if !reflect.DeepEqual(closest.Strings(), expected) ||
+				!reflect.DeepEqual(closest.Distances(), distances) {
+				t.Logf("seed %d: %v %v, expected %v %v", seed, closest.Strings(), closest.Distances(), expected, distances)
+
+				return false
+			}
+		}
+
+		return true
+	}
+
+	assert.NilError(t, quick.Check(property, &quick.Config{MaxCount: 500}))
+}
+
+func TestClosestTies(t *testing.T) {
+	t.Parallel()
+
+	closest := memory.NewClosest([]float32{0, 0}, 2)
+
+	closest.Add([]float32{1, 0}, []byte("c"))
+	closest.Add([]float32{0, 1}, []byte("b"))
+	closest.Add([]float32{-1, 0}, []byte("a"))
+	closest.Add([]float32{3, 0}, []byte("d"))
+	closest.Add([]float32{0.5, 0}, []byte("d"))
+
+	assert.DeepEqual(t, closest.Strings(), []string{"d", "a"})
+	assert.DeepEqual(t, closest.Distances(), []float32{0.25, 1})
+
+	closest.Add([]float32{0, 0}, []byte("e"))
+	closest.Add([]float32{0, 2}, []byte("a"))
+
+	assert.DeepEqual(t, closest.Strings(), []string{"e", "d"})
+
+	empty := memory.NewClosest([]float32{0}, 0)
+	empty.Add([]float32{0}, []byte("a"))
+
+	assert.Equal(t, len(empty.Strings()), 0)
+}
+
+func TestSimilarity(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, memory.Similarity(0), float32(1))
+	assert.Equal(t, memory.Similarity(1), float32(0.5))
+	assert.Assert(t, memory.Similarity(math.MaxFloat32) < memory.Similarity(5))
+}
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	base := []float32{1, 0}
+
+	cosine, err := memory.LookupMetric(memory.MetricCosine)
+	assert.NilError(t, err)
+	assert.Equal(t, cosine.Score(base, []float32{2, 0}), float32(1))
+	assert.Equal(t, cosine.Score(base, []float32{0, 3}), float32(0))
+	assert.Equal(t, cosine.Score(base, []float32{-1, 0}), float32(-1))
+
+	dot, err := memory.LookupMetric(memory.MetricDot)
+	assert.NilError(t, err)
+	assert.Equal(t, dot.Score(base, []float32{2, 5}), float32(2))
+	assert.Assert(t, dot.Distance(base, []float32{2, 0}) < dot.Distance(base, []float32{1, 0}))
+
+	euclidean, err := memory.LookupMetric(memory.MetricEuclidean)
+	assert.NilError(t, err)
+	assert.Equal(t, euclidean.Score(base, []float32{1, 1}), float32(0.5))
+
+	_, err = memory.LookupMetric("manhattan")
+	assert.ErrorIs(t, err, memory.ErrUnknownMetric)
+}
+
+func TestClosestMetric(t *testing.T) {
+	t.Parallel()
+
+	closest := memory.NewClosest([]float32{1, 0}, 1)
+	closest.Metric = memory.Cosine()
+
+	closest.Add([]float32{0.9, 0.9}, []byte("a"))
+	closest.Add([]float32{10, 1}, []byte("b"))
+
+	assert.DeepEqual(t, closest.Strings(), []string{"b"})
+}
+
+func TestNormalize(t *testing.T) {
+	t.Parallel()
+
+	assert.DeepEqual(t, memory.Normalize([]float32{3, 4}), []float32{0.6, 0.8})
+	assert.DeepEqual(t, memory.Normalize([]float32{0, 0}), []float32{0, 0})
+}
@@ -0,0 +1,184 @@
+//
+
+package memory
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"github.com/lazygpt/lazygpt/plugin/api"
+)
+
+// DocumentNamespacePrefix returns the prefix of the keys of the chunks of the
+// documents of the namespace.
+func DocumentNamespacePrefix(namespace string) []byte {
+	return append(append(append([]byte{}, documentPrefix...), namespace...), namespaceSeparator)
+}
+
+// DocumentPrefix returns the prefix of the keys of the chunks of the document
+// in the namespace.
+func DocumentPrefix(namespace string, document string) []byte {
+	return append(append(DocumentNamespacePrefix(namespace), document...), namespaceSeparator)
+}
+
+// DocumentKey returns the key the id of the memory of the chunk of the
+// document in the namespace is stored under. Chunks sort in the order of the
+// document.
+func DocumentKey(namespace string, document string, chunk int) []byte {
+	return binary.BigEndian.AppendUint32(DocumentPrefix(namespace, document), uint32(chunk))
+}
+
+// documentKey returns the document key of the entry, false if the entry is
+// not a chunk of a document that can be stored.
+func documentKey(entry *Entry) ([]byte, bool) {
+	document, chunk, ok := api.DocumentChunk(entry.Metadata)
+	if !ok || strings.IndexByte(document, namespaceSeparator) >= 0 {
+		return nil, false
+	}
+
+	return DocumentKey(entry.Namespace, document, chunk), true
+}
+
+// setDocument links the chunk of the document the entry is to the entry.
+func setDocument(txn *badger.Txn, entry *Entry) error {
+	key, ok := documentKey(entry)
+	if !ok {
+		return nil
+	}
+
+	if err := txn.Set(key, []byte(entry.ID)); err != nil {
+		return fmt.Errorf("failed to store document chunk: %w", err)
+	}
+
+	return nil
+}
+
+// linkedDocumentKey returns the document key of the entry if the chunk is
+// linked to the entry, nil if it is not, or another memory was linked to the
+// chunk since.
+func linkedDocumentKey(txn *badger.Txn, entry *Entry) ([]byte, error) {
+	key, ok := documentKey(entry)
+	if !ok {
+		return nil, nil
+	}
+
+	item, err := txn.Get(key)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document chunk: %w", err)
+	}
+
+	linked := false
+
+	if err := item.Value(func(value []byte) error {
+		linked = bytes.Equal(value, []byte(entry.ID))
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to get document chunk: %w", err)
+	}
+
+	if !linked {
+		return nil, nil
+	}
+
+	return key, nil
+}
+
+// deleteDocument unlinks the chunk of the document the entry is from the
+// entry.
+func deleteDocument(txn *badger.Txn, entry *Entry) error {
+	key, err := linkedDocumentKey(txn, entry)
+	if err != nil || key == nil {
+		return err
+	}
+
+	if err := txn.Delete(key); err != nil {
+		return fmt.Errorf("failed to delete document chunk: %w", err)
+	}
+
+	return nil
+}
+
+// addNeighbors sets the neighbors of each record that is a chunk of a
+// document, up to count chunks before and after it. Expired chunks are left
+// out.
+func addNeighbors(txn *badger.Txn, records []api.Record, count int, now time.Time) error {
+	for idx := range records {
+		document, chunk, ok := records[idx].Chunk()
+		if !ok {
+			continue
+		}
+
+		neighbors, err := neighbors(txn, &records[idx], document, chunk, count, now)
+		if err != nil {
+			return err
+		}
+
+		records[idx].Neighbors = neighbors
+	}
+
+	return nil
+}
+
+// neighbors returns the records of the chunks of the document around the
+// chunk of the record, in the order of the document.
+func neighbors(
+	txn *badger.Txn,
+	record *api.Record,
+	document string,
+	chunk int,
+	count int,
+	now time.Time,
+) ([]api.Record, error) {
+	records := make([]api.Record, 0, 2*count)
+	namespace := api.Namespace(record.Namespace)
+
+	first := chunk - count
+	if first < 0 {
+		first = 0
+	}
+
+	last := DocumentKey(namespace, document, chunk+count)
+
+	iter := txn.NewIterator(badger.IteratorOptions{Prefix: DocumentPrefix(namespace, document)})
+	defer iter.Close()
+
+	for iter.Seek(DocumentKey(namespace, document, first)); iter.Valid(); iter.Next() {
+		item := iter.Item()
+		if bytes.Compare(item.Key(), last) > 0 {
+			break
+		}
+
+		id, err := item.ValueCopy(nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to copy document chunk: %w", err)
+		}
+
+		if string(id) == record.ID {
+			continue
+		}
+
+		entry, err := getEntry(txn, string(id))
+		if err != nil {
+			return nil, err
+		}
+
+		if entry.Expired(now) {
+			continue
+		}
+
+		records = append(records, entry.Record())
+	}
+
+	return records, nil
+}
@@ -0,0 +1,89 @@
+//
+
+package memory_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/lazygpt/lazygpt/plugin/api"
+	"github.com/lazygpt/lazygpt/plugin/local/pkg/memory"
+	"github.com/lazygpt/lazygpt/plugin/log"
+)
+
+func chunks(document string, data ...string) []api.Record {
+	records := make([]api.Record, len(data))
+
+	for idx := range data {
+		records[idx] = api.Record{
+			Data: data[idx],
+			Metadata: map[string]string{
+				api.MetadataDocument: document,
+				api.MetadataChunk:    strconv.Itoa(idx),
+			},
+		}
+	}
+
+	return records
+}
+
+func datas(records []api.Record) []string {
+	data := make([]string, len(records))
+	for idx := range records {
+		data[idx] = records[idx].Data
+	}
+
+	return data
+}
+
+func TestRecallNeighbors(t *testing.T) {
+	t.Parallel()
+
+	ctx := log.NewContext(context.Background(), log.NewLogger("test"))
+
+	local := memory.NewLocal(t.TempDir())
+	local.Index = memory.IndexExact
+	local.EmbeddingModel = "fake/v1"
+	local.Embedding = embedding{}
+
+	assert.NilError(t, local.Open(ctx))
+
+	ids, err := local.Memorize(ctx, chunks("doc", "a", "bb", "ccc", "dddd", "eeeee"))
+	assert.NilError(t, err)
+
+	_, err = local.Memorize(ctx, chunks("other", "cccccc"))
+	assert.NilError(t, err)
+
+	query := api.Query{Data: "ccc", Ranking: &api.Ranking{Similarity: 1}, Fusion: &api.Fusion{Vector: 1}}
+
+	records, err := local.Recall(ctx, query)
+	assert.NilError(t, err)
+	assert.Equal(t, records[0].Data, "ccc")
+	assert.Equal(t, len(records[0].Neighbors), 0)
+
+	query.Neighbors = 1
+
+	records, err = local.Recall(ctx, query)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, datas(records[0].Neighbors), []string{"bb", "dddd"})
+
+	query.Neighbors = 5
+
+	records, err = local.Recall(ctx, query)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, datas(records[0].Neighbors), []string{"a", "bb", "dddd", "eeeee"})
+
+	assert.NilError(t, local.Delete(ctx, ids[1:2]))
+	// NOTE(jkoelker) Empty metadata takes the chunk out of its document, nil
+	//                metadata would keep it.
+	assert.NilError(t, local.Update(ctx, api.Record{ID: ids[3], Data: "dddd", Metadata: map[string]string{}}))
+
+	records, err = local.Recall(ctx, query)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, datas(records[0].Neighbors), []string{"a", "eeeee"})
+
+	assert.NilError(t, local.Close(ctx))
+}
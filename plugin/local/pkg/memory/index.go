@@ -0,0 +1,419 @@
+//
+
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"github.com/lazygpt/lazygpt/plugin/api"
+	"github.com/lazygpt/lazygpt/plugin/local/pkg/hnsw"
+)
+
+const (
+	// IndexExact scans every stored vector on recall. It is slow but exact,
+	// and is used to validate the approximate index.
+	IndexExact = "exact"
+
+	// IndexHNSW searches a Hierarchical Navigable Small World graph of the
+	// stored vectors on recall.
+	IndexHNSW = "hnsw"
+
+	// IndexFile is the name of the directory in the data directory the index
+	// is persisted to, suffixed with the metric it was built with. Each
+	// namespace has its own graph in the directory.
+	IndexFile = "memoryindex"
+
+	// indexDirMode is the mode of the index directory.
+	indexDirMode = 0o700
+)
+
+// ErrUnknownIndex is returned when the index mode is not known.
+var ErrUnknownIndex = errors.New("unknown index")
+
+// namespaceIndex is the graph of the vectors of a namespace.
+type namespaceIndex struct {
+	graph *hnsw.Graph
+	dirty atomic.Bool
+}
+
+// Indexes are the graphs of each namespace.
+type Indexes struct {
+	distance hnsw.DistanceFunc
+	mu       sync.RWMutex
+	graphs   map[string]*namespaceIndex
+}
+
+// NewIndexes creates the graphs of the namespaces using the distance.
+func NewIndexes(distance hnsw.DistanceFunc) *Indexes {
+	return &Indexes{
+		distance: distance,
+		graphs:   make(map[string]*namespaceIndex),
+	}
+}
+
+// namespace returns the index of the namespace, creating it if it does not
+// exist.
+func (indexes *Indexes) namespace(namespace string) *namespaceIndex {
+	indexes.mu.RLock()
+	index, ok := indexes.graphs[namespace]
+	indexes.mu.RUnlock()
+
+	if ok {
+		return index
+	}
+
+	indexes.mu.Lock()
+	defer indexes.mu.Unlock()
+
+	if index, ok = indexes.graphs[namespace]; !ok {
+		index = &namespaceIndex{graph: hnsw.NewGraph(indexes.distance)}
+		indexes.graphs[namespace] = index
+	}
+
+	return index
+}
+
+// Namespaces returns the namespaces with a graph.
+func (indexes *Indexes) Namespaces() []string {
+	indexes.mu.RLock()
+	defer indexes.mu.RUnlock()
+
+	namespaces := make([]string, 0, len(indexes.graphs))
+	for namespace := range indexes.graphs {
+		namespaces = append(namespaces, namespace)
+	}
+
+	return namespaces
+}
+
+// Insert adds the vector of the memory to the graph of the namespace.
+func (indexes *Indexes) Insert(namespace string, id string, vector []float32) {
+	index := indexes.namespace(namespace)
+	index.graph.Insert(id, vector)
+	index.dirty.Store(true)
+}
+
+// Delete removes the memory from the graph of the namespace.
+func (indexes *Indexes) Delete(namespace string, id string) {
+	index := indexes.namespace(namespace)
+	index.graph.Delete(id)
+	index.dirty.Store(true)
+}
+
+// Clear removes all the memories of the namespace, or of every namespace for
+// `api.AllNamespaces`.
+func (indexes *Indexes) Clear(namespace string) {
+	indexes.mu.RLock()
+	defer indexes.mu.RUnlock()
+
+	for name, index := range indexes.graphs {
+		if namespace == api.AllNamespaces || namespace == name {
+			index.graph.Clear()
+			index.dirty.Store(true)
+		}
+	}
+}
+
+// Search returns the count memories of the namespace nearest the vector.
+func (indexes *Indexes) Search(namespace string, vector []float32, count int) []hnsw.Result {
+	indexes.mu.RLock()
+	index, ok := indexes.graphs[namespace]
+	indexes.mu.RUnlock()
+
+	if !ok {
+		return []hnsw.Result{}
+	}
+
+	return index.graph.Search(vector, count)
+}
+
+// indexDir returns the directory the index is persisted to.
+func (local *Local) indexDir() string {
+	return filepath.Join(local.DataDir, IndexFile+"."+local.metric.Name)
+}
+
+// indexPath returns the path of the persisted graph of the namespace.
+func (local *Local) indexPath(namespace string) string {
+	return filepath.Join(local.indexDir(), url.PathEscape(namespace))
+}
+
+// openIndex loads the persisted graphs, rebuilding those missing or out of
+// date from the stored vectors, or all of them if rebuild is set.
+func (local *Local) openIndex(rebuild bool) error {
+	switch local.Index {
+	case IndexExact:
+		return nil
+
+	case IndexHNSW:
+
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownIndex, local.Index)
+	}
+
+	if rebuild {
+		local.logger.Info("Database was migrated, rebuilding index")
+
+		return local.RebuildIndex()
+	}
+
+	stored, err := local.storedIDs()
+	if err != nil {
+		return err
+	}
+
+	local.indexes = NewIndexes(local.metric.Distance)
+
+	// NOTE(jkoelker) The graphs are only saved now and then, a graph saved
+	//                before memories were both forgotten and memorized has
+	//                as many ids as are stored but not the same ones.
+	for namespace, ids := range stored {
+		graph, err := loadIndex(local.indexPath(namespace), local.metric.Distance)
+		if err == nil && graph.Len() == ids.count && graph.Checksum() == ids.checksum {
+			local.indexes.graphs[namespace] = &namespaceIndex{graph: graph}
+
+			continue
+		}
+
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			local.logger.Error("Failed to load index, rebuilding", "namespace", namespace, "error", err)
+		} else {
+			local.logger.Info("Index is out of date, rebuilding", "namespace", namespace, "memories", ids.count)
+		}
+
+		if err := local.rebuildIndex(namespace); err != nil {
+			return err
+		}
+	}
+
+	return local.SaveIndex()
+}
+
+// loadIndex reads the graph persisted at the path.
+func loadIndex(path string, distance hnsw.DistanceFunc) (*hnsw.Graph, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index: %w", err)
+	}
+	defer file.Close()
+
+	graph, err := hnsw.Load(file, distance)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+
+	return graph, nil
+}
+
+// namespaceIDs are the number and checksum of the ids of the memories of a
+// namespace, to compare to its graph.
+type namespaceIDs struct {
+	count    int
+	checksum uint64
+}
+
+// storedIDs returns the number and checksum of the ids of the memories stored
+// in each namespace that belong in its graph.
+func (local *Local) storedIDs() (map[string]namespaceIDs, error) {
+	stored := make(map[string]namespaceIDs)
+
+	if err := local.DB.View(func(txn *badger.Txn) error {
+		return entries(txn, nil, func(entry *Entry) (bool, error) {
+			if local.stale(entry) {
+				return true, nil
+			}
+
+			ids := stored[entry.Namespace]
+			ids.count++
+			ids.checksum += hnsw.IDChecksum(entry.ID)
+			stored[entry.Namespace] = ids
+
+			return true, nil
+		})
+	}); err != nil {
+		return nil, fmt.Errorf("failed to count memories: %w", err)
+	}
+
+	return stored, nil
+}
+
+// indexVectors calls fn with the namespace, id and vector of each memory of
+// the namespace, or of every namespace for `api.AllNamespaces`, that belongs
+// in the graphs. Stale memories are left out until they are re-embedded,
+// their vectors may not even have the dimension of the configured model.
+func (local *Local) indexVectors(
+	txn *badger.Txn,
+	namespace string,
+	fn func(namespace string, id string, vector []float32),
+) error {
+	return entries(txn, nil, func(entry *Entry) (bool, error) {
+		if local.stale(entry) || (namespace != api.AllNamespaces && namespace != entry.Namespace) {
+			return true, nil
+		}
+
+		vector, err := getVector(txn, entry)
+		if err != nil {
+			return false, err
+		}
+
+		fn(entry.Namespace, entry.ID, vector)
+
+		return true, nil
+	})
+}
+
+// RebuildIndex rebuilds the graphs of every namespace from the vectors stored
+// in the database and persists them.
+func (local *Local) RebuildIndex() error {
+	indexes := NewIndexes(local.metric.Distance)
+
+	if err := local.DB.View(func(txn *badger.Txn) error {
+		return local.indexVectors(txn, api.AllNamespaces, indexes.Insert)
+	}); err != nil {
+		return fmt.Errorf("failed to rebuild index: %w", err)
+	}
+
+	if err := os.RemoveAll(local.indexDir()); err != nil {
+		return fmt.Errorf("failed to remove index: %w", err)
+	}
+
+	local.indexes = indexes
+
+	return local.SaveIndex()
+}
+
+// rebuildIndex rebuilds the graph of the namespace from the vectors stored in
+// the database.
+func (local *Local) rebuildIndex(namespace string) error {
+	index := &namespaceIndex{graph: hnsw.NewGraph(local.metric.Distance)}
+
+	if err := local.DB.View(func(txn *badger.Txn) error {
+		return local.indexVectors(txn, namespace, func(_ string, id string, vector []float32) {
+			index.graph.Insert(id, vector)
+		})
+	}); err != nil {
+		return fmt.Errorf("failed to rebuild index: %w", err)
+	}
+
+	index.dirty.Store(true)
+
+	local.indexes.mu.Lock()
+	local.indexes.graphs[namespace] = index
+	local.indexes.mu.Unlock()
+
+	return nil
+}
+
+// SaveIndex persists the graphs that changed since they were last saved. Each
+// graph is written to a temporary file first so a crash never leaves a
+// partially written graph behind.
+func (local *Local) SaveIndex() error {
+	if local.indexes == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(local.indexDir(), indexDirMode); err != nil {
+		return fmt.Errorf("failed to create index directory: %w", err)
+	}
+
+	local.indexes.mu.RLock()
+	defer local.indexes.mu.RUnlock()
+
+	for namespace, index := range local.indexes.graphs {
+		if !index.dirty.Swap(false) {
+			continue
+		}
+
+		if err := saveIndex(local.indexPath(namespace), index.graph); err != nil {
+			index.dirty.Store(true)
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// saveIndex atomically replaces the graph persisted at the path.
+func saveIndex(path string, graph *hnsw.Graph) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create index file: %w", err)
+	}
+
+	if err := graph.Save(file); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+
+		return fmt.Errorf("failed to save index: %w", err)
+	}
+
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+
+		return fmt.Errorf("failed to close index file: %w", err)
+	}
+
+	if err := os.Rename(file.Name(), path); err != nil {
+		os.Remove(file.Name())
+
+		return fmt.Errorf("failed to replace index file: %w", err)
+	}
+
+	return nil
+}
+
+// searchIndex adds the ids of the memories the index finds nearest to each
+// query, in each of its namespaces, to its closest values. Queries without
+// closest values are skipped. Stale memories are not in the index, and
+// memories found in the index but no longer stored are skipped.
+func (local *Local) searchIndex(txn *badger.Txn, closests []*Closest, queries []api.Query) error {
+	namespaces := local.indexes.Namespaces()
+
+	for idx, closest := range closests {
+		if closest == nil {
+			continue
+		}
+
+		for _, namespace := range namespaces {
+			if !queries[idx].InNamespace(namespace) {
+				continue
+			}
+
+			for _, result := range local.indexes.Search(namespace, closest.Base, closest.Count) {
+				// NOTE(jkoelker) A memory forgotten since the
+				//                transaction started may still be in
+				//                the index.
+				item, err := txn.Get(VectorKey(namespace, result.ID))
+				if errors.Is(err, badger.ErrKeyNotFound) {
+					continue
+				}
+
+				if err != nil {
+					return fmt.Errorf("failed to get vector: %w", err)
+				}
+
+				value, err := item.ValueCopy(nil)
+				if err != nil {
+					return fmt.Errorf("failed to copy vector: %w", err)
+				}
+
+				vector, err := Decode(value)
+				if err != nil {
+					return err
+				}
+
+				closest.Add(vector, []byte(result.ID))
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+//
+
+package memory_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+	"gotest.tools/v3/assert"
+
+	"github.com/lazygpt/lazygpt/plugin/api"
+	"github.com/lazygpt/lazygpt/plugin/local/pkg/hnsw"
+	"github.com/lazygpt/lazygpt/plugin/local/pkg/memory"
+	"github.com/lazygpt/lazygpt/plugin/log"
+)
+
+func TestSearchIndexForgotten(t *testing.T) {
+	t.Parallel()
+
+	ctx := log.NewContext(context.Background(), log.NewLogger("test"))
+
+	local := memory.NewLocal(t.TempDir())
+	local.EmbeddingModel = memory.BuiltinEmbeddingPlugin + "/hashed-64"
+
+	assert.NilError(t, local.Open(ctx))
+
+	ids, err := local.Memorize(ctx, []api.Record{
+		{Data: "The staging cluster is in us-east-2."},
+		{Data: "The production cluster is in eu-west-1."},
+	})
+	assert.NilError(t, err)
+
+	// NOTE(jkoelker) Forget the vector without the index, as a delete that
+	//                committed but did not reach the index yet.
+	assert.NilError(t, local.DB.Update(func(txn *badger.Txn) error {
+		return txn.Delete(memory.VectorKey(api.DefaultNamespace, ids[0]))
+	}))
+
+	records, err := local.Recall(ctx, api.Query{Data: "where is the cluster", Count: 2, Fusion: &api.Fusion{Vector: 1}})
+	assert.NilError(t, err)
+	assert.Equal(t, len(records), 1)
+	assert.Equal(t, records[0].ID, ids[1])
+
+	assert.NilError(t, local.Close(ctx))
+}
+
+func TestOpenIndexOutOfDate(t *testing.T) {
+	t.Parallel()
+
+	ctx := log.NewContext(context.Background(), log.NewLogger("test"))
+	dir := t.TempDir()
+	index := filepath.Join(dir, memory.IndexFile+"."+memory.MetricCosine)
+	query := api.Query{Data: "where is the cluster", Count: 3, Fusion: &api.Fusion{Vector: 1}}
+
+	open := func() *memory.Local {
+		local := memory.NewLocal(dir)
+		local.EmbeddingModel = memory.BuiltinEmbeddingPlugin + "/hashed-64"
+
+		assert.NilError(t, local.Open(ctx))
+
+		return local
+	}
+
+	local := open()
+
+	ids, err := local.Memorize(ctx, []api.Record{
+		{Data: "The staging cluster is in us-east-2."},
+		{Data: "The production cluster is in eu-west-1."},
+	})
+	assert.NilError(t, err)
+	assert.NilError(t, local.Close(ctx))
+
+	saved, err := os.ReadFile(filepath.Join(index, api.DefaultNamespace))
+	assert.NilError(t, err)
+
+	local = open()
+
+	assert.NilError(t, local.Delete(ctx, ids[:1]))
+
+	added, err := local.Memorize(ctx, []api.Record{{Data: "The testing cluster is in ap-south-1."}})
+	assert.NilError(t, err)
+	assert.NilError(t, local.Close(ctx))
+
+	// NOTE(jkoelker) Put back the graph saved before, as if the process
+	//                crashed before saving the graph again.
+	assert.NilError(t, os.WriteFile(filepath.Join(index, api.DefaultNamespace), saved, 0o600))
+
+	local = open()
+
+	records, err := local.Recall(ctx, query)
+	assert.NilError(t, err)
+
+	found := make([]string, len(records))
+	for idx := range records {
+		found[idx] = records[idx].ID
+	}
+
+	assert.Equal(t, len(found), 2)
+	assert.Assert(t, found[0] == added[0] || found[1] == added[0], "recalled %v", found)
+
+	assert.NilError(t, local.Close(ctx))
+}
+
+func TestIndexStale(t *testing.T) {
+	t.Parallel()
+
+	ctx := log.NewContext(context.Background(), log.NewLogger("test"))
+	dir := t.TempDir()
+
+	local := memory.NewLocal(dir)
+	local.EmbeddingModel = "fake/v2"
+	local.Embedding = embedding{}
+	local.Reembed = false
+
+	assert.NilError(t, local.Open(ctx))
+
+	// NOTE(jkoelker) The vectors of another model, of another dimension, are
+	//                left out of the graph until they are re-embedded.
+	ids, err := local.Memorize(ctx, []api.Record{
+		{Data: "a", Model: "fake/v1", Vector: []float32{1, 1}},
+		{Data: "bb"},
+		{Data: "ccc"},
+	})
+	assert.NilError(t, err)
+
+	records, err := local.Recall(ctx, api.Query{Data: "bb", Count: 3, Fusion: &api.Fusion{Vector: 1}})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, recordIDs(records), []string{ids[1], ids[2]})
+
+	assert.NilError(t, local.Update(ctx, api.Record{ID: ids[0], Importance: 1}))
+	assert.NilError(t, local.Close(ctx))
+
+	file, err := os.Open(filepath.Join(dir, memory.IndexFile+"."+memory.MetricCosine, api.DefaultNamespace))
+	assert.NilError(t, err)
+
+	defer file.Close()
+
+	graph, err := hnsw.Load(file, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, graph.Len(), 2)
+	assert.Assert(t, !graph.Contains(ids[0]))
+}
@@ -0,0 +1,354 @@
+//
+
+package memory
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"github.com/lazygpt/lazygpt/plugin/api"
+)
+
+const (
+	// BM25K1 saturates the keyword score of a memory as its keyword repeats.
+	BM25K1 = 1.2
+
+	// BM25B is how much the keyword score of a memory is normalized by its
+	// length relative to the average length.
+	BM25B = 0.75
+
+	// MaxKeywordLength is the length of the longest keyword indexed, longer
+	// words are not indexed.
+	MaxKeywordLength = 64
+
+	// keywordSeparators join the parts of compound words, such as error
+	// codes, qualified names and ticket numbers.
+	keywordSeparators = "-_."
+)
+
+// Keywords returns the keywords of the text in order, lowercased. Words are
+// runs of letters, digits and `keywordSeparators`, compound words are kept
+// whole and their parts added after them, so `ERR_CONN_RESET` is found by
+// itself as well as by `reset`.
+func Keywords(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(char rune) bool {
+		return !unicode.IsLetter(char) && !unicode.IsDigit(char) && !strings.ContainsRune(keywordSeparators, char)
+	})
+
+	keywords := make([]string, 0, len(words))
+
+	for _, word := range words {
+		word = strings.Trim(word, keywordSeparators)
+		if word == "" || len(word) > MaxKeywordLength {
+			continue
+		}
+
+		keywords = append(keywords, word)
+
+		parts := strings.FieldsFunc(word, func(char rune) bool {
+			return strings.ContainsRune(keywordSeparators, char)
+		})
+
+		if len(parts) > 1 {
+			keywords = append(keywords, parts...)
+		}
+	}
+
+	return keywords
+}
+
+// frequencies counts each keyword of the text.
+func frequencies(text string) (map[string]int, int) {
+	keywords := Keywords(text)
+	counts := make(map[string]int, len(keywords))
+
+	for _, keyword := range keywords {
+		counts[keyword]++
+	}
+
+	return counts, len(keywords)
+}
+
+// BM25 returns the Okapi BM25 score of a keyword found frequency times in a
+// memory of length keywords, when memories of the namespace hold the keyword
+// and the namespace has count memories of average length.
+func BM25(frequency int, length int, memories int, count int, average float64) float64 {
+	idf := math.Log(1 + (float64(count-memories)+0.5)/(float64(memories)+0.5))
+
+	norm := 1.0
+	if average > 0 {
+		norm = 1 - BM25B + BM25B*float64(length)/average
+	}
+
+	tf := float64(frequency)
+
+	return idf * tf * (BM25K1 + 1) / (tf + BM25K1*norm)
+}
+
+// Fuse returns the reciprocal rank fusion of the ranks of a memory in the
+// vector and keyword searches, zero if it was not found by a search, scaled
+// so a memory ranked first by both scores 1.
+func Fuse(fusion api.Fusion, vector int, keyword int) float32 {
+	k := fusion.K
+	if k <= 0 {
+		k = api.DefaultFusionK
+	}
+
+	weights := float64(fusion.Vector + fusion.Keyword)
+	if weights <= 0 {
+		return 0
+	}
+
+	var score float64
+
+	if vector > 0 {
+		score += float64(fusion.Vector) / float64(k+vector)
+	}
+
+	if keyword > 0 {
+		score += float64(fusion.Keyword) / float64(k+keyword)
+	}
+
+	return float32(score * float64(k+1) / weights)
+}
+
+// KeywordNamespacePrefix returns the prefix of the keys of the keywords of
+// the namespace.
+func KeywordNamespacePrefix(namespace string) []byte {
+	return append(append(append([]byte{}, keywordPrefix...), namespace...), namespaceSeparator)
+}
+
+// KeywordPrefix returns the prefix of the keys of the memories of the
+// namespace holding the keyword.
+func KeywordPrefix(namespace string, keyword string) []byte {
+	return append(append(KeywordNamespacePrefix(namespace), keyword...), namespaceSeparator)
+}
+
+// KeywordKey returns the key recording that the memory with the id in the
+// namespace holds the keyword.
+func KeywordKey(namespace string, keyword string, id string) []byte {
+	return append(KeywordPrefix(namespace, keyword), id...)
+}
+
+// setKeywords indexes the keywords of the entry and sets its length. The
+// value of each key is how many times the entry holds the keyword followed
+// by its length, so memories are scored without reading their entry.
+func setKeywords(txn *badger.Txn, entry *Entry) error {
+	counts, length := frequencies(entry.Data)
+	entry.Length = length
+
+	for keyword, count := range counts {
+		value := binary.AppendUvarint(nil, uint64(count))
+		value = binary.AppendUvarint(value, uint64(length))
+
+		if err := txn.Set(KeywordKey(entry.Namespace, keyword, entry.ID), value); err != nil {
+			return fmt.Errorf("failed to store keyword: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// keywordKeys returns the keys indexing the keywords of the entry.
+func keywordKeys(entry *Entry) [][]byte {
+	counts, _ := frequencies(entry.Data)
+	keys := make([][]byte, 0, len(counts))
+
+	for keyword := range counts {
+		keys = append(keys, KeywordKey(entry.Namespace, keyword, entry.ID))
+	}
+
+	return keys
+}
+
+// deleteKeywords removes the keywords of the entry from the index.
+func deleteKeywords(txn *badger.Txn, entry *Entry) error {
+	for _, key := range keywordKeys(entry) {
+		if err := txn.Delete(key); err != nil {
+			return fmt.Errorf("failed to delete keyword: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// keywordCount is the number of memories of a namespace and the sum of their
+// lengths.
+type keywordCount struct {
+	memories int
+	length   int
+}
+
+// keywordStats counts the memories and keywords of each namespace, the
+// average length of the memories normalizes their keyword scores.
+type keywordStats struct {
+	mu         sync.RWMutex
+	namespaces map[string]keywordCount
+}
+
+// add adds the memories and their length to the count of the namespace.
+func (stats *keywordStats) add(namespace string, memories int, length int) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	if stats.namespaces == nil {
+		stats.namespaces = make(map[string]keywordCount)
+	}
+
+	count := stats.namespaces[namespace]
+	count.memories += memories
+	count.length += length
+	stats.namespaces[namespace] = count
+}
+
+// clear forgets the counts of the namespace, or of every namespace for
+// `api.AllNamespaces`.
+func (stats *keywordStats) clear(namespace string) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	if namespace == api.AllNamespaces {
+		stats.namespaces = nil
+
+		return
+	}
+
+	delete(stats.namespaces, namespace)
+}
+
+// counts returns a copy of the counts of each namespace.
+func (stats *keywordStats) counts() map[string]keywordCount {
+	stats.mu.RLock()
+	defer stats.mu.RUnlock()
+
+	counts := make(map[string]keywordCount, len(stats.namespaces))
+	for namespace, count := range stats.namespaces {
+		counts[namespace] = count
+	}
+
+	return counts
+}
+
+// loadKeywordStats counts the memories and keywords of each namespace.
+func (local *Local) loadKeywordStats() error {
+	local.keywords.clear(api.AllNamespaces)
+
+	if err := local.DB.View(func(txn *badger.Txn) error {
+		return entries(txn, nil, func(entry *Entry) (bool, error) {
+			local.keywords.add(entry.Namespace, 1, entry.Length)
+
+			return true, nil
+		})
+	}); err != nil {
+		return fmt.Errorf("failed to count keywords: %w", err)
+	}
+
+	return nil
+}
+
+// keywordHit is a memory found by keyword and its score.
+type keywordHit struct {
+	id    string
+	score float64
+}
+
+// searchKeywords returns the memories in the namespaces of the query holding
+// any of its keywords, best scoring first.
+func (local *Local) searchKeywords(txn *badger.Txn, query *api.Query) ([]keywordHit, error) {
+	counts, _ := frequencies(query.Data)
+	scores := make(map[string]float64)
+
+	for namespace, count := range local.keywords.counts() {
+		if count.memories == 0 || !query.InNamespace(namespace) {
+			continue
+		}
+
+		average := float64(count.length) / float64(count.memories)
+
+		for keyword := range counts {
+			if err := scoreKeyword(txn, namespace, keyword, count.memories, average, scores); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	hits := make([]keywordHit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, keywordHit{id: id, score: score})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].score == hits[j].score {
+			return hits[i].id > hits[j].id
+		}
+
+		return hits[i].score > hits[j].score
+	})
+
+	return hits, nil
+}
+
+// scoreKeyword adds the BM25 score of the keyword to the scores of the
+// memories of the namespace holding it.
+func scoreKeyword(
+	txn *badger.Txn,
+	namespace string,
+	keyword string,
+	count int,
+	average float64,
+	scores map[string]float64,
+) error {
+	type posting struct {
+		id        string
+		frequency int
+		length    int
+	}
+
+	prefix := KeywordPrefix(namespace, keyword)
+	postings := make([]posting, 0)
+
+	iter := txn.NewIterator(badger.IteratorOptions{Prefix: prefix, PrefetchValues: true})
+	defer iter.Close()
+
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		item := iter.Item()
+
+		if err := item.Value(func(value []byte) error {
+			reader := bytes.NewReader(value)
+
+			frequency, err := binary.ReadUvarint(reader)
+			if err != nil {
+				return err //nolint:wrapcheck // wrapped below
+			}
+
+			length, err := binary.ReadUvarint(reader)
+			if err != nil {
+				return err //nolint:wrapcheck // wrapped below
+			}
+
+			postings = append(postings, posting{
+				id:        string(bytes.TrimPrefix(item.Key(), prefix)),
+				frequency: int(frequency),
+				length:    int(length),
+			})
+
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to decode keyword: %w", err)
+		}
+	}
+
+	for _, posting := range postings {
+		scores[posting.id] += BM25(posting.frequency, posting.length, len(postings), count, average)
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+//
+
+package memory_test
+
+import (
+	"context"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/lazygpt/lazygpt/plugin/api"
+	"github.com/lazygpt/lazygpt/plugin/local/pkg/memory"
+	"github.com/lazygpt/lazygpt/plugin/log"
+)
+
+func TestKeywords(t *testing.T) {
+	t.Parallel()
+
+	assert.DeepEqual(
+		t,
+		memory.Keywords("Fixed ERR_CONN_RESET in api.Recall, see JIRA-1234."),
+		[]string{
+			"fixed",
+			"err_conn_reset", "err", "conn", "reset",
+			"in",
+			"api.recall", "api", "recall",
+			"see",
+			"jira-1234", "jira", "1234",
+		},
+	)
+	assert.DeepEqual(t, memory.Keywords(" -- ... "), []string{})
+}
+
+func TestBM25(t *testing.T) {
+	t.Parallel()
+
+	score := memory.BM25(1, 10, 1, 100, 10)
+
+	assert.Assert(t, score > 0)
+	assert.Assert(t, memory.BM25(2, 10, 1, 100, 10) > score, "repeated keywords score higher")
+	assert.Assert(t, memory.BM25(1, 10, 50, 100, 10) < score, "common keywords score lower")
+	assert.Assert(t, memory.BM25(1, 40, 1, 100, 10) < score, "longer memories score lower")
+}
+
+func TestFuse(t *testing.T) {
+	t.Parallel()
+
+	fusion := api.DefaultFusion()
+
+	assert.Equal(t, memory.Fuse(fusion, 1, 1), float32(1))
+	assert.Equal(t, memory.Fuse(fusion, 0, 0), float32(0))
+	assert.Assert(t, memory.Fuse(fusion, 1, 0) > memory.Fuse(fusion, 2, 0))
+	assert.Assert(t, memory.Fuse(fusion, 2, 2) > memory.Fuse(fusion, 1, 0))
+	assert.Equal(t, memory.Fuse(api.VectorFusion(), 1, 5), float32(1))
+	assert.Equal(t, memory.Fuse(api.Fusion{}, 1, 1), float32(0))
+}
+
+func TestHybridRecall(t *testing.T) {
+	t.Parallel()
+
+	ctx := log.NewContext(context.Background(), log.NewLogger("test"))
+
+	for _, index := range []string{memory.IndexExact, memory.IndexHNSW} {
+		local := memory.NewLocal(t.TempDir())
+		local.Index = index
+		local.EmbeddingModel = "fake/v1"
+		local.Embedding = embedding{}
+
+		assert.NilError(t, local.Open(ctx))
+
+		// NOTE(jkoelker) The fake embedding embeds by length, the query is
+		//                as close to every memory by vector and only found
+		//                by its keywords.
+		ids, err := local.Memorize(ctx, []api.Record{
+			{Data: "build failed with E1234"},
+			{Data: "build failed with E4321"},
+			{Data: "tests failed with E1111"},
+		})
+		assert.NilError(t, err)
+
+		similarity := api.SimilarityRanking()
+		query := api.Query{Data: "what was E4321 about", Count: 3, Ranking: &similarity}
+
+		records, err := local.Recall(ctx, query)
+		assert.NilError(t, err)
+		assert.Equal(t, len(records), 3, index)
+		assert.Equal(t, records[0].ID, ids[1], index)
+
+		query.Fusion = &api.Fusion{Keyword: 1}
+
+		records, err = local.Recall(ctx, query)
+		assert.NilError(t, err)
+		assert.Equal(t, len(records), 1, index)
+		assert.Equal(t, records[0].ID, ids[1], index)
+
+		assert.NilError(t, local.Update(ctx, api.Record{ID: ids[1], Data: "build failed with E5555"}))
+
+		records, err = local.Recall(ctx, query)
+		assert.NilError(t, err)
+		assert.Equal(t, len(records), 0, index)
+
+		assert.NilError(t, local.Delete(ctx, []string{ids[0]}))
+
+		query.Data = "E1234 E5555"
+
+		records, err = local.Recall(ctx, query)
+		assert.NilError(t, err)
+		assert.Equal(t, len(records), 1, index)
+		assert.Equal(t, records[0].ID, ids[1], index)
+
+		assert.NilError(t, local.Close(ctx))
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"errors"
 	"fmt"
 	"path/filepath"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/dgraph-io/badger/v4"
@@ -18,12 +20,18 @@ import (
 	//                call other plugins.
 	"github.com/lazygpt/lazygpt/pkg/plugin"
 	"github.com/lazygpt/lazygpt/plugin/api"
+	"github.com/lazygpt/lazygpt/plugin/local/pkg/embedding"
 	"github.com/lazygpt/lazygpt/plugin/log"
 )
 
 const (
 	GarbageCollectionDiscardRatio = 0.5
 	GarbageCollectionInterval     = 15 * time.Minute
+
+	// BuiltinEmbeddingPlugin is the name of the embedding plugin built into
+	// the local plugin, embedding offline with the hashed models of the
+	// `embedding` package.
+	BuiltinEmbeddingPlugin = "local"
 )
 
 // Local is a local memory system that uses a badger database to store
@@ -32,11 +40,60 @@ type Local struct {
 	DB      *badger.DB
 	DataDir string
 
+	// Index is the index used to find the nearest memories, either
+	// `IndexHNSW` or `IndexExact`.
+	Index string
+
+	// Metric is the name of the metric used to compare memories.
+	Metric string
+
+	// Normalize scales vectors to unit length before they are stored or
+	// compared.
+	Normalize bool
+
+	// EmbeddingModel is the model memories are embedded with, named
+	// `<plugin>/<model>`. Memories embedded by another model are not
+	// recalled until they are re-embedded.
+	EmbeddingModel string
+
+	// Embedding embeds the memories. If nil, the plugin named by the
+	// embedding model is loaded when the database is opened, or the builtin
+	// embedding is used for `BuiltinEmbeddingPlugin`.
+	Embedding api.Embedding
+
+	// Reembed re-embeds the memories embedded by another model in the
+	// background once the database is opened.
+	Reembed bool
+
+	// Cache keeps the embeddings in the database so the same data is only
+	// embedded once by a model.
+	Cache bool
+
+	// Fusion weighs the vector and keyword searches of queries without a
+	// fusion.
+	Fusion api.Fusion
+
+	// Quantization is how the copy of the vectors scanned on recall is
+	// quantized, `QuantizationNone` scans the full precision vectors.
+	Quantization string
+
+	// ScanWorkers is the number of goroutines scanning the vectors on recall
+	// without an index, the number of CPUs if not positive.
+	ScanWorkers int
+
+	accesses  accessLog
 	closing   chan struct{}
 	embedding api.Embedding
 	gcStopped chan struct{}
+	indexes   *Indexes
+	keywords  keywordStats
 	manager   *plugin.Manager
 	logger    *log.Logger
+	metric    Metric
+	modelName string
+	opening   sync.Mutex
+	reembed   reembedJob
+	restoring sync.RWMutex
 }
 
 var _ api.Memory = (*Local)(nil)
@@ -45,7 +102,14 @@ var _ api.Memory = (*Local)(nil)
 // database.
 func NewLocal(datadir string) *Local {
 	return &Local{
-		DataDir: datadir,
+		DataDir:        datadir,
+		Index:          IndexHNSW,
+		Metric:         MetricCosine,
+		EmbeddingModel: DefaultEmbeddingModel,
+		Reembed:        true,
+		Cache:          true,
+		Fusion:         api.DefaultFusion(),
+		Quantization:   QuantizationInt8,
 	}
 }
 
@@ -55,6 +119,25 @@ func (local *Local) SetupLogger(ctx context.Context) {
 	}
 }
 
+// ensureOpen opens the database if it is not open yet. It is safe to call
+// concurrently.
+func (local *Local) ensureOpen(ctx context.Context) error {
+	local.opening.Lock()
+	defer local.opening.Unlock()
+
+	local.SetupLogger(ctx)
+
+	if local.DB != nil {
+		return nil
+	}
+
+	if err := local.Open(ctx); err != nil {
+		return fmt.Errorf("failed to open local database: %w", err)
+	}
+
+	return nil
+}
+
 // Open opens the database and sets the logger and starts the garbage
 // collector.
 func (local *Local) Open(ctx context.Context) error {
@@ -62,57 +145,109 @@ func (local *Local) Open(ctx context.Context) error {
 
 	local.logger.Info("Starting local plugin")
 
+	metric, err := LookupMetric(local.Metric)
+	if err != nil {
+		return fmt.Errorf("failed to lookup metric: %w", err)
+	}
+
+	local.metric = metric
+
+	if err := ValidateQuantization(local.Quantization); err != nil {
+		return err
+	}
+
+	embeddingPlugin, modelName, err := SplitEmbeddingModel(local.EmbeddingModel)
+	if err != nil {
+		return err
+	}
+
+	local.modelName = modelName
+
+	if embeddingPlugin == BuiltinEmbeddingPlugin && local.Embedding == nil {
+		if _, err := embedding.Dimensions(modelName); err != nil {
+			return fmt.Errorf("failed to lookup embedding model: %w", err)
+		}
+	}
+
 	options := badger.DefaultOptions(filepath.Join(local.DataDir, "memorydb"))
 	options = options.WithLogger(NewLogger(local.logger.WithName("badger")))
 
+	if local.Quantization != QuantizationNone {
+		options = options.WithValueThreshold(VectorValueThreshold)
+	}
+
 	database, err := badger.Open(options)
 	if err != nil {
 		return fmt.Errorf("failed to open local database: %w", err)
 	}
 
 	local.DB = database
+
+	migrated, err := local.migrate()
+	if err != nil {
+		return fmt.Errorf("failed to migrate local database: %w", err)
+	}
+
+	if err := local.openQuantized(migrated); err != nil {
+		return err
+	}
+
+	if err := local.openIndex(migrated); err != nil {
+		return fmt.Errorf("failed to open index: %w", err)
+	}
+
+	if err := local.loadKeywordStats(); err != nil {
+		return err
+	}
+
 	local.closing = make(chan struct{})
 	local.gcStopped = make(chan struct{})
 	local.manager = plugin.NewManager()
 
-	// NOTE(jkoelker) Load the embedding plugin. This is a hack and is
-	//                hardcoded to openai. We need to formalize how plugins
-	//                can call other plugins.
-	client, err := local.manager.Client(ctx, "openai")
-	if err != nil {
-		return fmt.Errorf("failed to load embedding plugin: %w", err)
+	if local.Embedding == nil && embeddingPlugin == BuiltinEmbeddingPlugin {
+		local.Embedding = embedding.NewHashed()
 	}
 
-	protocol, err := client.Client()
-	if err != nil {
-		return fmt.Errorf("failed to load embedding protocol: %w", err)
-	}
+	if local.Embedding == nil {
+		loaded, err := local.loadEmbedding(ctx, embeddingPlugin)
+		if err != nil {
+			return err
+		}
 
-	raw, err := protocol.Dispense("embedding")
-	if err != nil {
-		return fmt.Errorf("failed to dispense embedding: %w", err)
+		local.Embedding = loaded
 	}
 
-	embedding, ok := raw.(api.Embedding)
-	if !ok {
-		return fmt.Errorf(
-			"failed to cast embedding to api.Embedding: %w",
-			plugin.ErrUnexpectedInterface,
-		)
+	// NOTE(jkoelker) The builtin embedding is cheaper to compute than to
+	//                read from the cache.
+	local.embedding = local.Embedding
+	if local.Cache && embeddingPlugin != BuiltinEmbeddingPlugin {
+		local.embedding = api.NewCachedEmbedding(local.Embedding, local.embeddingCache(embeddingPlugin))
 	}
 
-	local.embedding = embedding
+	local.purgeExpired()
+
+	if err := local.checkModels(); err != nil {
+		return err
+	}
 
-	// NOTE(jkoelker) Start the garabage collector on the database.
+	// NOTE(jkoelker) Start the garabage collector on the database, and the
+	//                writing of the access times of recalled memories.
 	go func() {
 		defer close(local.gcStopped)
 
+		collecting := time.NewTicker(GarbageCollectionInterval)
+		defer collecting.Stop()
+
+		flushing := time.NewTicker(AccessFlushInterval)
+		defer flushing.Stop()
+
 		for {
 			select {
-			case <-time.After(GarbageCollectionInterval):
-				if err := local.CollectGarbage(); err != nil {
-					local.logger.Error("Failed to collect garbage", "error", err)
-				}
+			case <-collecting.C:
+				local.collect()
+
+			case <-flushing.C:
+				local.flushAccesses()
 
 			case <-local.closing:
 				return
@@ -134,6 +269,13 @@ func (local *Local) Close(ctx context.Context) error {
 	local.logger.Info("Waiting for garbage collector to stop")
 	<-local.gcStopped
 
+	local.stopReembed()
+	local.flushAccesses()
+
+	if err := local.SaveIndex(); err != nil {
+		return fmt.Errorf("failed to save index: %w", err)
+	}
+
 	if err := local.DB.Close(); err != nil {
 		return fmt.Errorf("failed to close local database: %w", err)
 	}
@@ -143,6 +285,67 @@ func (local *Local) Close(ctx context.Context) error {
 	return nil
 }
 
+// collect purges the expired memories, collects the garbage of the database
+// and saves the index, waiting for a restore to finish first.
+func (local *Local) collect() {
+	local.restoring.RLock()
+	defer local.restoring.RUnlock()
+
+	local.purgeExpired()
+
+	if err := local.CollectGarbage(); err != nil {
+		local.logger.Error("Failed to collect garbage", "error", err)
+	}
+
+	if err := local.SaveIndex(); err != nil {
+		local.logger.Error("Failed to save index", "error", err)
+	}
+}
+
+// purgeExpired forgets the expired memories, logging how many.
+func (local *Local) purgeExpired() {
+	purged, err := local.PurgeExpired()
+	if err != nil {
+		local.logger.Error("Failed to purge expired memories", "error", err)
+
+		return
+	}
+
+	if purged > 0 {
+		local.logger.Info("Purged expired memories", "memories", purged)
+	}
+}
+
+// loadEmbedding loads the embedding plugin with the name.
+func (local *Local) loadEmbedding(ctx context.Context, name string) (api.Embedding, error) {
+	// NOTE(jkoelker) Load the embedding plugin. This is a hack, we need to
+	//                formalize how plugins can call other plugins.
+	client, err := local.manager.Client(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load embedding plugin: %w", err)
+	}
+
+	protocol, err := client.Client()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load embedding protocol: %w", err)
+	}
+
+	raw, err := protocol.Dispense("embedding")
+	if err != nil {
+		return nil, fmt.Errorf("failed to dispense embedding: %w", err)
+	}
+
+	embedding, ok := raw.(api.Embedding)
+	if !ok {
+		return nil, fmt.Errorf(
+			"failed to cast embedding to api.Embedding: %w",
+			plugin.ErrUnexpectedInterface,
+		)
+	}
+
+	return embedding, nil
+}
+
 // CollectGarbage runs a garbage collectin on the database.
 func (local *Local) CollectGarbage() error {
 	if local.logger != nil {
@@ -162,97 +365,200 @@ func (local *Local) CollectGarbage() error {
 	return nil
 }
 
-// Memorize implements the `api.Memory` interface by storing the data in
-// the database, the data is embeddeed using the embedding plugin. The
-// resulting vector is binary encoded as the key and the data is stored
-// as the value.
-func (local *Local) Memorize(ctx context.Context, data []string) error {
-	local.SetupLogger(ctx)
+// Memorize implements the `api.Memory` interface by storing each record as
+// an entry with a new id in the database, the data is embeddeed using the
+// embedding plugin and the resulting vector is stored under the same id.
+// Records with a vector are trusted and not embedded again, those embedded by
+// another model are re-embedded in the background. The vectors are added to
+// the index once stored, and the keywords of the data to the keyword index.
+func (local *Local) Memorize(ctx context.Context, records []api.Record) ([]string, error) {
+	if err := local.ensureOpen(ctx); err != nil {
+		return nil, err
+	}
+
+	local.restoring.RLock()
+	defer local.restoring.RUnlock()
+
+	ids := make([]string, len(records))
+	lengths := make([]int, len(records))
+	namespaces := make([]string, len(records))
+	now := time.Now()
+	stale := 0
+
+	for idx := range records {
+		namespaces[idx] = api.Namespace(records[idx].Namespace)
 
-	if local.DB == nil {
-		if err := local.Open(ctx); err != nil {
-			return fmt.Errorf("failed to open local database: %w", err)
+		if err := ValidateNamespace(namespaces[idx]); err != nil {
+			return nil, err
 		}
 	}
 
+	embeddings, models, err := local.recordEmbeddings(ctx, records)
+	if err != nil {
+		return nil, err
+	}
+
 	if err := local.DB.Update(func(txn *badger.Txn) error {
-		for _, entry := range data {
-			embedding, err := local.embedding.Embedding(ctx, entry)
+		for idx := range records {
+			embedding := embeddings[idx]
+
+			created := records[idx].Created
+			if created.IsZero() {
+				created = now
+			}
+
+			id, err := NewID(created)
 			if err != nil {
-				return fmt.Errorf("failed to embed data: %w", err)
+				return err
+			}
+
+			entry := &Entry{
+				ID:         id,
+				Data:       records[idx].Data,
+				Created:    created,
+				Model:      models[idx],
+				Dimension:  len(embedding),
+				Metadata:   records[idx].Metadata,
+				Namespace:  namespaces[idx],
+				Importance: Importance(records[idx].Importance),
+				Accessed:   records[idx].Accessed,
+				Expires:    records[idx].Expires,
+			}
+
+			if err := setKeywords(txn, entry); err != nil {
+				return err
 			}
 
-			var buf bytes.Buffer
-			if err := binary.Write(&buf, binary.LittleEndian, embedding); err != nil {
-				return fmt.Errorf("failed to encode embedding: %w", err)
+			if err := setDocument(txn, entry); err != nil {
+				return err
 			}
 
-			if err := txn.Set(buf.Bytes(), []byte(entry)); err != nil {
-				return fmt.Errorf("failed to memorize data: %w", err)
+			if err := local.setVector(txn, entry, embedding); err != nil {
+				return err
+			}
+
+			ids[idx] = id
+			lengths[idx] = entry.Length
+
+			if local.stale(entry) {
+				local.markStale(id, true)
+				stale++
 			}
 		}
 
 		return nil
 	}); err != nil {
-		return fmt.Errorf("failed to memorize data: %w", err)
+		return nil, fmt.Errorf("failed to memorize data: %w", err)
 	}
 
-	return nil
+	for idx := range ids {
+		local.keywords.add(namespaces[idx], 1, lengths[idx])
+
+		// NOTE(jkoelker) Stale memories join the index once re-embedded.
+		if local.indexes != nil && models[idx] == local.EmbeddingModel {
+			local.indexes.Insert(namespaces[idx], ids[idx], embeddings[idx])
+		}
+	}
+
+	if stale > 0 && local.Reembed {
+		local.startReembed(stale)
+	}
+
+	return ids, nil
 }
 
-// Recall implements the `api.Memory` interface by iterating the database and
-// returning the nearest count entries, if count is not provided, it will
-// return the nearest 1 entries.
-func (local *Local) Recall(ctx context.Context, data string, count ...int) ([]string, error) {
-	local.SetupLogger(ctx)
+// Recall implements the `api.Memory` interface by searching the index, or
+// iterating the database in exact mode, and returning the nearest query count
+// records, if count is not provided, it will return the nearest 1 record.
+// Unless the fusion disables it, the keyword index is searched as well and
+// both rankings merged. Records scoring below the query minimum score are
+// dropped, those that are chunks of a document come with the neighboring
+// chunks the query asks for. Only the memories in the namespaces of the query are recalled.
+func (local *Local) Recall(ctx context.Context, query api.Query) ([]api.Record, error) {
+	results, err := local.RecallBatch(ctx, []api.Query{query})
+	if err != nil {
+		return nil, err
+	}
 
-	if local.DB == nil {
-		if err := local.Open(ctx); err != nil {
-			return nil, fmt.Errorf("failed to open local database: %w", err)
-		}
+	return results[0], nil
+}
+
+// RecallBatch implements the `api.Memory` interface by searching the index for
+// each query, or iterating the database once for all the queries in exact
+// mode. Each query is answered as by `Recall`.
+func (local *Local) RecallBatch(ctx context.Context, queries []api.Query) ([][]api.Record, error) {
+	if err := local.ensureOpen(ctx); err != nil {
+		return nil, err
 	}
 
-	nearest := 1
-	if len(count) > 0 {
-		nearest = count[0]
+	local.restoring.RLock()
+	defer local.restoring.RUnlock()
+
+	closests := make([]*Closest, len(queries))
+	data := make([]string, len(queries))
+
+	for idx := range queries {
+		data[idx] = queries[idx].Data
 	}
 
-	embedding, err := local.embedding.Embedding(ctx, data)
+	embeddings, err := local.embedBatch(ctx, data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to embed data: %w", err)
+		return nil, err
 	}
 
-	var buf bytes.Buffer
-	if err := binary.Write(&buf, binary.LittleEndian, embedding); err != nil {
-		return nil, fmt.Errorf("failed to encode embedding: %w", err)
+	for idx := range queries {
+		nearest := queryCount(&queries[idx])
+		if Ranked(queryRanking(&queries[idx])) {
+			nearest *= RankCandidates
+		}
+
+		closests[idx] = NewClosest(embeddings[idx], nearest)
+		closests[idx].Metric = local.metric
 	}
 
-	closest := NewClosest(embedding, nearest)
+	results := make([][]api.Record, len(queries))
+	now := time.Now()
 
 	if err := local.DB.View(func(txn *badger.Txn) error {
-		iter := txn.NewIterator(
-			badger.IteratorOptions{
-				PrefetchValues: false,
-			},
-		)
-		defer iter.Close()
-
-		// Iterate all the keys and keep trac of the nearest values. sorted by distance.
-		for iter.Rewind(); iter.Valid(); iter.Next() {
-			item := iter.Item()
-			key := item.Key()
+		// NOTE(jkoelker) The index does not know the metadata of the
+		//                memories, so queries filtering on metadata are
+		//                answered by a scan.
+		scanned := closests
+
+		if local.indexes != nil {
+			indexed := make([]*Closest, len(closests))
+			scanned = make([]*Closest, len(closests))
+
+			for idx := range closests {
+				if len(queries[idx].Metadata) == 0 {
+					indexed[idx] = closests[idx]
+				} else {
+					scanned[idx] = closests[idx]
+				}
+			}
 
-			var stored []float32
-			if err := binary.Read(bytes.NewReader(key), binary.LittleEndian, &stored); err != nil {
-				return fmt.Errorf("failed to decode embedding: %w", err)
+			if err := local.searchIndex(txn, indexed, queries); err != nil {
+				return err
 			}
+		}
+
+		if err := local.scanExact(txn, scanned, queries); err != nil {
+			return err
+		}
 
-			value, err := item.ValueCopy(nil)
+		for idx, closest := range closests {
+			records, err := local.recallRecords(txn, closest, &queries[idx], now)
 			if err != nil {
-				return fmt.Errorf("failed to copy value: %w", err)
+				return err
 			}
 
-			closest.Add(stored, value)
+			if queries[idx].Neighbors > 0 {
+				if err := addNeighbors(txn, records, queries[idx].Neighbors, now); err != nil {
+					return err
+				}
+			}
+
+			results[idx] = records
 		}
 
 		return nil
@@ -260,5 +566,356 @@ func (local *Local) Recall(ctx context.Context, data string, count ...int) ([]st
 		return nil, fmt.Errorf("failed to recall data: %w", err)
 	}
 
-	return closest.Strings(), nil
+	local.touch(results, now)
+
+	return results, nil
+}
+
+// queryCount returns the number of memories recalled by the query.
+func queryCount(query *api.Query) int {
+	if query.Count > 0 {
+		return query.Count
+	}
+
+	return 1
+}
+
+// queryRanking returns the ranking of the query.
+func queryRanking(query *api.Query) api.Ranking {
+	if query.Ranking != nil {
+		return *query.Ranking
+	}
+
+	return api.DefaultRanking()
+}
+
+// queryFusion returns the fusion of the query, or the configured fusion.
+func (local *Local) queryFusion(query *api.Query) api.Fusion {
+	if query.Fusion != nil {
+		return *query.Fusion
+	}
+
+	return local.Fusion
+}
+
+// touch records that the recalled memories were accessed at now, in the
+// records and in the access log written to the database every
+// `AccessFlushInterval`.
+func (local *Local) touch(results [][]api.Record, now time.Time) {
+	for _, records := range results {
+		for idx := range records {
+			records[idx].Accessed = now
+			local.accesses.add(records[idx].ID, now)
+		}
+	}
+}
+
+// scanExact iterates all the stored vectors once, in parallel, adding the id
+// of each memory in the namespaces and matching the metadata of the query to
+// the closest values of the query. Queries without closest values, and stale
+// memories, are skipped. Quantized vectors are scanned instead of the full
+// precision vectors if configured, keeping `RerankCandidates` times the
+// closest values for the full precision vectors to choose from.
+func (local *Local) scanExact(txn *badger.Txn, closests []*Closest, queries []api.Query) error {
+	scanning := false
+
+	for _, closest := range closests {
+		scanning = scanning || closest != nil
+	}
+
+	if !scanning {
+		return nil
+	}
+
+	if local.Quantization == QuantizationNone {
+		return local.scanParallel(txn, vectorPrefix, vectorPrefix, decodeInto, closests, queries,
+			func(_ string, id string) []byte {
+				return []byte(id)
+			})
+	}
+
+	// NOTE(jkoelker) Scan the quantized vectors for more candidates than
+	//                recalled, then re-rank them by their full precision
+	//                vectors.
+	candidates := make([]*Closest, len(closests))
+
+	for idx, closest := range closests {
+		if closest != nil {
+			candidates[idx] = NewClosest(closest.Base, closest.Count*RerankCandidates)
+			candidates[idx].Metric = closest.Metric
+		}
+	}
+
+	if err := local.scanParallel(
+		txn, quantizedPrefix, quantizedPrefix, dequantizeInto, candidates, queries, VectorKey,
+	); err != nil {
+		return err
+	}
+
+	return rerank(txn, closests, candidates)
+}
+
+// recordEmbeddings returns the vectors of the records and the models that
+// embedded them. The data of the records without a vector is embedded in a
+// single batch. Vectors without a model are taken to be embedded by the
+// configured model.
+func (local *Local) recordEmbeddings(ctx context.Context, records []api.Record) ([][]float32, []string, error) {
+	embeddings := make([][]float32, len(records))
+	models := make([]string, len(records))
+	missing := make([]int, 0, len(records))
+	data := make([]string, 0, len(records))
+
+	for idx := range records {
+		if len(records[idx].Vector) == 0 {
+			missing = append(missing, idx)
+			data = append(data, records[idx].Data)
+
+			continue
+		}
+
+		embeddings[idx] = records[idx].Vector
+		models[idx] = records[idx].Model
+
+		if models[idx] == "" {
+			models[idx] = local.EmbeddingModel
+		}
+
+		if local.Normalize {
+			embeddings[idx] = Normalize(embeddings[idx])
+		}
+	}
+
+	embedded, err := local.embedBatch(ctx, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for idx, record := range missing {
+		embeddings[record] = embedded[idx]
+		models[record] = local.EmbeddingModel
+	}
+
+	return embeddings, models, nil
+}
+
+// embed returns the embedding of the data, normalized if configured.
+func (local *Local) embed(ctx context.Context, data string) ([]float32, error) {
+	embedding, err := local.embedding.Embedding(ctx, local.modelName, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed data: %w", err)
+	}
+
+	if local.Normalize {
+		embedding = Normalize(embedding)
+	}
+
+	return embedding, nil
+}
+
+// embedBatch returns the embeddings of the data, normalized if configured.
+// If the embedding plugin does not support batches, the data is embedded one
+// at a time.
+func (local *Local) embedBatch(ctx context.Context, data []string) ([][]float32, error) {
+	if len(data) == 0 {
+		return [][]float32{}, nil
+	}
+
+	embeddings, err := local.embedding.EmbeddingBatch(ctx, local.modelName, data)
+
+	switch {
+	case errors.Is(err, api.ErrUnimplemented):
+		local.logger.Debug("Embedding does not support batches, embedding one at a time")
+
+		embeddings = make([][]float32, len(data))
+
+		for idx := range data {
+			if embeddings[idx], err = local.embed(ctx, data[idx]); err != nil {
+				return nil, err
+			}
+		}
+
+		return embeddings, nil
+
+	case err != nil:
+		return nil, fmt.Errorf("failed to embed data: %w", err)
+
+	case len(embeddings) != len(data):
+		return nil, fmt.Errorf("%w: %d embeddings for %d inputs", api.ErrEmbeddingCount, len(embeddings), len(data))
+	}
+
+	if local.Normalize {
+		for idx := range embeddings {
+			embeddings[idx] = Normalize(embeddings[idx])
+		}
+	}
+
+	return embeddings, nil
+}
+
+// candidate is a memory found by a recall, with its rank in the vector and
+// keyword searches, zero if it was not found by the search.
+type candidate struct {
+	entry      *Entry
+	similarity float32
+	vector     int
+	keyword    int
+}
+
+// recallRecords returns the records of the memories found by the vector and
+// keyword searches of the query scored by its ranking, keeping the query
+// count scoring at least its minimum score, best first. Without keyword
+// search, the memories are scored by their similarity, otherwise by the
+// fusion of their ranks and the searches without weight are skipped. Expired
+// memories are left out.
+func (local *Local) recallRecords(
+	txn *badger.Txn,
+	closest *Closest,
+	query *api.Query,
+	now time.Time,
+) ([]api.Record, error) {
+	if closest == nil {
+		return []api.Record{}, nil
+	}
+
+	fusion := local.queryFusion(query)
+	candidates := make(map[string]*candidate, len(closest.Values))
+
+	// NOTE(jkoelker) Without keyword search the vector search is all there
+	//                is, whatever its weight.
+	if fusion.Vector > 0 || fusion.Keyword <= 0 {
+		var err error
+
+		if candidates, err = local.vectorCandidates(txn, closest, now); err != nil {
+			return nil, err
+		}
+	}
+
+	if fusion.Keyword > 0 {
+		if err := local.keywordCandidates(txn, candidates, query, closest.Count, now); err != nil {
+			return nil, err
+		}
+	}
+
+	ranking := queryRanking(query)
+	records := make([]api.Record, 0, len(candidates))
+
+	for _, candidate := range candidates {
+		local.accesses.apply(candidate.entry)
+
+		score := candidate.similarity
+		if fusion.Keyword > 0 {
+			score = Fuse(fusion, candidate.vector, candidate.keyword)
+		}
+
+		score = Rank(ranking, score, candidate.entry, now)
+		if score < query.MinScore {
+			continue
+		}
+
+		record := candidate.entry.Record()
+		record.Score = score
+
+		records = append(records, record)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Score == records[j].Score {
+			return records[i].ID > records[j].ID
+		}
+
+		return records[i].Score > records[j].Score
+	})
+
+	if count := queryCount(query); len(records) > count {
+		records = records[:count]
+	}
+
+	return records, nil
+}
+
+// vectorCandidates returns the closest memories ranked by similarity.
+// Memories embedded by another model are left out, their vectors are not
+// comparable to the query.
+func (local *Local) vectorCandidates(
+	txn *badger.Txn,
+	closest *Closest,
+	now time.Time,
+) (map[string]*candidate, error) {
+	closest.Sort()
+
+	candidates := make(map[string]*candidate, len(closest.Values))
+
+	for _, value := range closest.Values {
+		entry, err := getEntry(txn, string(value.Value))
+		if err != nil {
+			return nil, err
+		}
+
+		if local.stale(entry) || entry.Dimension != len(closest.Base) || entry.Expired(now) {
+			continue
+		}
+
+		candidates[entry.ID] = &candidate{
+			entry:      entry,
+			similarity: closest.Metric.Similarity(value.Distance),
+			vector:     len(candidates) + 1,
+		}
+	}
+
+	return candidates, nil
+}
+
+// keywordCandidates adds the count memories best matching the keywords of the
+// query, and its metadata, to the candidates ranked by keyword. Stale memories
+// are left out as they are by the vector search, so a memory is recalled the
+// same way whichever search finds it.
+func (local *Local) keywordCandidates(
+	txn *badger.Txn,
+	candidates map[string]*candidate,
+	query *api.Query,
+	count int,
+	now time.Time,
+) error {
+	hits, err := local.searchKeywords(txn, query)
+	if err != nil {
+		return err
+	}
+
+	rank := 0
+
+	for _, hit := range hits {
+		if rank == count {
+			break
+		}
+
+		found, ok := candidates[hit.id]
+		if !ok {
+			entry, err := getEntry(txn, hit.id)
+			if err != nil {
+				return err
+			}
+
+			if local.stale(entry) || entry.Expired(now) || !query.Matches(entry.Metadata) {
+				continue
+			}
+
+			found = &candidate{entry: entry}
+			candidates[hit.id] = found
+		}
+
+		rank++
+		found.keyword = rank
+	}
+
+	return nil
+}
+
+// Encode binary encodes the embedding as it is stored in the database.
+func Encode(embedding []float32) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, embedding); err != nil {
+		return nil, fmt.Errorf("failed to encode embedding: %w", err)
+	}
+
+	return buf.Bytes(), nil
 }
@@ -0,0 +1,199 @@
+//
+
+package memory_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/lazygpt/lazygpt/plugin/api"
+	"github.com/lazygpt/lazygpt/plugin/local/pkg/memory"
+	"github.com/lazygpt/lazygpt/plugin/log"
+)
+
+// countingEmbedding counts the calls to the embedding, its batches are not
+// implemented if unbatched is set.
+type countingEmbedding struct {
+	embedding
+
+	unbatched bool
+	single    atomic.Int32
+	batches   atomic.Int32
+}
+
+func (counting *countingEmbedding) Embedding(ctx context.Context, model string, input string) ([]float32, error) {
+	counting.single.Add(1)
+
+	return counting.embedding.Embedding(ctx, model, input)
+}
+
+func (counting *countingEmbedding) EmbeddingBatch(
+	ctx context.Context,
+	model string,
+	inputs []string,
+) ([][]float32, error) {
+	if counting.unbatched {
+		return nil, api.ErrUnimplemented
+	}
+
+	counting.batches.Add(1)
+
+	return counting.embedding.EmbeddingBatch(ctx, model, inputs)
+}
+
+func TestMemorizeBatch(t *testing.T) {
+	t.Parallel()
+
+	ctx := log.NewContext(context.Background(), log.NewLogger("test"))
+
+	for _, unbatched := range []bool{false, true} {
+		counting := &countingEmbedding{unbatched: unbatched}
+
+		local := memory.NewLocal(t.TempDir())
+		local.EmbeddingModel = "fake/v1"
+		local.Embedding = counting
+		local.Cache = false
+
+		assert.NilError(t, local.Open(ctx))
+
+		_, err := local.Memorize(ctx, []api.Record{
+			{Data: "a"},
+			{Data: "bb", Vector: []float32{2, 1}},
+			{Data: "ccc"},
+		})
+		assert.NilError(t, err)
+
+		records, err := local.RecallBatch(ctx, []api.Query{{Data: "a"}, {Data: "ccc"}})
+		assert.NilError(t, err)
+		assert.Equal(t, records[0][0].Data, "a")
+		assert.Equal(t, records[1][0].Data, "ccc")
+
+		if unbatched {
+			assert.Equal(t, counting.batches.Load(), int32(0))
+			assert.Equal(t, counting.single.Load(), int32(4))
+		} else {
+			assert.Equal(t, counting.batches.Load(), int32(2))
+			assert.Equal(t, counting.single.Load(), int32(0))
+		}
+
+		assert.NilError(t, local.Close(ctx))
+	}
+}
+
+func TestEmbeddingCache(t *testing.T) {
+	t.Parallel()
+
+	ctx := log.NewContext(context.Background(), log.NewLogger("test"))
+	dir := t.TempDir()
+
+	// NOTE(jkoelker) The embeddings are cached per plugin and model, the
+	//                second open finds them all in the cache.
+	for _, test := range []struct {
+		model   string
+		batches int32
+	}{
+		{model: "fake/v1", batches: 1},
+		{model: "fake/v1", batches: 0},
+		{model: "other/v1", batches: 1},
+	} {
+		counting := &countingEmbedding{}
+
+		local := memory.NewLocal(dir)
+		local.EmbeddingModel = test.model
+		local.Embedding = counting
+		local.Reembed = false
+
+		assert.NilError(t, local.Open(ctx))
+
+		_, err := local.Memorize(ctx, []api.Record{{Data: "a"}, {Data: "bb"}})
+		assert.NilError(t, err)
+
+		records, err := local.Recall(ctx, api.Query{Data: "bb"})
+		assert.NilError(t, err)
+		assert.Equal(t, records[0].Data, "bb")
+
+		assert.Equal(t, counting.batches.Load(), test.batches, test.model)
+		assert.Equal(t, counting.single.Load(), int32(0), test.model)
+
+		assert.NilError(t, local.Close(ctx))
+	}
+}
+
+func TestBuiltinEmbedding(t *testing.T) {
+	t.Parallel()
+
+	ctx := log.NewContext(context.Background(), log.NewLogger("test"))
+
+	local := memory.NewLocal(t.TempDir())
+	local.EmbeddingModel = memory.BuiltinEmbeddingPlugin + "/hashed-128"
+
+	assert.NilError(t, local.Open(ctx))
+
+	_, err := local.Memorize(ctx, []api.Record{
+		{Data: "The deploy pipeline runs on every merge to main."},
+		{Data: "Rotate the database credentials every ninety days."},
+		{Data: "Lunch is served at noon on Fridays."},
+	})
+	assert.NilError(t, err)
+
+	records, err := local.Recall(ctx, api.Query{Data: "when do we rotate credentials", Fusion: &api.Fusion{Vector: 1}})
+	assert.NilError(t, err)
+	assert.Equal(t, records[0].Data, "Rotate the database credentials every ninety days.")
+	assert.Equal(t, records[0].Model, "local/hashed-128")
+
+	assert.NilError(t, local.Close(ctx))
+
+	local = memory.NewLocal(t.TempDir())
+	local.EmbeddingModel = memory.BuiltinEmbeddingPlugin + "/ada"
+
+	assert.ErrorContains(t, local.Open(ctx), "unknown embedding model")
+}
+
+func TestUpdate(t *testing.T) {
+	t.Parallel()
+
+	ctx := log.NewContext(context.Background(), log.NewLogger("test"))
+	counting := &countingEmbedding{}
+
+	local := memory.NewLocal(t.TempDir())
+	local.EmbeddingModel = "fake/v1"
+	local.Embedding = counting
+	local.Reembed = false
+
+	assert.NilError(t, local.Open(ctx))
+
+	ids, err := local.Memorize(ctx, []api.Record{{Data: "a"}})
+	assert.NilError(t, err)
+
+	// NOTE(jkoelker) An update without data or with the same data keeps the
+	//                data and its embedding.
+	assert.NilError(t, local.Update(ctx, api.Record{ID: ids[0], Metadata: map[string]string{"k": "v"}}))
+	assert.NilError(t, local.Update(ctx, api.Record{ID: ids[0], Data: "a"}))
+	assert.Equal(t, counting.single.Load(), int32(0))
+
+	record, err := local.Get(ctx, ids[0])
+	assert.NilError(t, err)
+	assert.Equal(t, record.Data, "a")
+
+	assert.NilError(t, local.Update(ctx, api.Record{ID: ids[0], Data: "bb"}))
+	assert.Equal(t, counting.single.Load(), int32(1))
+
+	records, err := local.Recall(ctx, api.Query{Data: "bb"})
+	assert.NilError(t, err)
+	assert.Equal(t, records[0].Data, "bb")
+
+	// NOTE(jkoelker) An update of the importance alone keeps the data and
+	//                the metadata.
+	assert.NilError(t, local.Update(ctx, api.Record{ID: ids[0], Importance: 0.9}))
+
+	record, err = local.Get(ctx, ids[0])
+	assert.NilError(t, err)
+	assert.Equal(t, record.Data, "bb")
+	assert.Equal(t, record.Importance, float32(0.9))
+	assert.DeepEqual(t, record.Metadata, map[string]string{"k": "v"})
+
+	assert.NilError(t, local.Close(ctx))
+}
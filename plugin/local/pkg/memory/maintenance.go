@@ -0,0 +1,226 @@
+//
+
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"github.com/lazygpt/lazygpt/plugin/api"
+)
+
+const (
+	// restorePendingWrites is the number of batches of a backup written to
+	// the database at once when it is restored.
+	restorePendingWrites = 256
+
+	// restoreRollbackPattern is the pattern of the name of the backup of the
+	// database taken before a restore, in the data directory.
+	restoreRollbackPattern = "restore-*.backup"
+)
+
+var _ api.Maintenance = (*Local)(nil)
+
+// Backup implements the `api.Maintenance` interface by writing a snapshot of
+// the database to the writer. Memories stored while it runs are not part of
+// the backup.
+func (local *Local) Backup(ctx context.Context, writer io.Writer) error {
+	if err := local.ensureOpen(ctx); err != nil {
+		return err
+	}
+
+	local.restoring.RLock()
+	defer local.restoring.RUnlock()
+
+	local.logger.Info("Backing up local database")
+
+	if _, err := local.DB.Backup(writer, 0); err != nil {
+		return fmt.Errorf("failed to back up local database: %w", err)
+	}
+
+	return nil
+}
+
+// Restore implements the `api.Maintenance` interface by replacing the
+// database with the backup read from the reader. The backup is migrated and
+// quantized as when the database is opened, and the indexes are rebuilt.
+// Other calls and the garbage collector wait for the restore to finish, those
+// already running finish first. The database is backed up to a file in the
+// data directory first, a backup failing to restore is rolled back to it.
+func (local *Local) Restore(ctx context.Context, reader io.Reader) error {
+	if err := local.ensureOpen(ctx); err != nil {
+		return err
+	}
+
+	local.restoring.Lock()
+	defer local.restoring.Unlock()
+
+	local.logger.Info("Backing up local database before restoring")
+
+	rollback, err := os.CreateTemp(local.DataDir, restoreRollbackPattern)
+	if err != nil {
+		return fmt.Errorf("failed to create rollback backup: %w", err)
+	}
+
+	defer os.Remove(rollback.Name())
+	defer rollback.Close()
+
+	if _, err := local.DB.Backup(rollback, 0); err != nil {
+		return fmt.Errorf("failed to back up local database: %w", err)
+	}
+
+	local.logger.Info("Restoring local database")
+
+	restoreErr := local.restore(reader)
+	if restoreErr == nil {
+		return nil
+	}
+
+	local.logger.Error("Failed to restore local database, rolling back", "error", restoreErr)
+
+	if _, err := rollback.Seek(0, io.SeekStart); err != nil {
+		return errors.Join(restoreErr, fmt.Errorf("failed to roll back: %w", err))
+	}
+
+	if err := local.restore(rollback); err != nil {
+		return errors.Join(restoreErr, fmt.Errorf("failed to roll back: %w", err))
+	}
+
+	return restoreErr
+}
+
+// restore replaces the database with the backup read from the reader.
+func (local *Local) restore(reader io.Reader) error {
+	// NOTE(jkoelker) The re-embed job writes to the memories being
+	//                dropped, it is started again for the restored ones
+	//                once they are found stale.
+	local.stopReembed()
+	local.clearStale()
+	local.accesses.reset()
+
+	if err := local.DB.DropAll(); err != nil {
+		return fmt.Errorf("failed to drop local database: %w", err)
+	}
+
+	if err := local.DB.Load(reader, restorePendingWrites); err != nil {
+		return fmt.Errorf("failed to load backup: %w", err)
+	}
+
+	migrated, err := local.migrate()
+	if err != nil {
+		return fmt.Errorf("failed to migrate backup: %w", err)
+	}
+
+	if err := local.openQuantized(migrated); err != nil {
+		return err
+	}
+
+	if local.Index == IndexHNSW {
+		if err := local.RebuildIndex(); err != nil {
+			return fmt.Errorf("failed to rebuild index: %w", err)
+		}
+	}
+
+	if err := local.loadKeywordStats(); err != nil {
+		return err
+	}
+
+	return local.checkModels()
+}
+
+// Compact implements the `api.Maintenance` interface by compacting the
+// tables of the database into one level and collecting the garbage of the
+// value log until there is none left.
+func (local *Local) Compact(ctx context.Context) (*api.Compaction, error) {
+	if err := local.ensureOpen(ctx); err != nil {
+		return nil, err
+	}
+
+	local.restoring.RLock()
+	defer local.restoring.RUnlock()
+
+	local.logger.Info("Compacting local database")
+
+	compaction := &api.Compaction{}
+
+	// NOTE(jkoelker) Badger only updates `DB.Size` every minute, measure
+	//                the files instead.
+	before, err := databaseSize(local.DB.Opts().Dir, local.DB.Opts().ValueDir)
+	if err != nil {
+		return nil, err
+	}
+
+	compaction.Before = before
+
+	if err := local.DB.Flatten(runtime.NumCPU()); err != nil {
+		return nil, fmt.Errorf("failed to flatten local database: %w", err)
+	}
+
+	for {
+		err := local.DB.RunValueLogGC(GarbageCollectionDiscardRatio)
+		if err == nil {
+			continue
+		}
+
+		// NOTE(jkoelker) `badger.ErrRejected` is returned while the
+		//                garbage collector is running, it is collecting
+		//                for us.
+		if errors.Is(err, badger.ErrNoRewrite) || errors.Is(err, badger.ErrRejected) {
+			break
+		}
+
+		return nil, fmt.Errorf("failed to run garbage collection: %w", err)
+	}
+
+	after, err := databaseSize(local.DB.Opts().Dir, local.DB.Opts().ValueDir)
+	if err != nil {
+		return nil, err
+	}
+
+	compaction.After = after
+
+	return compaction, nil
+}
+
+// databaseSize returns the space the files in the directories of the
+// database take on disk.
+func databaseSize(dirs ...string) (int64, error) {
+	var size int64
+
+	seen := make(map[string]bool, len(dirs))
+
+	for _, dir := range dirs {
+		if seen[dir] {
+			continue
+		}
+
+		seen[dir] = true
+
+		if err := filepath.WalkDir(dir, func(_ string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() {
+				return err
+			}
+
+			info, err := entry.Info()
+			if err != nil {
+				return err //nolint:wrapcheck // wrapped below
+			}
+
+			size += diskSize(info)
+
+			return nil
+		}); err != nil {
+			return 0, fmt.Errorf("failed to measure local database: %w", err)
+		}
+	}
+
+	return size, nil
+}
@@ -0,0 +1,252 @@
+//
+
+package memory_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/lazygpt/lazygpt/plugin/api"
+	"github.com/lazygpt/lazygpt/plugin/local/pkg/memory"
+	"github.com/lazygpt/lazygpt/plugin/log"
+)
+
+// recordIDs returns the ids of the records in order.
+func recordIDs(records []api.Record) []string {
+	ids := make([]string, len(records))
+	for idx := range records {
+		ids[idx] = records[idx].ID
+	}
+
+	return ids
+}
+
+func TestBackupRestore(t *testing.T) {
+	t.Parallel()
+
+	ctx := log.NewContext(context.Background(), log.NewLogger("test"))
+	query := api.Query{Data: "when do we rotate credentials", Count: 3, Fusion: &api.Fusion{Vector: 1}}
+
+	local := memory.NewLocal(t.TempDir())
+	local.EmbeddingModel = memory.BuiltinEmbeddingPlugin + "/hashed-128"
+
+	assert.NilError(t, local.Open(ctx))
+
+	ids, err := local.Memorize(ctx, []api.Record{
+		{Data: "The deploy pipeline runs on every merge to main."},
+		{Data: "Rotate the database credentials every ninety days."},
+		{Data: "Lunch is served at noon on Fridays.", Namespace: "office"},
+	})
+	assert.NilError(t, err)
+
+	expected, err := local.Recall(ctx, query)
+	assert.NilError(t, err)
+
+	var backup bytes.Buffer
+
+	assert.NilError(t, local.Backup(ctx, &backup))
+
+	assert.NilError(t, local.Delete(ctx, ids[1:2]))
+
+	added, err := local.Memorize(ctx, []api.Record{{Data: "Rotate the tires every winter."}})
+	assert.NilError(t, err)
+
+	// NOTE(jkoelker) Restoring drops the changes made since the backup and
+	//                the index is rebuilt from the restored vectors.
+	assert.NilError(t, local.Restore(ctx, bytes.NewReader(backup.Bytes())))
+
+	records, err := local.Recall(ctx, query)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, recordIDs(records), recordIDs(expected))
+
+	_, err = local.Get(ctx, added[0])
+	assert.ErrorIs(t, err, api.ErrNotFound)
+
+	record, err := local.Get(ctx, ids[2])
+	assert.NilError(t, err)
+	assert.Equal(t, record.Namespace, "office")
+
+	assert.NilError(t, local.Close(ctx))
+
+	// NOTE(jkoelker) A backup restores into another database, quantized and
+	//                indexed as it is configured.
+	other := memory.NewLocal(t.TempDir())
+	other.EmbeddingModel = memory.BuiltinEmbeddingPlugin + "/hashed-128"
+	other.Index = memory.IndexExact
+	other.Quantization = memory.QuantizationNone
+
+	assert.NilError(t, other.Restore(ctx, bytes.NewReader(backup.Bytes())))
+
+	records, err = other.Recall(ctx, query)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, recordIDs(records), recordIDs(expected))
+
+	assert.NilError(t, other.Close(ctx))
+}
+
+func TestRestoreFailed(t *testing.T) {
+	t.Parallel()
+
+	ctx := log.NewContext(context.Background(), log.NewLogger("test"))
+
+	local := openLocal(t, ctx, t.TempDir(), "fake/v1", false)
+
+	ids, err := local.Memorize(ctx, []api.Record{{Data: "a"}, {Data: "bb"}})
+	assert.NilError(t, err)
+
+	var backup bytes.Buffer
+
+	assert.NilError(t, local.Backup(ctx, &backup))
+
+	added, err := local.Memorize(ctx, []api.Record{{Data: "ccc"}})
+	assert.NilError(t, err)
+
+	// NOTE(jkoelker) A truncated backup fails to load, the database is
+	//                rolled back to the memories it had before.
+	truncated := backup.Bytes()[:backup.Len()/2]
+	assert.Assert(t, local.Restore(ctx, bytes.NewReader(truncated)) != nil)
+
+	records, err := local.Recall(ctx, api.Query{Data: "bb", Count: 3, Fusion: &api.Fusion{Vector: 1}})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, recordIDs(records), []string{ids[1], added[0], ids[0]})
+
+	assert.NilError(t, local.Close(ctx))
+}
+
+func TestCompact(t *testing.T) {
+	t.Parallel()
+
+	ctx := log.NewContext(context.Background(), log.NewLogger("test"))
+
+	local := memory.NewLocal(t.TempDir())
+	local.EmbeddingModel = memory.BuiltinEmbeddingPlugin + "/hashed-32"
+
+	records := make([]api.Record, 200)
+	for idx := range records {
+		records[idx] = api.Record{Data: fmt.Sprintf("memory %d", idx), Namespace: fmt.Sprint(idx % 2)}
+	}
+
+	ids, err := local.Memorize(ctx, records)
+	assert.NilError(t, err)
+	assert.NilError(t, local.Clear(ctx, "0"))
+
+	compaction, err := local.Compact(ctx)
+	assert.NilError(t, err)
+	assert.Assert(t, compaction.Before > 0)
+	assert.Assert(t, compaction.After > 0)
+
+	record, err := local.Get(ctx, ids[1])
+	assert.NilError(t, err)
+	assert.Equal(t, record.Data, "memory 1")
+
+	_, err = local.Get(ctx, ids[0])
+	assert.ErrorIs(t, err, api.ErrNotFound)
+
+	assert.NilError(t, local.Close(ctx))
+}
+
+func TestRestoreStale(t *testing.T) {
+	t.Parallel()
+
+	ctx := log.NewContext(context.Background(), log.NewLogger("test"))
+	dir := t.TempDir()
+
+	local := openLocal(t, ctx, dir, "fake/v1", false)
+
+	ids, err := local.Memorize(ctx, []api.Record{{Data: "a"}})
+	assert.NilError(t, err)
+	assert.NilError(t, local.Close(ctx))
+
+	// NOTE(jkoelker) The memory is stale in the first backup and
+	//                re-embedded by the update in the second.
+	local = openLocal(t, ctx, dir, "fake/v2", false)
+
+	var stale, fresh bytes.Buffer
+
+	assert.NilError(t, local.Backup(ctx, &stale))
+	assert.NilError(t, local.Update(ctx, api.Record{ID: ids[0], Data: "bb"}))
+	assert.NilError(t, local.Backup(ctx, &fresh))
+
+	assert.NilError(t, local.Restore(ctx, bytes.NewReader(stale.Bytes())))
+
+	query := api.Query{Data: "bb", Fusion: &api.Fusion{Vector: 1}}
+
+	records, err := local.Recall(ctx, query)
+	assert.NilError(t, err)
+	assert.Equal(t, len(records), 0)
+
+	assert.NilError(t, local.Restore(ctx, bytes.NewReader(fresh.Bytes())))
+
+	records, err = local.Recall(ctx, query)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, recordIDs(records), ids)
+
+	assert.NilError(t, local.Close(ctx))
+}
+
+func TestRestoreConcurrent(t *testing.T) {
+	t.Parallel()
+
+	ctx := log.NewContext(context.Background(), log.NewLogger("test"))
+	query := api.Query{Data: "memory", Count: 3}
+
+	local := memory.NewLocal(t.TempDir())
+	local.EmbeddingModel = memory.BuiltinEmbeddingPlugin + "/hashed-32"
+
+	records := make([]api.Record, 50)
+	for idx := range records {
+		records[idx] = api.Record{Data: fmt.Sprintf("memory %d", idx)}
+	}
+
+	_, err := local.Memorize(ctx, records)
+	assert.NilError(t, err)
+
+	var backup bytes.Buffer
+
+	assert.NilError(t, local.Backup(ctx, &backup))
+
+	// NOTE(jkoelker) Calls made while the backup is restored wait for it and
+	//                find every memory.
+	done := make(chan struct{})
+	recalled := make(chan error)
+
+	go func() {
+		defer close(recalled)
+
+		for {
+			select {
+			case <-done:
+				return
+
+			default:
+			}
+
+			found, err := local.Recall(ctx, query)
+			if err == nil && len(found) != query.Count {
+				err = fmt.Errorf("recalled %d memories", len(found))
+			}
+
+			if err != nil {
+				recalled <- err
+
+				return
+			}
+		}
+	}()
+
+	for restore := 0; restore < 5; restore++ {
+		assert.NilError(t, local.Restore(ctx, bytes.NewReader(backup.Bytes())))
+	}
+
+	close(done)
+
+	for err := range recalled {
+		assert.NilError(t, err)
+	}
+
+	assert.NilError(t, local.Close(ctx))
+}
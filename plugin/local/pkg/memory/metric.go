@@ -0,0 +1,145 @@
+//
+
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+const (
+	// MetricCosine compares the angle between vectors, ignoring their
+	// magnitude. Most embedding providers are tuned for it.
+	MetricCosine = "cosine"
+
+	// MetricDot compares the dot product of the vectors. It is the same as
+	// cosine for normalized vectors, and cheaper.
+	MetricDot = "dot"
+
+	// MetricEuclidean compares the squared euclidean distance between the
+	// vectors.
+	MetricEuclidean = "euclidean"
+)
+
+// ErrUnknownMetric is returned when the metric is not known.
+var ErrUnknownMetric = errors.New("unknown metric")
+
+// Metric is a way of comparing vectors. Distances are used to order vectors,
+// smaller is closer, while similarity scores are returned to callers, larger
+// is more similar.
+type Metric struct {
+	// Name of the metric.
+	Name string
+
+	// Distance between two vectors.
+	Distance func(base []float32, other []float32) float32
+
+	// Similarity converts a distance into a similarity score.
+	Similarity func(distance float32) float32
+}
+
+// Cosine returns the cosine metric, with scores in `[-1, 1]`.
+func Cosine() Metric {
+	return Metric{
+		Name:     MetricCosine,
+		Distance: CosineDistance,
+		Similarity: func(distance float32) float32 {
+			return 1 - distance
+		},
+	}
+}
+
+// Dot returns the dot product metric, with the dot product as the score.
+func Dot() Metric {
+	return Metric{
+		Name:     MetricDot,
+		Distance: DotDistance,
+		Similarity: func(distance float32) float32 {
+			return -distance
+		},
+	}
+}
+
+// Euclidean returns the squared euclidean metric, with scores in `(0, 1]`.
+func Euclidean() Metric {
+	return Metric{
+		Name:       MetricEuclidean,
+		Distance:   Distance,
+		Similarity: Similarity,
+	}
+}
+
+// LookupMetric returns the metric with the name.
+func LookupMetric(name string) (Metric, error) {
+	switch name {
+	case MetricCosine:
+		return Cosine(), nil
+	case MetricDot:
+		return Dot(), nil
+	case MetricEuclidean:
+		return Euclidean(), nil
+	default:
+		return Metric{}, fmt.Errorf("%w: %s", ErrUnknownMetric, name)
+	}
+}
+
+// Score returns the similarity score of two vectors.
+func (metric Metric) Score(base []float32, other []float32) float32 {
+	return metric.Similarity(metric.Distance(base, other))
+}
+
+// dot returns the dot product of two vectors of the same length.
+func dot(base []float32, other []float32) float32 {
+	var sum float32
+
+	for i := range base {
+		sum += base[i] * other[i]
+	}
+
+	return sum
+}
+
+// DotDistance calculates the negated dot product of two vectors. If the
+// vectors are not the same length, the distance is meaningless and will be
+// `math.MaxFloat32`.
+func DotDistance(base []float32, other []float32) float32 {
+	if len(base) != len(other) {
+		return math.MaxFloat32
+	}
+
+	return -dot(base, other)
+}
+
+// CosineDistance calculates one minus the cosine similarity of two vectors,
+// from `0` for the same direction to `2` for opposite directions. If the
+// vectors are not the same length, or either is zero, the distance is
+// meaningless and will be `math.MaxFloat32`.
+func CosineDistance(base []float32, other []float32) float32 {
+	if len(base) != len(other) {
+		return math.MaxFloat32
+	}
+
+	norms := math.Sqrt(float64(dot(base, base)) * float64(dot(other, other)))
+	if norms == 0 {
+		return math.MaxFloat32
+	}
+
+	return 1 - float32(float64(dot(base, other))/norms)
+}
+
+// Normalize returns a copy of the vector scaled to unit length. The zero
+// vector is returned as is.
+func Normalize(vector []float32) []float32 {
+	norm := math.Sqrt(float64(dot(vector, vector)))
+	if norm == 0 {
+		return vector
+	}
+
+	normalized := make([]float32, len(vector))
+	for i := range vector {
+		normalized[i] = float32(float64(vector[i]) / norm)
+	}
+
+	return normalized
+}
@@ -0,0 +1,375 @@
+//
+
+package memory
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	// QuantizationNone scans the full precision vectors on recall.
+	QuantizationNone = "none"
+
+	// QuantizationFloat16 scans a copy of the vectors in half precision, half
+	// the size of the full vectors.
+	QuantizationFloat16 = "float16"
+
+	// QuantizationInt8 scans a copy of the vectors with a byte per dimension
+	// and a scale per vector, a quarter of the size of the full vectors.
+	QuantizationInt8 = "int8"
+
+	// RerankCandidates is how many candidates per memory recalled the scan of
+	// the quantized vectors keeps, they are re-ranked by their full precision
+	// vectors.
+	RerankCandidates = 4
+
+	// VectorValueThreshold is the size from which values are kept in the
+	// value log of the database when the vectors are quantized. The full
+	// precision vectors of the embedding models are larger, so they are only
+	// read to re-rank the candidates, while the quantized vectors, smaller,
+	// are kept in the tables the scan iterates.
+	VectorValueThreshold = 4 << 10
+
+	// int8Levels is the largest magnitude of a dimension quantized to int8.
+	int8Levels = 127
+)
+
+// quantized vector formats, the first byte of an encoded quantized vector.
+const (
+	formatFloat16 byte = iota + 1
+	formatInt8
+)
+
+var (
+	// ErrUnknownQuantization is returned when the quantization is not known.
+	ErrUnknownQuantization = errors.New("unknown quantization")
+
+	// ErrInvalidQuantized is returned when a quantized vector can not be
+	// decoded.
+	ErrInvalidQuantized = errors.New("invalid quantized vector")
+
+	// quantizationKey records the quantization of the vectors in the
+	// quantized key space.
+	quantizationKey = []byte("quantization")
+)
+
+// ValidateQuantization returns an error wrapping `ErrUnknownQuantization` if
+// the quantization is not known.
+func ValidateQuantization(quantization string) error {
+	switch quantization {
+	case QuantizationNone, QuantizationFloat16, QuantizationInt8:
+		return nil
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownQuantization, quantization)
+	}
+}
+
+// QuantizedNamespacePrefix returns the prefix of the keys of the quantized
+// vectors of the namespace.
+func QuantizedNamespacePrefix(namespace string) []byte {
+	return append(append(append([]byte{}, quantizedPrefix...), namespace...), namespaceSeparator)
+}
+
+// QuantizedKey returns the key the quantized vector of the memory with the id
+// in the namespace is stored under.
+func QuantizedKey(namespace string, id string) []byte {
+	return append(QuantizedNamespacePrefix(namespace), id...)
+}
+
+// Quantize encodes the vector with the quantization, either
+// `QuantizationFloat16` or `QuantizationInt8`. Int8 vectors are scaled so
+// their largest dimension is `int8Levels`, the scale is stored before them.
+func Quantize(vector []float32, quantization string) ([]byte, error) {
+	switch quantization {
+	case QuantizationFloat16:
+		encoded := make([]byte, 1, 1+2*len(vector))
+		encoded[0] = formatFloat16
+
+		for _, value := range vector {
+			encoded = binary.LittleEndian.AppendUint16(encoded, Float16(value))
+		}
+
+		return encoded, nil
+
+	case QuantizationInt8:
+		var largest float64
+		for _, value := range vector {
+			largest = math.Max(largest, math.Abs(float64(value)))
+		}
+
+		scale := float32(largest / int8Levels)
+
+		encoded := make([]byte, 1, 1+binary.Size(scale)+len(vector))
+		encoded[0] = formatInt8
+		encoded = binary.LittleEndian.AppendUint32(encoded, math.Float32bits(scale))
+
+		for _, value := range vector {
+			var level float64
+			if scale > 0 {
+				level = math.Round(float64(value / scale))
+			}
+
+			level = math.Max(-int8Levels, math.Min(int8Levels, level))
+			encoded = append(encoded, byte(int8(level)))
+		}
+
+		return encoded, nil
+
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownQuantization, quantization)
+	}
+}
+
+// Dequantize decodes a vector encoded by `Quantize`.
+func Dequantize(data []byte) ([]float32, error) {
+	return dequantizeInto(nil, data)
+}
+
+// dequantizeInto decodes a vector encoded by `Quantize` into the vector,
+// growing it if it is too short, and returns it.
+func dequantizeInto(vector []float32, data []byte) ([]float32, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: empty", ErrInvalidQuantized)
+	}
+
+	format, data := data[0], data[1:]
+
+	switch format {
+	case formatFloat16:
+		if len(data)%2 != 0 {
+			return nil, fmt.Errorf("%w: %d bytes of float16", ErrInvalidQuantized, len(data))
+		}
+
+		vector = grow(vector, len(data)/2)
+		for idx := range vector {
+			vector[idx] = Float32(binary.LittleEndian.Uint16(data[2*idx:]))
+		}
+
+		return vector, nil
+
+	case formatInt8:
+		if len(data) < binary.Size(float32(0)) {
+			return nil, fmt.Errorf("%w: missing int8 scale", ErrInvalidQuantized)
+		}
+
+		scale := math.Float32frombits(binary.LittleEndian.Uint32(data))
+		data = data[binary.Size(scale):]
+
+		vector = grow(vector, len(data))
+		for idx := range vector {
+			vector[idx] = float32(int8(data[idx])) * scale
+		}
+
+		return vector, nil
+
+	default:
+		return nil, fmt.Errorf("%w: format %d", ErrInvalidQuantized, format)
+	}
+}
+
+// Float16 returns the IEEE 754 half precision bits of the value, rounded to
+// the nearest. Values too large for half precision become infinite, values
+// too small become zero.
+func Float16(value float32) uint16 {
+	bits := math.Float32bits(value)
+	sign := uint16(bits>>16) & 0x8000 //nolint:gomnd // sign bit
+	exponent := int(bits>>23&0xff) - 127 + 15
+	mantissa := bits & 0x7fffff
+
+	switch {
+	case bits>>23&0xff == 0xff:
+		if mantissa != 0 {
+			return sign | 0x7e00
+		}
+
+		return sign | 0x7c00
+
+	case exponent >= 0x1f:
+		return sign | 0x7c00
+
+	case exponent <= 0:
+		if exponent < -10 {
+			return sign
+		}
+
+		// NOTE(jkoelker) Subnormal half, shift the mantissa with its
+		//                implicit bit into the 10 bits and round.
+		mantissa |= 0x800000
+		shift := uint(14 - exponent)
+		half := uint16(mantissa >> shift)
+
+		if mantissa>>(shift-1)&1 == 1 {
+			half++
+		}
+
+		return sign | half
+	}
+
+	half := sign | uint16(exponent)<<10 | uint16(mantissa>>13)
+
+	// NOTE(jkoelker) Rounding up may carry into the exponent, which is the
+	//                correctly rounded result, up to infinity.
+	if mantissa&0x1000 != 0 {
+		half++
+	}
+
+	return half
+}
+
+// Float32 returns the value of the IEEE 754 half precision bits.
+func Float32(half uint16) float32 {
+	sign := uint32(half&0x8000) << 16
+	exponent := uint32(half>>10) & 0x1f
+	mantissa := uint32(half & 0x3ff)
+
+	switch exponent {
+	case 0:
+		value := float32(mantissa) / (1 << 24)
+		if sign != 0 {
+			value = -value
+		}
+
+		return value
+
+	case 0x1f:
+		return math.Float32frombits(sign | 0x7f800000 | mantissa<<13)
+
+	default:
+		return math.Float32frombits(sign | (exponent-15+127)<<23 | mantissa<<13)
+	}
+}
+
+// rerank adds the candidates of each query, found by their quantized vectors,
+// to the closest values of the query by their full precision vectors. The
+// values of the candidates are the keys of the full precision vectors.
+func rerank(txn *badger.Txn, closests []*Closest, candidates []*Closest) error {
+	for idx, closest := range closests {
+		if closest == nil {
+			continue
+		}
+
+		for _, candidate := range candidates[idx].Values {
+			item, err := txn.Get(candidate.Value)
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				continue
+			}
+
+			if err != nil {
+				return fmt.Errorf("failed to get vector: %w", err)
+			}
+
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return fmt.Errorf("failed to copy vector: %w", err)
+			}
+
+			vector, err := Decode(value)
+			if err != nil {
+				return err
+			}
+
+			_, id := parseVectorKey(candidate.Value)
+			closest.Add(vector, []byte(id))
+		}
+	}
+
+	return nil
+}
+
+// setQuantized stores the quantized vector of the entry, unless vectors are
+// not quantized.
+func (local *Local) setQuantized(txn *badger.Txn, entry *Entry, vector []float32) error {
+	if local.Quantization == QuantizationNone {
+		return nil
+	}
+
+	encoded, err := Quantize(vector, local.Quantization)
+	if err != nil {
+		return err
+	}
+
+	if err := txn.Set(QuantizedKey(entry.Namespace, entry.ID), encoded); err != nil {
+		return fmt.Errorf("failed to store quantized vector: %w", err)
+	}
+
+	return nil
+}
+
+// setVector stores the entry, its vector and its quantized vector.
+func (local *Local) setVector(txn *badger.Txn, entry *Entry, vector []float32) error {
+	if err := setEntry(txn, entry, vector); err != nil {
+		return err
+	}
+
+	return local.setQuantized(txn, entry, vector)
+}
+
+// openQuantized quantizes the stored vectors again if they were quantized
+// differently, or the database was migrated. The quantization is recorded
+// last so an interrupted run starts over on the next open.
+func (local *Local) openQuantized(migrated bool) error {
+	var stored []byte
+
+	if err := local.DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(quantizationKey)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		}
+
+		if err != nil {
+			return err //nolint:wrapcheck // wrapped below
+		}
+
+		stored, err = item.ValueCopy(nil)
+
+		return err //nolint:wrapcheck // wrapped below
+	}); err != nil {
+		return fmt.Errorf("failed to get quantization: %w", err)
+	}
+
+	if !migrated && bytes.Equal(stored, []byte(local.Quantization)) {
+		return nil
+	}
+
+	local.logger.Info("Quantizing vectors", "from", string(stored), "to", local.Quantization)
+
+	if err := local.DB.DropPrefix(quantizedPrefix); err != nil {
+		return fmt.Errorf("failed to drop quantized vectors: %w", err)
+	}
+
+	if local.Quantization != QuantizationNone {
+		batch := local.DB.NewWriteBatch()
+		defer batch.Cancel()
+
+		if err := local.DB.View(func(txn *badger.Txn) error {
+			return vectors(txn, vectorPrefix, func(namespace string, id string, vector []float32) error {
+				encoded, err := Quantize(vector, local.Quantization)
+				if err != nil {
+					return err
+				}
+
+				return batch.Set(QuantizedKey(namespace, id), encoded) //nolint:wrapcheck // wrapped below
+			})
+		}); err != nil {
+			return fmt.Errorf("failed to quantize vectors: %w", err)
+		}
+
+		if err := batch.Flush(); err != nil {
+			return fmt.Errorf("failed to store quantized vectors: %w", err)
+		}
+	}
+
+	if err := local.DB.Update(func(txn *badger.Txn) error {
+		return txn.Set(quantizationKey, []byte(local.Quantization))
+	}); err != nil {
+		return fmt.Errorf("failed to set quantization: %w", err)
+	}
+
+	return nil
+}
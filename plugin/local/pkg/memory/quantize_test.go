@@ -0,0 +1,177 @@
+//
+
+package memory_test
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/lazygpt/lazygpt/plugin/api"
+	"github.com/lazygpt/lazygpt/plugin/local/pkg/memory"
+	"github.com/lazygpt/lazygpt/plugin/log"
+)
+
+func TestFloat16(t *testing.T) {
+	t.Parallel()
+
+	for value, half := range map[float32]uint16{
+		0:                     0x0000,
+		1:                     0x3c00,
+		-2:                    0xc000,
+		0.5:                   0x3800,
+		65504:                 0x7bff,
+		float32(math.Inf(-1)): 0xfc00,
+		1.0 / (1 << 24):       0x0001,
+		1.0 / (1 << 15):       0x0200,
+		1.0 / (1 << 14):       0x0400,
+	} {
+		assert.Equal(t, memory.Float16(value), half, "%g", value)
+		assert.Equal(t, memory.Float32(half), value, "%#x", half)
+	}
+
+	// NOTE(jkoelker) Values between halves round to the nearest, too large
+	//                values become infinite and too small ones zero.
+	for value, half := range map[float32]uint16{
+		70000:               0x7c00,
+		1e-10:               0x0000,
+		1 + 1.0/(1<<11)*1.5: 0x3c01,
+	} {
+		assert.Equal(t, memory.Float16(value), half, "%g", value)
+	}
+
+	assert.Assert(t, math.IsNaN(float64(memory.Float32(memory.Float16(float32(math.NaN()))))))
+
+	random := rand.New(rand.NewSource(1)) //nolint:gosec // deterministic test data
+
+	for idx := 0; idx < 1000; idx++ {
+		value := float32(random.NormFloat64())
+		decoded := memory.Float32(memory.Float16(value))
+		assert.Assert(t, math.Abs(float64(decoded-value)) <= math.Abs(float64(value))/2048, "%g %g", value, decoded)
+	}
+}
+
+func TestQuantize(t *testing.T) {
+	t.Parallel()
+
+	vector := []float32{0.5, -1, 0.25, 0, 0.003}
+
+	encoded, err := memory.Quantize(vector, memory.QuantizationInt8)
+	assert.NilError(t, err)
+	assert.Equal(t, len(encoded), 1+4+len(vector))
+
+	decoded, err := memory.Dequantize(encoded)
+	assert.NilError(t, err)
+	assert.Equal(t, len(decoded), len(vector))
+	assert.Equal(t, decoded[1], float32(-1))
+
+	for idx := range vector {
+		assert.Assert(t, math.Abs(float64(decoded[idx]-vector[idx])) <= 0.5/127, "%d", idx)
+	}
+
+	encoded, err = memory.Quantize(vector, memory.QuantizationFloat16)
+	assert.NilError(t, err)
+	assert.Equal(t, len(encoded), 1+2*len(vector))
+
+	decoded, err = memory.Dequantize(encoded)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, decoded[:4], vector[:4])
+
+	encoded, err = memory.Quantize([]float32{0, 0}, memory.QuantizationInt8)
+	assert.NilError(t, err)
+
+	decoded, err = memory.Dequantize(encoded)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, decoded, []float32{0, 0})
+
+	_, err = memory.Quantize(vector, memory.QuantizationNone)
+	assert.ErrorIs(t, err, memory.ErrUnknownQuantization)
+
+	for _, invalid := range [][]byte{nil, {9, 1}, {1, 0, 0, 0}, {2, 0, 0}} {
+		_, err = memory.Dequantize(invalid)
+		assert.ErrorIs(t, err, memory.ErrInvalidQuantized, "%v", invalid)
+	}
+
+	assert.ErrorIs(t, memory.ValidateQuantization("int4"), memory.ErrUnknownQuantization)
+	assert.Equal(t, string(memory.QuantizedKey("work", "id")), "quantized/work\x00id")
+}
+
+func TestQuantizedRecall(t *testing.T) {
+	t.Parallel()
+
+	ctx := log.NewContext(context.Background(), log.NewLogger("test"))
+	dir := t.TempDir()
+
+	open := func(quantization string) *memory.Local {
+		local := memory.NewLocal(dir)
+		local.Index = memory.IndexExact
+		local.EmbeddingModel = memory.BuiltinEmbeddingPlugin + "/hashed-64"
+		local.Quantization = quantization
+
+		assert.NilError(t, local.Open(ctx))
+
+		return local
+	}
+
+	records := make([]api.Record, 0, 60)
+	for idx := 0; idx < cap(records); idx++ {
+		records = append(records, api.Record{
+			Data: fmt.Sprintf("memory %d about topic %d and subject %d", idx, idx%7, idx%11),
+		})
+	}
+
+	ranking := api.SimilarityRanking()
+	query := api.Query{
+		Data:    "topic 3 and subject 5",
+		Count:   5,
+		Ranking: &ranking,
+		Fusion:  &api.Fusion{Vector: 1},
+	}
+
+	local := open(memory.QuantizationNone)
+	ids, err := local.Memorize(ctx, records)
+	assert.NilError(t, err)
+
+	exact, err := local.Recall(ctx, query)
+	assert.NilError(t, err)
+	assert.Equal(t, len(exact), 5)
+	assert.NilError(t, local.Close(ctx))
+
+	// NOTE(jkoelker) Each open with another quantization quantizes the
+	//                stored vectors again, the re-ranked recall matches
+	//                the full precision recall.
+	for _, quantization := range []string{memory.QuantizationInt8, memory.QuantizationFloat16} {
+		local = open(quantization)
+
+		recalled, err := local.Recall(ctx, query)
+		assert.NilError(t, err)
+		assert.Equal(t, len(recalled), len(exact), quantization)
+
+		for idx := range exact {
+			assert.Equal(t, recalled[idx].ID, exact[idx].ID, quantization)
+			assert.Equal(t, recalled[idx].Score, exact[idx].Score, quantization)
+		}
+
+		assert.NilError(t, local.Close(ctx))
+	}
+
+	local = open(memory.QuantizationFloat16)
+	assert.NilError(t, local.Delete(ctx, []string{exact[0].ID}))
+
+	recalled, err := local.Recall(ctx, query)
+	assert.NilError(t, err)
+	assert.Equal(t, recalled[0].ID, exact[1].ID)
+
+	_, err = local.Memorize(ctx, []api.Record{{Data: "topic 3 and subject 5"}})
+	assert.NilError(t, err)
+
+	recalled, err = local.Recall(ctx, query)
+	assert.NilError(t, err)
+	assert.Equal(t, recalled[0].Data, "topic 3 and subject 5")
+	assert.Assert(t, recalled[0].ID != ids[0])
+	assert.NilError(t, local.Close(ctx))
+}
@@ -0,0 +1,86 @@
+//
+
+package memory
+
+import (
+	"math"
+	"time"
+
+	"github.com/lazygpt/lazygpt/plugin/api"
+)
+
+// RankCandidates is how many times more memories than requested are found by
+// similarity before they are ranked, when the ranking weighs more than the
+// similarity.
+const RankCandidates = 4
+
+// ImportanceOrDefault returns the importance of the entry,
+// `api.DefaultImportance` if it has none.
+func (entry *Entry) ImportanceOrDefault() float32 {
+	if entry.Importance == 0 {
+		return api.DefaultImportance
+	}
+
+	return entry.Importance
+}
+
+// LastAccessed returns when the entry was last recalled, or created if it
+// never was.
+func (entry *Entry) LastAccessed() time.Time {
+	if entry.Accessed.IsZero() {
+		return entry.Created
+	}
+
+	return entry.Accessed
+}
+
+// Expired returns true if the entry expires at or before now.
+func (entry *Entry) Expired(now time.Time) bool {
+	return !entry.Expires.IsZero() && !entry.Expires.After(now)
+}
+
+// Importance clamps the importance to [0, 1], zero is
+// `api.DefaultImportance`.
+func Importance(importance float32) float32 {
+	switch {
+	case importance == 0:
+		return api.DefaultImportance
+	case importance < 0:
+		return 0
+	case importance > 1:
+		return 1
+	default:
+		return importance
+	}
+}
+
+// Recency returns the recency of a memory last accessed age ago, decaying
+// from 1 and halving every half life. Without a half life it is always 1.
+func Recency(age time.Duration, halfLife time.Duration) float32 {
+	if halfLife <= 0 || age <= 0 {
+		return 1
+	}
+
+	return float32(math.Exp2(-float64(age) / float64(halfLife)))
+}
+
+// Ranked reports if the ranking weighs more than the similarity.
+func Ranked(ranking api.Ranking) bool {
+	return ranking.Recency > 0 || ranking.Importance > 0
+}
+
+// Rank returns the score of the entry with the similarity for the ranking at
+// now, the weighted mean of its similarity, recency and importance. Without
+// weights the score is the similarity.
+func Rank(ranking api.Ranking, similarity float32, entry *Entry, now time.Time) float32 {
+	weights := ranking.Similarity + ranking.Recency + ranking.Importance
+	if weights <= 0 {
+		return similarity
+	}
+
+	score := ranking.Similarity * similarity
+	score += ranking.Recency * Recency(now.Sub(entry.LastAccessed()), ranking.HalfLife)
+	score += ranking.Importance * entry.ImportanceOrDefault()
+
+	return score / weights
+}
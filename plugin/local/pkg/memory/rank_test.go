@@ -0,0 +1,145 @@
+//
+
+package memory_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/lazygpt/lazygpt/plugin/api"
+	"github.com/lazygpt/lazygpt/plugin/local/pkg/memory"
+	"github.com/lazygpt/lazygpt/plugin/log"
+)
+
+func TestRecency(t *testing.T) {
+	t.Parallel()
+
+	day := 24 * time.Hour
+
+	assert.Equal(t, memory.Recency(0, day), float32(1))
+	assert.Equal(t, memory.Recency(day, day), float32(0.5))
+	assert.Equal(t, memory.Recency(2*day, day), float32(0.25))
+	assert.Equal(t, memory.Recency(2*day, 0), float32(1))
+}
+
+func TestImportance(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, memory.Importance(0), float32(api.DefaultImportance))
+	assert.Equal(t, memory.Importance(-1), float32(0))
+	assert.Equal(t, memory.Importance(2), float32(1))
+	assert.Equal(t, memory.Importance(0.8), float32(0.8))
+}
+
+func TestRank(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	entry := &memory.Entry{
+		Created:    now.Add(-api.DefaultHalfLife),
+		Importance: 0.2,
+	}
+
+	assert.Equal(t, memory.Rank(api.SimilarityRanking(), 0.9, entry, now), float32(0.9))
+	assert.Equal(t, memory.Rank(api.Ranking{}, 0.9, entry, now), float32(0.9))
+	assert.Equal(t, memory.Rank(api.DefaultRanking(), 0.9, entry, now), float32((0.9+0.5+0.2)/3))
+
+	entry.Accessed = now
+
+	assert.Equal(t, memory.Rank(api.DefaultRanking(), 0.9, entry, now), float32((0.9+1+0.2)/3))
+
+	entry.Importance = 0
+
+	assert.Equal(t, memory.Rank(api.Ranking{Importance: 1}, 0.9, entry, now), float32(api.DefaultImportance))
+}
+
+func TestRecallRanking(t *testing.T) {
+	t.Parallel()
+
+	ctx := log.NewContext(context.Background(), log.NewLogger("test"))
+
+	local := memory.NewLocal(t.TempDir())
+	local.EmbeddingModel = "fake/v1"
+	local.Embedding = embedding{}
+
+	assert.NilError(t, local.Open(ctx))
+
+	old := time.Now().Add(-30 * 24 * time.Hour)
+
+	// NOTE(jkoelker) The fake embedding embeds by length, "chatter" is the
+	//                most similar to the query but old and unimportant.
+	ids, err := local.Memorize(ctx, []api.Record{
+		{Data: "chatter", Created: old, Importance: 0.1},
+		{Data: "critical", Importance: 1},
+		{Data: "expired", Expires: time.Now().Add(-time.Minute)},
+	})
+	assert.NilError(t, err)
+
+	records, err := local.Recall(ctx, api.Query{Data: "chatter", Count: 3})
+	assert.NilError(t, err)
+	assert.Equal(t, len(records), 2)
+	assert.Equal(t, records[0].Data, "critical")
+	assert.Equal(t, records[1].Data, "chatter")
+	assert.Assert(t, !records[0].Accessed.IsZero())
+
+	record, err := local.Get(ctx, ids[1])
+	assert.NilError(t, err)
+	assert.Assert(t, !record.Accessed.IsZero())
+	assert.Equal(t, record.Importance, float32(1))
+
+	records, err = local.Recall(ctx, api.Query{
+		Data:    "chatter",
+		Count:   3,
+		Ranking: &api.Ranking{Similarity: 1},
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, records[0].Data, "chatter")
+
+	purged, err := local.PurgeExpired()
+	assert.NilError(t, err)
+	assert.Equal(t, purged, 1)
+
+	_, err = local.Get(ctx, ids[2])
+	assert.ErrorIs(t, err, api.ErrNotFound)
+
+	assert.NilError(t, local.Close(ctx))
+}
+
+func TestRecallAccessed(t *testing.T) {
+	t.Parallel()
+
+	ctx := log.NewContext(context.Background(), log.NewLogger("test"))
+	dir := t.TempDir()
+
+	local := openLocal(t, ctx, dir, "fake/v1", false)
+
+	ids, err := local.Memorize(ctx, []api.Record{{Data: "a"}, {Data: "bb"}})
+	assert.NilError(t, err)
+
+	records, err := local.Recall(ctx, api.Query{Data: "a", Count: 2})
+	assert.NilError(t, err)
+	assert.Equal(t, len(records), 2)
+
+	accessed := records[0].Accessed
+	assert.Assert(t, !accessed.IsZero())
+
+	record, err := local.Get(ctx, ids[0])
+	assert.NilError(t, err)
+	assert.Assert(t, record.Accessed.Equal(accessed))
+
+	// NOTE(jkoelker) A memory forgotten before the access times are written
+	//                does not keep the others from being written.
+	assert.NilError(t, local.Delete(ctx, ids[1:]))
+	assert.NilError(t, local.Close(ctx))
+
+	local = openLocal(t, ctx, dir, "fake/v1", false)
+
+	record, err = local.Get(ctx, ids[0])
+	assert.NilError(t, err)
+	assert.Assert(t, record.Accessed.Equal(accessed))
+
+	assert.NilError(t, local.Close(ctx))
+}
@@ -0,0 +1,482 @@
+//
+
+package memory
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"github.com/lazygpt/lazygpt/plugin/api"
+)
+
+const (
+	// DefaultPageSize is the number of memories listed when no limit is
+	// given.
+	DefaultPageSize = 50
+
+	// UpdateAttempts is the number of times an update is tried when the
+	// memory is changed by another transaction meanwhile.
+	UpdateAttempts = 3
+)
+
+// errNotEmbedded is returned by the update transaction when the data changed
+// but was not embedded yet.
+var errNotEmbedded = errors.New("data not embedded")
+
+// Record converts the entry to an `api.Record`.
+func (entry *Entry) Record() api.Record {
+	return api.Record{
+		ID:         entry.ID,
+		Data:       entry.Data,
+		Created:    entry.Created,
+		Metadata:   entry.Metadata,
+		Namespace:  entry.Namespace,
+		Model:      entry.Model,
+		Importance: entry.ImportanceOrDefault(),
+		Accessed:   entry.Accessed,
+		Expires:    entry.Expires,
+	}
+}
+
+// List implements the `api.Memory` interface by listing the memories of the
+// namespace in the order of their ids, which is the order they were created.
+// The cursor is the id of the first memory of the page.
+func (local *Local) List(ctx context.Context, options api.ListOptions) (*api.Page, error) {
+	if err := local.ensureOpen(ctx); err != nil {
+		return nil, err
+	}
+
+	local.restoring.RLock()
+	defer local.restoring.RUnlock()
+
+	limit := options.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+
+	namespace := api.Namespace(options.Namespace)
+	prefix, seek := NamespacePrefix(namespace), VectorKey(namespace, options.Cursor)
+
+	if namespace == api.AllNamespaces {
+		prefix, seek = recordPrefix, RecordKey(options.Cursor)
+	}
+
+	page := &api.Page{
+		Records: make([]api.Record, 0, limit),
+	}
+
+	if err := local.DB.View(func(txn *badger.Txn) error {
+		iter := txn.NewIterator(badger.IteratorOptions{Prefix: prefix})
+		defer iter.Close()
+
+		for iter.Seek(seek); iter.Valid(); iter.Next() {
+			id := string(bytes.TrimPrefix(iter.Item().Key(), recordPrefix))
+			if namespace != api.AllNamespaces {
+				_, id = parseVectorKey(iter.Item().Key())
+			}
+
+			if len(page.Records) == limit {
+				page.Next = id
+
+				return nil
+			}
+
+			entry, err := getEntry(txn, id)
+			if err != nil {
+				return err
+			}
+
+			local.accesses.apply(entry)
+
+			record := entry.Record()
+
+			if options.Vectors {
+				if record.Vector, err = getVector(txn, entry); err != nil {
+					return err
+				}
+			}
+
+			page.Records = append(page.Records, record)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to list memories: %w", err)
+	}
+
+	return page, nil
+}
+
+// Get implements the `api.Memory` interface.
+func (local *Local) Get(ctx context.Context, id string) (*api.Record, error) {
+	if err := local.ensureOpen(ctx); err != nil {
+		return nil, err
+	}
+
+	local.restoring.RLock()
+	defer local.restoring.RUnlock()
+
+	var record api.Record
+
+	if err := local.DB.View(func(txn *badger.Txn) error {
+		entry, err := lookupEntry(txn, id)
+		if err != nil {
+			return err
+		}
+
+		local.accesses.apply(entry)
+
+		record = entry.Record()
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to get memory: %w", err)
+	}
+
+	return &record, nil
+}
+
+// Update implements the `api.Memory` interface. The data is embedded and its
+// keywords indexed again only if it is set and changed, the memory stays in
+// its namespace. The metadata, importance and expiry are only changed if set. The data
+// is embedded outside of the transaction, which is tried again if the memory
+// changed meanwhile.
+func (local *Local) Update(ctx context.Context, record api.Record) error {
+	if err := local.ensureOpen(ctx); err != nil {
+		return err
+	}
+
+	local.restoring.RLock()
+	defer local.restoring.RUnlock()
+
+	var (
+		embedded []float32
+		err      error
+	)
+
+	for attempt := 0; attempt < UpdateAttempts; attempt++ {
+		err = local.update(record, embedded)
+		if errors.Is(err, errNotEmbedded) {
+			if embedded, err = local.embed(ctx, record.Data); err != nil {
+				return fmt.Errorf("failed to update memory: %w", err)
+			}
+
+			err = local.update(record, embedded)
+		}
+
+		if !errors.Is(err, badger.ErrConflict) {
+			break
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to update memory: %w", err)
+	}
+
+	return nil
+}
+
+// update stores the record over its memory in one transaction, using the
+// embedding of the data if it changed. It returns `errNotEmbedded` if the
+// data changed and there is no embedding.
+func (local *Local) update(record api.Record, embedded []float32) error {
+	var (
+		embedding []float32
+		namespace string
+		length    int
+		stale     bool
+	)
+
+	if err := local.DB.Update(func(txn *badger.Txn) error {
+		entry, err := lookupEntry(txn, record.ID)
+		if err != nil {
+			return err
+		}
+
+		namespace = entry.Namespace
+
+		if embedding, err = getVector(txn, entry); err != nil {
+			return err
+		}
+
+		if record.Data != "" && record.Data != entry.Data {
+			if embedded == nil {
+				return errNotEmbedded
+			}
+
+			embedding = embedded
+
+			if err := deleteKeywords(txn, entry); err != nil {
+				return err
+			}
+
+			length = -entry.Length
+			entry.Data = record.Data
+			entry.Model = local.EmbeddingModel
+			entry.Dimension = len(embedding)
+
+			if err := setKeywords(txn, entry); err != nil {
+				return err
+			}
+
+			length += entry.Length
+		}
+
+		if err := deleteDocument(txn, entry); err != nil {
+			return err
+		}
+
+		if record.Metadata != nil {
+			entry.Metadata = record.Metadata
+		}
+
+		stale = local.stale(entry)
+
+		if err := setDocument(txn, entry); err != nil {
+			return err
+		}
+
+		if record.Importance != 0 {
+			entry.Importance = Importance(record.Importance)
+		}
+
+		if !record.Expires.IsZero() {
+			entry.Expires = record.Expires
+		}
+
+		return local.setVector(txn, entry, embedding)
+	}); err != nil {
+		return err //nolint:wrapcheck // wrapped by the caller
+	}
+
+	local.markStale(record.ID, stale)
+	local.keywords.add(namespace, 0, length)
+
+	if local.indexes != nil && !stale {
+		local.indexes.Insert(namespace, record.ID, embedding)
+	}
+
+	return nil
+}
+
+// Delete implements the `api.Memory` interface. No memory is deleted if any
+// of them does not exist.
+func (local *Local) Delete(ctx context.Context, ids []string) error {
+	if err := local.ensureOpen(ctx); err != nil {
+		return err
+	}
+
+	local.restoring.RLock()
+	defer local.restoring.RUnlock()
+
+	namespaces := make([]string, len(ids))
+	lengths := make([]int, len(ids))
+
+	if err := local.DB.Update(func(txn *badger.Txn) error {
+		for idx, id := range ids {
+			entry, err := lookupEntry(txn, id)
+			if err != nil {
+				return err
+			}
+
+			namespaces[idx] = entry.Namespace
+			lengths[idx] = entry.Length
+
+			if err := deleteKeywords(txn, entry); err != nil {
+				return err
+			}
+
+			if err := deleteDocument(txn, entry); err != nil {
+				return err
+			}
+
+			if err := txn.Delete(RecordKey(id)); err != nil {
+				return fmt.Errorf("failed to delete entry: %w", err)
+			}
+
+			if err := txn.Delete(VectorKey(entry.Namespace, id)); err != nil {
+				return fmt.Errorf("failed to delete vector: %w", err)
+			}
+
+			if err := txn.Delete(QuantizedKey(entry.Namespace, id)); err != nil {
+				return fmt.Errorf("failed to delete quantized vector: %w", err)
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to delete memories: %w", err)
+	}
+
+	for idx, id := range ids {
+		local.markStale(id, false)
+		local.keywords.add(namespaces[idx], -1, -lengths[idx])
+
+		if local.indexes != nil {
+			local.indexes.Delete(namespaces[idx], id)
+		}
+	}
+
+	return nil
+}
+
+// Clear implements the `api.Memory` interface. Clearing every namespace drops
+// the record, vector, keyword and document key spaces, otherwise the entries
+// of the namespace are deleted and its vectors, keywords and documents
+// dropped.
+func (local *Local) Clear(ctx context.Context, namespace string) error {
+	if err := local.ensureOpen(ctx); err != nil {
+		return err
+	}
+
+	local.restoring.RLock()
+	defer local.restoring.RUnlock()
+
+	namespace = api.Namespace(namespace)
+
+	if err := local.clear(namespace); err != nil {
+		return fmt.Errorf("failed to clear memories: %w", err)
+	}
+
+	local.keywords.clear(namespace)
+
+	if local.indexes != nil {
+		local.indexes.Clear(namespace)
+	}
+
+	return nil
+}
+
+// clear removes the memories of the namespace from the database.
+func (local *Local) clear(namespace string) error {
+	if namespace == api.AllNamespaces {
+		return local.DB.DropPrefix( //nolint:wrapcheck // wrapped by the caller
+			recordPrefix,
+			vectorPrefix,
+			quantizedPrefix,
+			keywordPrefix,
+			documentPrefix,
+		)
+	}
+
+	batch := local.DB.NewWriteBatch()
+	defer batch.Cancel()
+
+	if err := local.DB.View(func(txn *badger.Txn) error {
+		iter := txn.NewIterator(badger.IteratorOptions{Prefix: NamespacePrefix(namespace)})
+		defer iter.Close()
+
+		for iter.Rewind(); iter.Valid(); iter.Next() {
+			_, id := parseVectorKey(iter.Item().Key())
+
+			if err := batch.Delete(RecordKey(id)); err != nil {
+				return fmt.Errorf("failed to delete entry: %w", err)
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return err //nolint:wrapcheck // wrapped by the caller
+	}
+
+	if err := batch.Flush(); err != nil {
+		return fmt.Errorf("failed to delete entries: %w", err)
+	}
+
+	return local.DB.DropPrefix( //nolint:wrapcheck // wrapped by the caller
+		NamespacePrefix(namespace),
+		QuantizedNamespacePrefix(namespace),
+		KeywordNamespacePrefix(namespace),
+		DocumentNamespacePrefix(namespace),
+	)
+}
+
+// PurgeExpired forgets the memories that expired, returning how many.
+func (local *Local) PurgeExpired() (int, error) {
+	now := time.Now()
+	expired := make([]*Entry, 0)
+	documents := make([][]byte, 0)
+
+	if err := local.DB.View(func(txn *badger.Txn) error {
+		return entries(txn, nil, func(entry *Entry) (bool, error) {
+			if !entry.Expired(now) {
+				return true, nil
+			}
+
+			expired = append(expired, entry)
+
+			key, err := linkedDocumentKey(txn, entry)
+			if key != nil {
+				documents = append(documents, key)
+			}
+
+			return true, err
+		})
+	}); err != nil {
+		return 0, fmt.Errorf("failed to find expired memories: %w", err)
+	}
+
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	batch := local.DB.NewWriteBatch()
+	defer batch.Cancel()
+
+	for _, entry := range expired {
+		if err := batch.Delete(RecordKey(entry.ID)); err != nil {
+			return 0, fmt.Errorf("failed to delete expired entry: %w", err)
+		}
+
+		if err := batch.Delete(VectorKey(entry.Namespace, entry.ID)); err != nil {
+			return 0, fmt.Errorf("failed to delete expired vector: %w", err)
+		}
+
+		if err := batch.Delete(QuantizedKey(entry.Namespace, entry.ID)); err != nil {
+			return 0, fmt.Errorf("failed to delete expired quantized vector: %w", err)
+		}
+
+		for _, key := range keywordKeys(entry) {
+			if err := batch.Delete(key); err != nil {
+				return 0, fmt.Errorf("failed to delete expired keyword: %w", err)
+			}
+		}
+	}
+
+	for _, key := range documents {
+		if err := batch.Delete(key); err != nil {
+			return 0, fmt.Errorf("failed to delete expired document chunk: %w", err)
+		}
+	}
+
+	if err := batch.Flush(); err != nil {
+		return 0, fmt.Errorf("failed to purge expired memories: %w", err)
+	}
+
+	for _, entry := range expired {
+		local.markStale(entry.ID, false)
+		local.keywords.add(entry.Namespace, -1, -entry.Length)
+
+		if local.indexes != nil {
+			local.indexes.Delete(entry.Namespace, entry.ID)
+		}
+	}
+
+	return len(expired), nil
+}
+
+// lookupEntry returns the entry with the id, the error wraps
+// `api.ErrNotFound` if there is no such entry.
+func lookupEntry(txn *badger.Txn, id string) (*Entry, error) {
+	entry, err := getEntry(txn, id)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, fmt.Errorf("%w: memory %s", api.ErrNotFound, id)
+	}
+
+	return entry, err
+}
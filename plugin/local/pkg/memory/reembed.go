@@ -0,0 +1,395 @@
+//
+
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	// ReembedBatchSize is the number of stale memories embedded in a batch
+	// between scans of the database.
+	ReembedBatchSize = 32
+
+	// ReembedLogInterval is the minimum time between progress logs of the
+	// re-embed job.
+	ReembedLogInterval = 10 * time.Second
+)
+
+// ErrInvalidEmbeddingModel is returned when the embedding model is not named
+// `<plugin>/<model>`.
+var ErrInvalidEmbeddingModel = errors.New("invalid embedding model")
+
+// SplitEmbeddingModel splits the embedding model name into the name of the
+// plugin and the name of the model within the plugin.
+func SplitEmbeddingModel(name string) (string, string, error) {
+	plugin, model, ok := strings.Cut(name, "/")
+	if !ok || plugin == "" || model == "" {
+		return "", "", fmt.Errorf("%w: %q", ErrInvalidEmbeddingModel, name)
+	}
+
+	return plugin, model, nil
+}
+
+// Progress is the state of the re-embed job.
+type Progress struct {
+	// Model the memories are re-embedded with.
+	Model string
+
+	// Total is the number of stale memories when the job started, memories
+	// found stale while it runs are added.
+	Total int
+
+	// Done is the number of memories re-embedded.
+	Done int
+
+	// Running is true while the job runs.
+	Running bool
+
+	// Err is the error the job stopped on, if any.
+	Err error
+}
+
+// reembedJob tracks the re-embed job of the local memory and the ids of the
+// stale memories, which are skipped on recall.
+type reembedJob struct {
+	cancel   context.CancelFunc
+	done     chan struct{}
+	mu       sync.Mutex
+	progress Progress
+	stale    map[string]struct{}
+}
+
+// Progress returns the state of the re-embed job.
+func (local *Local) Progress() Progress {
+	local.reembed.mu.Lock()
+	defer local.reembed.mu.Unlock()
+
+	return local.reembed.progress
+}
+
+// stale reports if the entry was not embedded by the configured model.
+func (local *Local) stale(entry *Entry) bool {
+	return entry.Model != local.EmbeddingModel
+}
+
+// markStale records if the memory with the id is stale.
+func (local *Local) markStale(id string, stale bool) {
+	local.reembed.mu.Lock()
+	defer local.reembed.mu.Unlock()
+
+	if !stale {
+		delete(local.reembed.stale, id)
+
+		return
+	}
+
+	if local.reembed.stale == nil {
+		local.reembed.stale = make(map[string]struct{})
+	}
+
+	local.reembed.stale[id] = struct{}{}
+}
+
+// clearStale forgets the stale memories.
+func (local *Local) clearStale() {
+	local.reembed.mu.Lock()
+	defer local.reembed.mu.Unlock()
+
+	local.reembed.stale = nil
+}
+
+// isStale reports if the memory with the id is stale.
+func (local *Local) isStale(id string) bool {
+	local.reembed.mu.Lock()
+	defer local.reembed.mu.Unlock()
+
+	_, ok := local.reembed.stale[id]
+
+	return ok
+}
+
+// staleModels records the stale memories and returns their number for each
+// model that embedded them.
+func (local *Local) staleModels() (map[string]int, error) {
+	models := make(map[string]int)
+
+	if err := local.DB.View(func(txn *badger.Txn) error {
+		return entries(txn, nil, func(entry *Entry) (bool, error) {
+			if local.stale(entry) {
+				models[entry.Model]++
+				local.markStale(entry.ID, true)
+			}
+
+			return true, nil
+		})
+	}); err != nil {
+		return nil, fmt.Errorf("failed to find stale memories: %w", err)
+	}
+
+	return models, nil
+}
+
+// checkModels logs the memories embedded by another model than the configured
+// one and starts re-embedding them if enabled.
+func (local *Local) checkModels() error {
+	models, err := local.staleModels()
+	if err != nil {
+		return err
+	}
+
+	total := 0
+
+	for model, count := range models {
+		local.logger.Warn(
+			"Memories were embedded by another model",
+			"model", model,
+			"memories", count,
+			"configured", local.EmbeddingModel,
+		)
+
+		total += count
+	}
+
+	if total == 0 {
+		return nil
+	}
+
+	if !local.Reembed {
+		local.logger.Warn("Re-embedding is disabled, stale memories will not be recalled", "memories", total)
+
+		return nil
+	}
+
+	local.startReembed(total)
+
+	return nil
+}
+
+// startReembed starts the re-embed job in the background, unless it is
+// already running. The job is resumable: it re-embeds whatever memories are
+// stale when it runs, so a job stopped by closing the database carries on the
+// next time it is opened.
+func (local *Local) startReembed(total int) {
+	job := &local.reembed
+
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	if job.progress.Running {
+		job.progress.Total += total
+
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	job.cancel = cancel
+	job.done = make(chan struct{})
+	job.progress = Progress{
+		Model:   local.EmbeddingModel,
+		Total:   total,
+		Running: true,
+	}
+
+	local.logger.Info("Re-embedding memories", "model", local.EmbeddingModel, "memories", total)
+
+	go func() {
+		defer close(job.done)
+
+		err := local.runReembed(ctx)
+
+		job.mu.Lock()
+		job.progress.Running = false
+		job.progress.Err = err
+		progress := job.progress
+		job.mu.Unlock()
+
+		switch {
+		case errors.Is(err, context.Canceled):
+			local.logger.Info(
+				"Re-embedding stopped, it resumes when reopened",
+				"done", progress.Done,
+				"total", progress.Total,
+			)
+
+		case err != nil:
+			local.logger.Error(
+				"Re-embedding failed",
+				"done", progress.Done,
+				"total", progress.Total,
+				"error", err,
+			)
+
+		default:
+			local.logger.Info("Re-embedding done", "memories", progress.Done)
+		}
+	}()
+}
+
+// stopReembed stops the re-embed job and waits for it to return.
+func (local *Local) stopReembed() {
+	local.reembed.mu.Lock()
+	cancel, done := local.reembed.cancel, local.reembed.done
+	local.reembed.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+
+	cancel()
+	<-done
+}
+
+// runReembed re-embeds the stale memories in the order of their ids. Once
+// the end is reached it starts over while the previous pass re-embedded any,
+// to catch memories stored behind it while it ran.
+func (local *Local) runReembed(ctx context.Context) error {
+	lastLog := time.Now()
+
+	for {
+		var (
+			cursor string
+			passed int
+		)
+
+		for {
+			batch, err := local.staleBatch(cursor)
+			if err != nil {
+				return err
+			}
+
+			if len(batch) == 0 {
+				break
+			}
+
+			if err := ctx.Err(); err != nil {
+				return err //nolint:wrapcheck // cancellation is reported as is
+			}
+
+			data := make([]string, len(batch))
+			for idx, entry := range batch {
+				data[idx] = entry.Data
+			}
+
+			embeddings, err := local.embedBatch(ctx, data)
+			if err != nil {
+				return err
+			}
+
+			for idx, entry := range batch {
+				updated, err := local.reembedEntry(entry, embeddings[idx])
+				if err != nil {
+					return err
+				}
+
+				if updated {
+					passed++
+					local.reembedDone(&lastLog)
+				}
+			}
+
+			cursor = batch[len(batch)-1].ID + "\x00"
+		}
+
+		if passed == 0 {
+			return local.SaveIndex()
+		}
+	}
+}
+
+// reembedDone counts a re-embedded memory, logging the progress at most every
+// `ReembedLogInterval`.
+func (local *Local) reembedDone(lastLog *time.Time) {
+	local.reembed.mu.Lock()
+	local.reembed.progress.Done++
+	progress := local.reembed.progress
+	local.reembed.mu.Unlock()
+
+	if time.Since(*lastLog) < ReembedLogInterval {
+		return
+	}
+
+	*lastLog = time.Now()
+
+	local.logger.Info("Re-embedding memories", "done", progress.Done, "total", progress.Total)
+}
+
+// staleBatch returns up to `ReembedBatchSize` stale entries with an id from
+// the cursor on.
+func (local *Local) staleBatch(cursor string) ([]*Entry, error) {
+	batch := make([]*Entry, 0, ReembedBatchSize)
+
+	if err := local.DB.View(func(txn *badger.Txn) error {
+		return entries(txn, RecordKey(cursor), func(entry *Entry) (bool, error) {
+			if local.stale(entry) {
+				batch = append(batch, entry)
+			}
+
+			return len(batch) < ReembedBatchSize, nil
+		})
+	}); err != nil {
+		return nil, fmt.Errorf("failed to find stale memories: %w", err)
+	}
+
+	return batch, nil
+}
+
+// reembedEntry stores the embedding of the data of the entry by the configured
+// model. The entry is left alone if it was changed or deleted meanwhile, it
+// returns false then.
+func (local *Local) reembedEntry(entry *Entry, embedding []float32) (bool, error) {
+	updated := false
+
+	err := local.DB.Update(func(txn *badger.Txn) error {
+		current, err := getEntry(txn, entry.ID)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			local.markStale(entry.ID, false)
+
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if current.Data != entry.Data || !local.stale(current) {
+			return nil
+		}
+
+		current.Model = local.EmbeddingModel
+		current.Dimension = len(embedding)
+		updated = true
+
+		return local.setVector(txn, current, embedding)
+	})
+
+	switch {
+	case errors.Is(err, badger.ErrConflict):
+		// NOTE(jkoelker) The memory changed while it was embedded, a later
+		//                pass, or the next open, looks at it again.
+		return false, nil
+
+	case err != nil:
+		return false, fmt.Errorf("failed to store re-embedded memory: %w", err)
+	}
+
+	if !updated {
+		return false, nil
+	}
+
+	local.markStale(entry.ID, false)
+
+	if local.indexes != nil {
+		local.indexes.Insert(entry.Namespace, entry.ID, embedding)
+	}
+
+	return updated, nil
+}
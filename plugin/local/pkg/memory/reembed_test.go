@@ -0,0 +1,149 @@
+//
+
+package memory_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/poll"
+
+	"github.com/lazygpt/lazygpt/plugin/api"
+	"github.com/lazygpt/lazygpt/plugin/local/pkg/memory"
+	"github.com/lazygpt/lazygpt/plugin/log"
+)
+
+// embedding is an `api.Embedding` embedding data by its length, with one
+// dimension more for each version of the model.
+type embedding struct{}
+
+func (embedding) Embedding(_ context.Context, model string, input string) ([]float32, error) {
+	vector := []float32{float32(len(input)), 1}
+
+	if model == "v2" {
+		vector = append(vector, 1)
+	}
+
+	return vector, nil
+}
+
+func (fake embedding) EmbeddingBatch(ctx context.Context, model string, inputs []string) ([][]float32, error) {
+	embeddings := make([][]float32, len(inputs))
+
+	for idx := range inputs {
+		embeddings[idx], _ = fake.Embedding(ctx, model, inputs[idx])
+	}
+
+	return embeddings, nil
+}
+
+func openLocal(t *testing.T, ctx context.Context, dir string, model string, reembed bool) *memory.Local {
+	t.Helper()
+
+	local := memory.NewLocal(dir)
+	local.Index = memory.IndexExact
+	local.EmbeddingModel = model
+	local.Embedding = embedding{}
+	local.Reembed = reembed
+
+	assert.NilError(t, local.Open(ctx))
+
+	return local
+}
+
+func TestSplitEmbeddingModel(t *testing.T) {
+	t.Parallel()
+
+	plugin, model, err := memory.SplitEmbeddingModel(memory.DefaultEmbeddingModel)
+	assert.NilError(t, err)
+	assert.Equal(t, plugin, "openai")
+	assert.Equal(t, model, "text-embedding-ada-002")
+
+	for _, name := range []string{"", "openai", "openai/", "/ada"} {
+		_, _, err := memory.SplitEmbeddingModel(name)
+		assert.ErrorIs(t, err, memory.ErrInvalidEmbeddingModel)
+	}
+}
+
+func TestReembed(t *testing.T) {
+	t.Parallel()
+
+	ctx := log.NewContext(context.Background(), log.NewLogger("test"))
+	dir := t.TempDir()
+
+	local := openLocal(t, ctx, dir, "fake/v1", true)
+
+	ids, err := local.Memorize(ctx, []api.Record{{Data: "a"}, {Data: "bb"}, {Data: "ccc"}})
+	assert.NilError(t, err)
+	assert.NilError(t, local.Close(ctx))
+
+	// NOTE(jkoelker) Without re-embedding the memories of the old model
+	//                are not recalled.
+	local = openLocal(t, ctx, dir, "fake/v2", false)
+
+	records, err := local.Recall(ctx, api.Query{Data: "bb", Count: 3})
+	assert.NilError(t, err)
+	assert.Equal(t, len(records), 0)
+	assert.Equal(t, local.Progress().Running, false)
+	assert.NilError(t, local.Close(ctx))
+
+	local = openLocal(t, ctx, dir, "fake/v2", true)
+
+	poll.WaitOn(t, func(poll.LogT) poll.Result {
+		if local.Progress().Running {
+			return poll.Continue("re-embedding")
+		}
+
+		return poll.Success()
+	}, poll.WithTimeout(10*time.Second))
+
+	progress := local.Progress()
+	assert.NilError(t, progress.Err)
+	assert.Equal(t, progress.Model, "fake/v2")
+	assert.Equal(t, progress.Total, 3)
+	assert.Equal(t, progress.Done, 3)
+
+	for _, id := range ids {
+		record, err := local.Get(ctx, id)
+		assert.NilError(t, err)
+		assert.Equal(t, record.Model, "fake/v2")
+	}
+
+	records, err = local.Recall(ctx, api.Query{Data: "bb", Count: 3})
+	assert.NilError(t, err)
+	assert.Equal(t, len(records), 3)
+	assert.Equal(t, records[0].Data, "bb")
+
+	assert.NilError(t, local.Close(ctx))
+}
+
+func TestReembedTrustedVectors(t *testing.T) {
+	t.Parallel()
+
+	ctx := log.NewContext(context.Background(), log.NewLogger("test"))
+	local := openLocal(t, ctx, t.TempDir(), "fake/v2", true)
+
+	ids, err := local.Memorize(ctx, []api.Record{
+		{Data: "a", Model: "fake/v1", Vector: []float32{1, 1}},
+		{Data: "bb", Vector: []float32{2, 1, 1}},
+	})
+	assert.NilError(t, err)
+
+	poll.WaitOn(t, func(poll.LogT) poll.Result {
+		if local.Progress().Running {
+			return poll.Continue("re-embedding")
+		}
+
+		return poll.Success()
+	}, poll.WithTimeout(10*time.Second))
+
+	assert.Equal(t, local.Progress().Done, 1)
+
+	record, err := local.Get(ctx, ids[0])
+	assert.NilError(t, err)
+	assert.Equal(t, record.Model, "fake/v2")
+
+	assert.NilError(t, local.Close(ctx))
+}
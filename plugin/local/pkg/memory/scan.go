@@ -0,0 +1,235 @@
+//
+
+package memory
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"github.com/lazygpt/lazygpt/plugin/api"
+)
+
+const (
+	// minScanRange is the fewest keys a range of a parallel scan is given,
+	// fewer are scanned faster by one goroutine.
+	minScanRange = 256
+
+	// rangeSamples is how many keys per range are sampled to split the keys
+	// into ranges.
+	rangeSamples = 8
+)
+
+// keyRange is the keys from start, included, to end, excluded. A nil end is
+// the end of the prefix scanned.
+type keyRange struct {
+	start []byte
+	end   []byte
+}
+
+// scanWorkers returns the number of goroutines scanning the vectors.
+func (local *Local) scanWorkers() int {
+	if local.ScanWorkers > 0 {
+		return local.ScanWorkers
+	}
+
+	return runtime.GOMAXPROCS(0)
+}
+
+// splitKeys splits the keys with the prefix into at most count ranges of
+// about the same number of keys, with a scan of the keys alone. Every key is
+// sampled until there are too many samples, then every other sample is
+// dropped and every other key sampled, so the samples stay evenly spread.
+func splitKeys(txn *badger.Txn, prefix []byte, count int) []keyRange {
+	samples := make([][]byte, 0, count*rangeSamples)
+	stride := 1
+	seen := 0
+
+	iter := txn.NewIterator(badger.IteratorOptions{Prefix: prefix})
+	defer iter.Close()
+
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		if seen%stride == 0 && count > 1 {
+			samples = append(samples, iter.Item().KeyCopy(nil))
+
+			if len(samples) == cap(samples) {
+				for idx := 0; 2*idx < len(samples); idx++ {
+					samples[idx] = samples[2*idx]
+				}
+
+				samples = samples[:(len(samples)+1)/2]
+				stride *= 2
+			}
+		}
+
+		seen++
+	}
+
+	if ranges := seen / minScanRange; ranges < count {
+		count = ranges
+	}
+
+	if count <= 1 {
+		return []keyRange{{start: prefix}}
+	}
+
+	ranges := make([]keyRange, 0, count)
+	start := prefix
+
+	for idx := 1; idx < count; idx++ {
+		end := samples[idx*len(samples)/count]
+		ranges = append(ranges, keyRange{start: start, end: end})
+		start = end
+	}
+
+	return append(ranges, keyRange{start: start})
+}
+
+// scanParallel adds the vectors of the key space with the key prefix,
+// decoded by decode, to the closest values of the queries in their
+// namespaces and matching their metadata, the value added is returned by
+// value. Queries without closest values, and stale memories, are skipped.
+// The keys are split into ranges scanned by goroutines of their own, each
+// keeping its own closest values which are merged once they are done.
+// Vectors are decoded into a buffer and only copied when they are closer
+// than the values kept so far.
+func (local *Local) scanParallel(
+	txn *badger.Txn,
+	space []byte,
+	prefix []byte,
+	decode func(vector []float32, data []byte) ([]float32, error),
+	closests []*Closest,
+	queries []api.Query,
+	value func(namespace string, id string) []byte,
+) error {
+	ranges := splitKeys(txn, prefix, local.scanWorkers())
+	founds := make([][]*Closest, len(ranges))
+	errs := make([]error, len(ranges))
+
+	var wg sync.WaitGroup
+
+	for idx := range ranges {
+		founds[idx] = make([]*Closest, len(closests))
+
+		for query, closest := range closests {
+			if closest != nil {
+				founds[idx][query] = NewClosest(closest.Base, closest.Count)
+				founds[idx][query].Metric = closest.Metric
+			}
+		}
+
+		wg.Add(1)
+
+		go func(idx int) {
+			defer wg.Done()
+
+			errs[idx] = local.scanRange(txn, space, prefix, &ranges[idx], decode, founds[idx], queries, value)
+		}(idx)
+	}
+
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return err //nolint:wrapcheck // already wrapped
+	}
+
+	for _, found := range founds {
+		for query, closest := range closests {
+			if closest == nil {
+				continue
+			}
+
+			for _, value := range found[query].Values {
+				closest.AddDistance(value.Distance, value.Key, value.Value)
+			}
+		}
+	}
+
+	return nil
+}
+
+// scanRange adds the vectors of the key range to the closest values of the
+// queries, see `scanParallel`.
+func (local *Local) scanRange(
+	txn *badger.Txn,
+	space []byte,
+	prefix []byte,
+	keys *keyRange,
+	decode func(vector []float32, data []byte) ([]float32, error),
+	closests []*Closest,
+	queries []api.Query,
+	value func(namespace string, id string) []byte,
+) error {
+	iter := txn.NewIterator(badger.IteratorOptions{Prefix: prefix})
+	defer iter.Close()
+
+	var buffer []float32
+
+	for iter.Seek(keys.start); iter.Valid(); iter.Next() {
+		item := iter.Item()
+		if keys.end != nil && bytes.Compare(item.Key(), keys.end) >= 0 {
+			break
+		}
+
+		namespace, id := parseNamespaceKey(space, item.Key())
+		if local.isStale(id) {
+			continue
+		}
+
+		if err := item.Value(func(data []byte) error {
+			var err error
+
+			buffer, err = decode(buffer, data)
+
+			return err
+		}); err != nil {
+			return fmt.Errorf("failed to decode vector: %w", err)
+		}
+
+		var (
+			entry  *Entry
+			vector []float32
+			key    []byte
+		)
+
+		for idx, closest := range closests {
+			if closest == nil || !queries[idx].InNamespace(namespace) {
+				continue
+			}
+
+			distance := closest.Metric.Distance(closest.Base, buffer)
+			if !closest.Accepts(distance) {
+				continue
+			}
+
+			// NOTE(jkoelker) Only the memories close enough are worth
+			//                getting the metadata of.
+			if len(queries[idx].Metadata) > 0 {
+				if entry == nil {
+					var err error
+
+					if entry, err = getEntry(txn, id); err != nil {
+						return err
+					}
+				}
+
+				if !queries[idx].Matches(entry.Metadata) {
+					continue
+				}
+			}
+
+			if vector == nil {
+				vector = append([]float32{}, buffer...)
+				key = value(namespace, id)
+			}
+
+			closest.AddDistance(distance, vector, key)
+		}
+	}
+
+	return nil
+}
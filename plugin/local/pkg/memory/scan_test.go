@@ -0,0 +1,97 @@
+//
+
+package memory_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/lazygpt/lazygpt/plugin/api"
+	"github.com/lazygpt/lazygpt/plugin/local/pkg/memory"
+	"github.com/lazygpt/lazygpt/plugin/log"
+)
+
+func TestParallelScan(t *testing.T) {
+	t.Parallel()
+
+	ctx := log.NewContext(context.Background(), log.NewLogger("test"))
+	dir := t.TempDir()
+
+	open := func(quantization string, workers int) *memory.Local {
+		local := memory.NewLocal(dir)
+		local.Index = memory.IndexExact
+		local.EmbeddingModel = memory.BuiltinEmbeddingPlugin + "/hashed-32"
+		local.Quantization = quantization
+		local.ScanWorkers = workers
+
+		assert.NilError(t, local.Open(ctx))
+
+		return local
+	}
+
+	records := make([]api.Record, 0, 2000)
+	for idx := 0; idx < cap(records); idx++ {
+		records = append(records, api.Record{
+			Data:      fmt.Sprintf("note %d on topic %d and subject %d", idx, idx%13, idx%17),
+			Namespace: fmt.Sprintf("space-%d", idx%3),
+			Metadata:  map[string]string{"parity": fmt.Sprint(idx % 2)},
+		})
+	}
+
+	local := open(memory.QuantizationNone, 1)
+	_, err := local.Memorize(ctx, records)
+	assert.NilError(t, err)
+	assert.NilError(t, local.Close(ctx))
+
+	ranking := api.SimilarityRanking()
+	queries := []api.Query{
+		{Data: "topic 4 and subject 9", Count: 10, Namespaces: []string{api.AllNamespaces}},
+		{Data: "topic 7", Count: 25, Namespaces: []string{"space-1"}},
+		{Data: "subject 2", Count: 5, Namespaces: []string{"space-0", "space-2"}, Metadata: map[string]string{"parity": "1"}},
+	}
+
+	for idx := range queries {
+		queries[idx].Ranking = &ranking
+		queries[idx].Fusion = &api.Fusion{Vector: 1}
+	}
+
+	// NOTE(jkoelker) However many goroutines scan the vectors, recall finds
+	//                the same memories one goroutine does.
+	for _, quantization := range []string{memory.QuantizationNone, memory.QuantizationInt8} {
+		local = open(quantization, 1)
+		serial, err := local.RecallBatch(ctx, queries)
+		assert.NilError(t, err)
+		assert.NilError(t, local.Close(ctx))
+
+		for _, workers := range []int{2, 8} {
+			local = open(quantization, workers)
+			parallel, err := local.RecallBatch(ctx, queries)
+			assert.NilError(t, err)
+			assert.NilError(t, local.Close(ctx))
+
+			for idx := range queries {
+				assert.Equal(t, len(parallel[idx]), queries[idx].Count)
+				assert.Equal(t, len(parallel[idx]), len(serial[idx]))
+
+				for rank := range serial[idx] {
+					assert.Equal(t, parallel[idx][rank].ID, serial[idx][rank].ID, "%s %d", quantization, workers)
+					assert.Equal(t, parallel[idx][rank].Score, serial[idx][rank].Score)
+				}
+			}
+		}
+	}
+
+	local = open(memory.QuantizationInt8, 0)
+	filtered, err := local.Recall(ctx, queries[2])
+	assert.NilError(t, err)
+
+	for _, record := range filtered {
+		assert.Equal(t, record.Metadata["parity"], "1")
+		assert.Assert(t, record.Namespace != "space-1")
+	}
+
+	assert.NilError(t, local.Close(ctx))
+}
@@ -0,0 +1,602 @@
+//
+
+package memory
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+
+	"github.com/lazygpt/lazygpt/plugin/api"
+)
+
+const (
+	// SchemaVersion is the version of the on disk layout written by this
+	// package.
+	//
+	// Version 1 stored the binary encoded embedding as the key and the data
+	// as the value. Version 2 stores each memory as an `Entry` under its id
+	// in the record key space and its vector under the same id in the vector
+	// key space. Version 3 prefixes the vector keys with the namespace of the
+	// memory. Version 4 indexes the keywords of each memory in the keyword
+	// key space. Version 5 links the chunks of documents to their memories
+	// in the document key space. Version 6 keeps a quantized copy of each
+	// vector in the quantized key space.
+	SchemaVersion = 6
+
+	// DefaultEmbeddingModel is the embedding model used when none is
+	// configured, named `<plugin>/<model>`. Memories stored before the model
+	// was recorded were embedded by it.
+	DefaultEmbeddingModel = "openai/text-embedding-ada-002"
+
+	// idRandomBytes is the number of random bytes in an id, after the
+	// creation time.
+	idRandomBytes = 8
+
+	// namespaceSeparator separates the namespace from the id in vector keys.
+	namespaceSeparator = 0
+)
+
+var (
+	// ErrSchemaVersion is returned when the database was written by a newer
+	// version of the plugin.
+	ErrSchemaVersion = errors.New("unsupported schema version")
+
+	// ErrInvalidNamespace is returned when a namespace can not be stored.
+	ErrInvalidNamespace = errors.New("invalid namespace")
+
+	schemaKey       = []byte("schema")
+	recordPrefix    = []byte("record/")
+	vectorPrefix    = []byte("vector/")
+	cachePrefix     = []byte("cache/")
+	keywordPrefix   = []byte("keyword/")
+	documentPrefix  = []byte("document/")
+	quantizedPrefix = []byte("quantized/")
+)
+
+// Entry is a memory as stored in the database.
+type Entry struct {
+	ID         string            `json:"id"`
+	Data       string            `json:"data"`
+	Created    time.Time         `json:"created"`
+	Model      string            `json:"model"`
+	Dimension  int               `json:"dimension"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	Namespace  string            `json:"namespace"`
+	Importance float32           `json:"importance,omitempty"`
+	Accessed   time.Time         `json:"accessed"`
+	Expires    time.Time         `json:"expires"`
+	Length     int               `json:"length,omitempty"`
+}
+
+// NewID returns a new random memory id. Ids sort in the order they were
+// created.
+func NewID(created time.Time) (string, error) {
+	buf := make([]byte, binary.Size(int64(0))+idRandomBytes)
+	binary.BigEndian.PutUint64(buf, uint64(created.UnixNano()))
+
+	if _, err := rand.Read(buf[binary.Size(int64(0)):]); err != nil {
+		return "", fmt.Errorf("failed to generate id: %w", err)
+	}
+
+	return hex.EncodeToString(buf), nil
+}
+
+// RecordKey returns the key the entry with the id is stored under.
+func RecordKey(id string) []byte {
+	return append(append([]byte{}, recordPrefix...), id...)
+}
+
+// NamespacePrefix returns the prefix of the keys of the vectors of the
+// namespace.
+func NamespacePrefix(namespace string) []byte {
+	return append(append(append([]byte{}, vectorPrefix...), namespace...), namespaceSeparator)
+}
+
+// VectorKey returns the key the vector of the memory with the id in the
+// namespace is stored under.
+func VectorKey(namespace string, id string) []byte {
+	return append(NamespacePrefix(namespace), id...)
+}
+
+// parseVectorKey returns the namespace and the id of the memory of the vector
+// key.
+func parseVectorKey(key []byte) (string, string) {
+	return parseNamespaceKey(vectorPrefix, key)
+}
+
+// parseNamespaceKey returns the namespace and the id of the memory of the key
+// in the key space with the prefix.
+func parseNamespaceKey(prefix []byte, key []byte) (string, string) {
+	key = bytes.TrimPrefix(key, prefix)
+
+	separator := bytes.LastIndexByte(key, namespaceSeparator)
+	if separator < 0 {
+		return "", string(key)
+	}
+
+	return string(key[:separator]), string(key[separator+1:])
+}
+
+// Decode decodes a binary encoded embedding.
+func Decode(data []byte) ([]float32, error) {
+	return decodeInto(nil, data)
+}
+
+// decodeInto decodes a binary encoded embedding into the vector, growing it
+// if it is too short, and returns it.
+func decodeInto(vector []float32, data []byte) ([]float32, error) {
+	size := binary.Size(float32(0))
+	length := len(data) / size
+
+	vector = grow(vector, length)
+	for idx := range vector {
+		vector[idx] = math.Float32frombits(binary.LittleEndian.Uint32(data[idx*size:]))
+	}
+
+	return vector, nil
+}
+
+// grow returns the vector with the length, reallocated if it is too short.
+func grow(vector []float32, length int) []float32 {
+	if cap(vector) < length {
+		return make([]float32, length)
+	}
+
+	return vector[:length]
+}
+
+// ValidateNamespace returns an error wrapping `ErrInvalidNamespace` if the
+// namespace can not be stored.
+func ValidateNamespace(namespace string) error {
+	if namespace == api.AllNamespaces || bytes.IndexByte([]byte(namespace), namespaceSeparator) >= 0 {
+		return fmt.Errorf("%w: %q", ErrInvalidNamespace, namespace)
+	}
+
+	return nil
+}
+
+// setEntry stores the entry and its vector under the namespace of the entry.
+func setEntry(txn *badger.Txn, entry *Entry, vector []float32) error {
+	if err := putEntry(txn, entry); err != nil {
+		return err
+	}
+
+	encoded, err := Encode(vector)
+	if err != nil {
+		return err
+	}
+
+	if err := txn.Set(VectorKey(entry.Namespace, entry.ID), encoded); err != nil {
+		return fmt.Errorf("failed to store vector: %w", err)
+	}
+
+	return nil
+}
+
+// putEntry stores the entry without touching its vector.
+func putEntry(txn *badger.Txn, entry *Entry) error {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode entry: %w", err)
+	}
+
+	if err := txn.Set(RecordKey(entry.ID), value); err != nil {
+		return fmt.Errorf("failed to store entry: %w", err)
+	}
+
+	return nil
+}
+
+// getEntry returns the entry with the id.
+func getEntry(txn *badger.Txn, id string) (*Entry, error) {
+	item, err := txn.Get(RecordKey(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get entry: %w", err)
+	}
+
+	var entry Entry
+
+	if err := item.Value(func(value []byte) error {
+		return json.Unmarshal(value, &entry)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to decode entry: %w", err)
+	}
+
+	return &entry, nil
+}
+
+// getVector returns the vector of the entry.
+func getVector(txn *badger.Txn, entry *Entry) ([]float32, error) {
+	item, err := txn.Get(VectorKey(entry.Namespace, entry.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get vector: %w", err)
+	}
+
+	value, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy vector: %w", err)
+	}
+
+	return Decode(value)
+}
+
+// vectors iterates the stored vectors with the key prefix calling fn with the
+// namespace, id and vector of each memory.
+func vectors(
+	txn *badger.Txn,
+	prefix []byte,
+	fn func(namespace string, id string, vector []float32) error,
+) error {
+	return scanVectors(txn, vectorPrefix, prefix, Decode, fn)
+}
+
+// scanVectors iterates the vectors of the key space with the key prefix,
+// decoded by decode, calling fn with the namespace, id and vector of each
+// memory.
+func scanVectors(
+	txn *badger.Txn,
+	space []byte,
+	prefix []byte,
+	decode func([]byte) ([]float32, error),
+	fn func(namespace string, id string, vector []float32) error,
+) error {
+	iter := txn.NewIterator(badger.IteratorOptions{Prefix: prefix})
+	defer iter.Close()
+
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		item := iter.Item()
+
+		var vector []float32
+
+		if err := item.Value(func(value []byte) error {
+			var err error
+
+			vector, err = decode(value)
+
+			return err
+		}); err != nil {
+			return fmt.Errorf("failed to decode vector: %w", err)
+		}
+
+		namespace, id := parseNamespaceKey(space, item.Key())
+
+		if err := fn(namespace, id, vector); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// entries iterates the stored entries in the order of their ids, from the
+// seek key on, calling fn with each entry until it returns false.
+func entries(txn *badger.Txn, seek []byte, fn func(entry *Entry) (bool, error)) error {
+	iter := txn.NewIterator(badger.IteratorOptions{Prefix: recordPrefix})
+	defer iter.Close()
+
+	if seek == nil {
+		seek = recordPrefix
+	}
+
+	for iter.Seek(seek); iter.Valid(); iter.Next() {
+		var entry Entry
+
+		if err := iter.Item().Value(func(value []byte) error {
+			return json.Unmarshal(value, &entry)
+		}); err != nil {
+			return fmt.Errorf("failed to decode entry: %w", err)
+		}
+
+		next, err := fn(&entry)
+		if err != nil || !next {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrations upgrade the database from the version of their index to the
+// next version. Migrations write entries with `setEntry`, so memories migrated
+// from older versions are written in the current layout and skipped by later
+// migrations.
+var migrations = map[int]func(*badger.DB) error{
+	1: migrateV1,
+	2: migrateV2,
+	3: migrateV3,
+	4: migrateV4,
+	5: migrateV5,
+}
+
+// schemaVersion returns the version of the database. A database without a
+// version is empty, or was written before versions were recorded.
+func schemaVersion(database *badger.DB) (int, error) {
+	version := 0
+
+	if err := database.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(schemaKey)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			iter := txn.NewIterator(badger.IteratorOptions{})
+			defer iter.Close()
+
+			iter.Rewind()
+
+			if iter.Valid() {
+				version = 1
+			} else {
+				version = SchemaVersion
+			}
+
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to get schema version: %w", err)
+		}
+
+		return item.Value(func(value []byte) error {
+			version, err = strconv.Atoi(string(value))
+
+			return err //nolint:wrapcheck // wrapped below
+		})
+	}); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	return version, nil
+}
+
+// setSchemaVersion records the version of the database.
+func setSchemaVersion(database *badger.DB, version int) error {
+	if err := database.Update(func(txn *badger.Txn) error {
+		return txn.Set(schemaKey, []byte(strconv.Itoa(version)))
+	}); err != nil {
+		return fmt.Errorf("failed to set schema version: %w", err)
+	}
+
+	return nil
+}
+
+// migrate upgrades the database to the current schema version, returning
+// true if any migration ran.
+func (local *Local) migrate() (bool, error) {
+	version, err := schemaVersion(local.DB)
+	if err != nil {
+		return false, err
+	}
+
+	if version > SchemaVersion {
+		return false, fmt.Errorf("%w: %d", ErrSchemaVersion, version)
+	}
+
+	migrated := version < SchemaVersion
+
+	for ; version < SchemaVersion; version++ {
+		local.logger.Info("Migrating database", "from", version, "to", version+1)
+
+		if err := migrations[version](local.DB); err != nil {
+			return false, fmt.Errorf("failed to migrate from version %d: %w", version, err)
+		}
+
+		if err := setSchemaVersion(local.DB, version+1); err != nil {
+			return false, err
+		}
+	}
+
+	return migrated, setSchemaVersion(local.DB, version)
+}
+
+// migrateV1 moves the memories keyed by their embedding into entries with
+// ids. The creation time of these memories is unknown and left zero.
+func migrateV1(database *badger.DB) error {
+	var keys [][]byte
+
+	if err := database.View(func(txn *badger.Txn) error {
+		iter := txn.NewIterator(badger.IteratorOptions{})
+		defer iter.Close()
+
+		for iter.Rewind(); iter.Valid(); iter.Next() {
+			key := iter.Item().Key()
+			if bytes.HasPrefix(key, recordPrefix) || bytes.HasPrefix(key, vectorPrefix) {
+				continue
+			}
+
+			keys = append(keys, iter.Item().KeyCopy(nil))
+		}
+
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to list memories: %w", err)
+	}
+
+	// NOTE(jkoelker) Migrate each memory in its own transaction so large
+	//                databases do not exceed the transaction size, if the
+	//                migration is interrupted the remaining legacy keys are
+	//                migrated on the next open.
+	for _, key := range keys {
+		if err := database.Update(func(txn *badger.Txn) error {
+			item, err := txn.Get(key)
+			if err != nil {
+				return fmt.Errorf("failed to get memory: %w", err)
+			}
+
+			data, err := item.ValueCopy(nil)
+			if err != nil {
+				return fmt.Errorf("failed to copy memory: %w", err)
+			}
+
+			vector, err := Decode(key)
+			if err != nil {
+				return err
+			}
+
+			id, err := NewID(time.Now())
+			if err != nil {
+				return err
+			}
+
+			entry := &Entry{
+				ID:        id,
+				Data:      string(data),
+				Model:     DefaultEmbeddingModel,
+				Dimension: len(vector),
+				Namespace: api.DefaultNamespace,
+			}
+
+			if err := setEntry(txn, entry, vector); err != nil {
+				return err
+			}
+
+			if err := txn.Delete(key); err != nil {
+				return fmt.Errorf("failed to delete legacy memory: %w", err)
+			}
+
+			return nil
+		}); err != nil {
+			return err //nolint:wrapcheck // wrapped by the caller
+		}
+	}
+
+	return nil
+}
+
+// migrateV2 moves the vectors keyed by their id under the namespace of their
+// memory. All the memories are in the default namespace.
+func migrateV2(database *badger.DB) error {
+	var ids []string
+
+	if err := database.View(func(txn *badger.Txn) error {
+		iter := txn.NewIterator(badger.IteratorOptions{Prefix: vectorPrefix})
+		defer iter.Close()
+
+		for iter.Rewind(); iter.Valid(); iter.Next() {
+			key := bytes.TrimPrefix(iter.Item().Key(), vectorPrefix)
+			if bytes.IndexByte(key, namespaceSeparator) < 0 {
+				ids = append(ids, string(key))
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to list vectors: %w", err)
+	}
+
+	for _, id := range ids {
+		if err := database.Update(func(txn *badger.Txn) error {
+			legacy := append(append([]byte{}, vectorPrefix...), id...)
+
+			item, err := txn.Get(legacy)
+			if err != nil {
+				return fmt.Errorf("failed to get vector: %w", err)
+			}
+
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return fmt.Errorf("failed to copy vector: %w", err)
+			}
+
+			vector, err := Decode(value)
+			if err != nil {
+				return err
+			}
+
+			entry, err := getEntry(txn, id)
+			if err != nil {
+				return err
+			}
+
+			entry.Namespace = api.DefaultNamespace
+
+			if err := setEntry(txn, entry, vector); err != nil {
+				return err
+			}
+
+			if err := txn.Delete(legacy); err != nil {
+				return fmt.Errorf("failed to delete legacy vector: %w", err)
+			}
+
+			return nil
+		}); err != nil {
+			return err //nolint:wrapcheck // wrapped by the caller
+		}
+	}
+
+	return nil
+}
+
+// migrateV3 indexes the keywords of every memory.
+func migrateV3(database *badger.DB) error {
+	var ids []string
+
+	if err := database.View(func(txn *badger.Txn) error {
+		return entries(txn, nil, func(entry *Entry) (bool, error) {
+			ids = append(ids, entry.ID)
+
+			return true, nil
+		})
+	}); err != nil {
+		return fmt.Errorf("failed to list memories: %w", err)
+	}
+
+	for _, id := range ids {
+		if err := database.Update(func(txn *badger.Txn) error {
+			entry, err := getEntry(txn, id)
+			if err != nil {
+				return err
+			}
+
+			if err := setKeywords(txn, entry); err != nil {
+				return err
+			}
+
+			return putEntry(txn, entry)
+		}); err != nil {
+			return err //nolint:wrapcheck // wrapped by the caller
+		}
+	}
+
+	return nil
+}
+
+// migrateV4 links the memories that are chunks of documents to their
+// documents.
+func migrateV4(database *badger.DB) error {
+	batch := database.NewWriteBatch()
+	defer batch.Cancel()
+
+	if err := database.View(func(txn *badger.Txn) error {
+		return entries(txn, nil, func(entry *Entry) (bool, error) {
+			if key, ok := documentKey(entry); ok {
+				if err := batch.Set(key, []byte(entry.ID)); err != nil {
+					return false, fmt.Errorf("failed to store document chunk: %w", err)
+				}
+			}
+
+			return true, nil
+		})
+	}); err != nil {
+		return fmt.Errorf("failed to list memories: %w", err)
+	}
+
+	if err := batch.Flush(); err != nil {
+		return fmt.Errorf("failed to link document chunks: %w", err)
+	}
+
+	return nil
+}
+
+// migrateV5 leaves the quantized key space empty, it depends on the
+// configured quantization and is filled once the database is migrated.
+func migrateV5(*badger.DB) error {
+	return nil
+}
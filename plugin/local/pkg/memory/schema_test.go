@@ -0,0 +1,62 @@
+//
+
+package memory_test
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/lazygpt/lazygpt/plugin/local/pkg/memory"
+)
+
+func TestNewID(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+
+	first, err := memory.NewID(now)
+	assert.NilError(t, err)
+
+	second, err := memory.NewID(now)
+	assert.NilError(t, err)
+
+	later, err := memory.NewID(now.Add(time.Second))
+	assert.NilError(t, err)
+
+	assert.Assert(t, first != second)
+	assert.Assert(t, first < later)
+	assert.Assert(t, second < later)
+}
+
+func TestEncodeDecode(t *testing.T) {
+	t.Parallel()
+
+	vector := []float32{0.5, -1, 3.25}
+
+	encoded, err := memory.Encode(vector)
+	assert.NilError(t, err)
+
+	decoded, err := memory.Decode(encoded)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, decoded, vector)
+}
+
+func TestKeys(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, string(memory.RecordKey("id")), "record/id")
+	assert.Equal(t, string(memory.VectorKey("work", "id")), "vector/work\x00id")
+	assert.Equal(t, string(memory.NamespacePrefix("work")), "vector/work\x00")
+	assert.Equal(t, string(memory.KeywordKey("work", "err", "id")), "keyword/work\x00err\x00id")
+	assert.Equal(t, string(memory.KeywordNamespacePrefix("work")), "keyword/work\x00")
+}
+
+func TestValidateNamespace(t *testing.T) {
+	t.Parallel()
+
+	assert.NilError(t, memory.ValidateNamespace("lazygpt/lazygpt"))
+	assert.ErrorIs(t, memory.ValidateNamespace("*"), memory.ErrInvalidNamespace)
+	assert.ErrorIs(t, memory.ValidateNamespace("a\x00b"), memory.ErrInvalidNamespace)
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package memory
+
+import "io/fs"
+
+// diskSize returns the size of the file, only unix reports the space taken
+// on disk.
+func diskSize(info fs.FileInfo) int64 {
+	return info.Size()
+}
@@ -0,0 +1,22 @@
+//go:build unix
+
+package memory
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// blockSize is the unit of `syscall.Stat_t.Blocks`.
+const blockSize = 512
+
+// diskSize returns the space the file takes on disk, badger preallocates
+// sparse files larger than the data written to them.
+func diskSize(info fs.FileInfo) int64 {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.Size()
+	}
+
+	return stat.Blocks * blockSize
+}
@@ -19,6 +19,23 @@ var (
 
 	// ErrNoEmbeddings is returned when no embeddings are returned from the OpenAI API.
 	ErrNoEmbeddings = errors.New("no embeddings returned")
+
+	// ErrUnknownEmbeddingModel is returned when the embedding model is not
+	// known to the OpenAI client.
+	ErrUnknownEmbeddingModel = errors.New("unknown embedding model")
+)
+
+const (
+	// DefaultModel is the chat model used when the request does not name one.
+	DefaultModel = openai.GPT3Dot5Turbo
+
+	// DefaultEmbeddingModel is the embedding model used when the request does
+	// not name one.
+	DefaultEmbeddingModel = openai.AdaEmbeddingV2
+
+	// MaxEmbeddingInputs is the number of inputs the OpenAI API embeds in a
+	// single request.
+	MaxEmbeddingInputs = 2048
 )
 
 type Plugin struct {
@@ -38,11 +55,17 @@ func NewPlugin(key string) *Plugin {
 	}
 }
 
-// Complete implements the `Completion` interface.
+// Complete implements the `Completion` interface. If no model is given
+// `DefaultModel` is used.
 func (plugin *Plugin) Complete(
 	ctx context.Context,
+	model string,
 	messages []api.Message,
 ) (*api.Message, api.Reason, error) {
+	if model == "" {
+		model = DefaultModel
+	}
+
 	msgs := make([]openai.ChatCompletionMessage, len(messages))
 	for i := range messages {
 		msgs[i] = openai.ChatCompletionMessage{
@@ -52,7 +75,7 @@ func (plugin *Plugin) Complete(
 	}
 
 	req := openai.ChatCompletionRequest{
-		Model:    openai.GPT3Dot5Turbo,
+		Model:    model,
 		Messages: msgs,
 		N:        1,
 	}
@@ -81,23 +104,78 @@ func (plugin *Plugin) Complete(
 	return response, api.StringToReason(resp.Choices[0].FinishReason), nil
 }
 
-// Embedding implements the `api.Embedding` interface.
-func (plugin *Plugin) Embedding(ctx context.Context, input string) ([]float32, error) {
-	req := openai.EmbeddingRequest{
-		Model: openai.AdaEmbeddingV2,
-		Input: []string{input},
+// Embedding implements the `api.Embedding` interface. If no model is given
+// `DefaultEmbeddingModel` is used.
+func (plugin *Plugin) Embedding(ctx context.Context, model string, input string) ([]float32, error) {
+	embeddings, err := plugin.EmbeddingBatch(ctx, model, []string{input})
+	if err != nil {
+		return nil, err
 	}
 
-	resp, err := plugin.Client.CreateEmbeddings(ctx, req)
+	return embeddings[0], nil
+}
+
+// EmbeddingBatch implements the `api.Embedding` interface. The inputs are
+// sent in requests of at most `MaxEmbeddingInputs`. If no model is given
+// `DefaultEmbeddingModel` is used.
+func (plugin *Plugin) EmbeddingBatch(ctx context.Context, model string, inputs []string) ([][]float32, error) {
+	embeddingModel, err := lookupEmbeddingModel(model)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create embedding: %w", err)
+		return nil, err
+	}
+
+	embeddings := make([][]float32, len(inputs))
+
+	for start := 0; start < len(inputs); start += MaxEmbeddingInputs {
+		end := start + MaxEmbeddingInputs
+		if end > len(inputs) {
+			end = len(inputs)
+		}
+
+		req := openai.EmbeddingRequest{
+			Model: embeddingModel,
+			Input: inputs[start:end],
+		}
+
+		resp, err := plugin.Client.CreateEmbeddings(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create embeddings: %w", err)
+		}
+
+		if len(resp.Data) != end-start {
+			return nil, fmt.Errorf("%w: %d of %d", ErrNoEmbeddings, len(resp.Data), end-start)
+		}
+
+		for _, data := range resp.Data {
+			if data.Index < 0 || data.Index >= end-start {
+				return nil, fmt.Errorf("%w: unexpected index %d", ErrNoEmbeddings, data.Index)
+			}
+
+			embeddings[start+data.Index] = data.Embedding
+		}
+	}
+
+	return embeddings, nil
+}
+
+// lookupEmbeddingModel returns the embedding model with the name, or
+// `DefaultEmbeddingModel` if the name is empty.
+func lookupEmbeddingModel(name string) (openai.EmbeddingModel, error) {
+	model := DefaultEmbeddingModel
+
+	if name == "" {
+		return model, nil
+	}
+
+	if err := model.UnmarshalText([]byte(name)); err != nil {
+		return model, fmt.Errorf("failed to parse embedding model: %w", err)
 	}
 
-	if len(resp.Data) == 0 {
-		return nil, ErrNoEmbeddings
+	if model == openai.Unknown {
+		return model, fmt.Errorf("%w: %s", ErrUnknownEmbeddingModel, name)
 	}
 
-	return resp.Data[0].Embedding, nil
+	return model, nil
 }
 
 // Interfaces implements the `api.Interfaces` interface.